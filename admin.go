@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// AdminAPI is a JSON API for operators, served under /admin/ on the health-check port when
+// ADMIN_API_TOKEN is set. Every request must carry "Authorization: Bearer <token>".
+//
+//	GET  /admin/guilds                    guild settings and the channels with feeds in each
+//	GET  /admin/channels[?guild=ID]       every channel's topics, filter, watchlist, locations and settings
+//	GET  /admin/caches                    ESIClient cache sizes
+//	POST /admin/caches/flush[?cache=NAME] empty the named dynamic caches, or all of them
+//	GET  /admin/sources                   killmail source connection state
+//	POST /admin/sources/{name}/reconnect  drop a streaming source's connection and dial again
+type AdminAPI struct {
+	token   string
+	esi     *ESIClient
+	sources []KillmailSource
+}
+
+func NewAdminAPI(token string, esi *ESIClient, sources []KillmailSource) *AdminAPI {
+	return &AdminAPI{token: token, esi: esi, sources: sources}
+}
+
+// adminGuild is a guild as the admin API shows it.
+type adminGuild struct {
+	ID               string   `json:"id"`
+	DefaultChannelID string   `json:"default_channel_id,omitempty"`
+	AdminChannelID   string   `json:"admin_channel_id,omitempty"`
+	MinValue         float64  `json:"min_value"`
+	EmbedStyle       string   `json:"embed_style"`
+	ManagerRoles     []string `json:"manager_roles,omitempty"`
+	Standings        int      `json:"standings"`
+	Channels         []string `json:"channels"`
+}
+
+// channelView is a channel's feed, as the admin API and the dashboard show it.
+type channelView struct {
+	ID                  string                 `json:"id"`
+	GuildID             string                 `json:"guild_id,omitempty"`
+	Topics              []string               `json:"topics"`
+	Filter              string                 `json:"filter,omitempty"`
+	Watchlist           []WatchEntry           `json:"watchlist,omitempty"`
+	Locations           []LocationSubscription `json:"locations,omitempty"`
+	DigestWindowSeconds int                    `json:"digest_window_seconds,omitempty"`
+	Suspended           string                 `json:"suspended,omitempty"`
+	EmbedStyle          string                 `json:"embed_style,omitempty"`
+	PodMode             string                 `json:"pod_mode,omitempty"`
+}
+
+// Handler returns the API's routes behind the token check.
+func (a *AdminAPI) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/guilds", a.listGuilds)
+	mux.HandleFunc("GET /admin/channels", a.listChannels)
+	mux.HandleFunc("GET /admin/caches", a.cacheSizes)
+	mux.HandleFunc("POST /admin/caches/flush", a.flushCaches)
+	mux.HandleFunc("GET /admin/sources", a.listSources)
+	mux.HandleFunc("POST /admin/sources/{name}/reconnect", a.reconnectSource)
+	return a.authorize(mux)
+}
+
+// authorize rejects requests without the bearer token. The comparison takes the same time
+// whatever the token, so it can't be guessed a byte at a time.
+func (a *AdminAPI) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="firehawk-admin"`)
+			writeAdminError(w, http.StatusUnauthorized, "missing or invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *AdminAPI) listGuilds(w http.ResponseWriter, r *http.Request) {
+	mu.RLock()
+	guilds := make(map[string]*adminGuild)
+	guild := func(id string) *adminGuild {
+		if guilds[id] == nil {
+			cfg := guildConfigs[id]
+			if cfg == nil {
+				cfg = defaultGuildConfig()
+			}
+			guilds[id] = &adminGuild{
+				ID:               id,
+				DefaultChannelID: cfg.DefaultChannelID,
+				AdminChannelID:   cfg.AdminChannelID,
+				MinValue:         cfg.MinValue,
+				EmbedStyle:       cfg.EmbedStyle,
+				ManagerRoles:     slices.Clone(cfg.ManagerRoles), // Encoded after the lock is released.
+				Standings:        len(guildStandings[id]),
+				Channels:         []string{},
+			}
+		}
+		return guilds[id]
+	}
+	for id := range guildConfigs {
+		guild(id)
+	}
+	for channelID, guildID := range channelGuilds {
+		g := guild(guildID)
+		g.Channels = append(g.Channels, channelID)
+	}
+	mu.RUnlock()
+
+	list := make([]*adminGuild, 0, len(guilds))
+	for _, g := range guilds {
+		slices.Sort(g.Channels)
+		list = append(list, g)
+	}
+	slices.SortFunc(list, func(a, b *adminGuild) int { return strings.Compare(a.ID, b.ID) })
+	writeAdminJSON(w, http.StatusOK, list)
+}
+
+func (a *AdminAPI) listChannels(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, channelViews(r.URL.Query().Get("guild")))
+}
+
+// channelViews returns every channel with a feed, sorted by ID, or only the guild's when
+// guildID is set.
+func channelViews(guildID string) []channelView {
+	mu.RLock()
+	ids := make(map[string]bool)
+	for id := range subscriptions {
+		ids[id] = true
+	}
+	for id := range channelFilters {
+		ids[id] = true
+	}
+	for id := range watchlists {
+		ids[id] = true
+	}
+	for id := range locationSubscriptions {
+		ids[id] = true
+	}
+	for id := range channelConfigs {
+		ids[id] = true
+	}
+
+	list := []channelView{}
+	for id := range ids {
+		if guildID != "" && channelGuilds[id] != guildID {
+			continue
+		}
+		list = append(list, channelViewLocked(id))
+	}
+	mu.RUnlock()
+
+	slices.SortFunc(list, func(a, b channelView) int { return strings.Compare(a.ID, b.ID) })
+	return list
+}
+
+// channelViewLocked describes one channel's feed. Callers must hold mu.
+func channelViewLocked(id string) channelView {
+	ch := channelView{
+		ID:        id,
+		GuildID:   channelGuilds[id],
+		Topics:    []string{},
+		Watchlist: slices.Clone(watchlists[id]),
+		Locations: slices.Clone(locationSubscriptions[id]),
+	}
+	for topic := range subscriptions[id] {
+		ch.Topics = append(ch.Topics, topic)
+	}
+	slices.Sort(ch.Topics)
+	if f := channelFilters[id]; f != nil {
+		ch.Filter = f.Source
+	}
+	if cfg := channelConfigs[id]; cfg != nil {
+		ch.DigestWindowSeconds = int(cfg.DigestWindow.Seconds())
+		ch.Suspended = cfg.SuspendedReason
+		ch.EmbedStyle = cfg.EmbedStyle
+		ch.PodMode = cfg.PodMode
+	}
+	return ch
+}
+
+func (a *AdminAPI) cacheSizes(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, a.esi.CacheSizes())
+}
+
+func (a *AdminAPI) flushCaches(w http.ResponseWriter, r *http.Request) {
+	flushed, err := a.esi.FlushCaches(r.URL.Query()["cache"])
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("AUDIT: admin API action=flush-caches %v", flushed)
+	writeAdminJSON(w, http.StatusOK, map[string]any{"flushed": flushed})
+}
+
+func (a *AdminAPI) listSources(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, sourceStates(a.sources))
+}
+
+func (a *AdminAPI) reconnectSource(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	for _, src := range a.sources {
+		if src.Name() != name {
+			continue
+		}
+		rc, ok := src.(reconnecter)
+		if !ok {
+			writeAdminError(w, http.StatusConflict, fmt.Sprintf("source %s polls over HTTP and has no connection to reconnect", name))
+			return
+		}
+		rc.Reconnect()
+		log.Printf("AUDIT: admin API action=reconnect source=%s", name)
+		writeAdminJSON(w, http.StatusAccepted, map[string]string{"source": name, "status": "reconnecting"})
+		return
+	}
+	writeAdminError(w, http.StatusNotFound, fmt.Sprintf("no source named %q is running", name))
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write admin API response: %v", err)
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	writeAdminJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "s3cret"
+
+// useAdminState swaps in fresh guild and channel state for a test, on top of useFeedState.
+func useAdminState(t *testing.T) {
+	t.Helper()
+	useFeedState(t)
+	oldGuilds, oldChannelGuilds, oldFilters, oldWatch, oldLocations, oldStandings := guildConfigs, channelGuilds, channelFilters, watchlists, locationSubscriptions, guildStandings
+	t.Cleanup(func() {
+		guildConfigs, channelGuilds, channelFilters, watchlists, locationSubscriptions, guildStandings = oldGuilds, oldChannelGuilds, oldFilters, oldWatch, oldLocations, oldStandings
+	})
+	guildConfigs = make(map[string]*GuildConfig)
+	channelGuilds = make(map[string]string)
+	channelFilters = make(map[string]*Filter)
+	watchlists = make(map[string][]WatchEntry)
+	locationSubscriptions = make(map[string][]LocationSubscription)
+	guildStandings = make(map[string][]Standing)
+}
+
+// adminRequest sends a request to the API with the test token and decodes the JSON reply
+// into target, when given.
+func adminRequest(t *testing.T, api *AdminAPI, method, path string, target any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rec := httptest.NewRecorder()
+	api.Handler().ServeHTTP(rec, req)
+	if target != nil {
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: Content-Type = %q", method, path, ct)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), target); err != nil {
+			t.Fatalf("%s %s: %v in %s", method, path, err, rec.Body)
+		}
+	}
+	return rec.Code
+}
+
+func TestAdminAPIRequiresToken(t *testing.T) {
+	srv := httptest.NewServer(NewAdminAPI(testAdminToken, NewESIClient("test"), nil).Handler())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{testAdminToken, http.StatusUnauthorized}, // Missing the Bearer scheme.
+		{"Bearer " + testAdminToken, http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/admin/caches", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("Authorization %q: got %d, want %d", tc.header, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestAdminAPIListsGuildsAndChannels(t *testing.T) {
+	useAdminState(t)
+	guildConfigs["g1"] = &GuildConfig{EmbedStyle: embedStyleCompact, MinValue: 1e6, DefaultChannelID: "c1"}
+	guildStandings["g1"] = []Standing{{EntityType: "alliance", EntityID: 1, Value: 10}}
+	channelGuilds["c1"] = "g1"
+	channelGuilds["c2"] = "g1"
+	channelGuilds["c3"] = "g2"
+	subscriptions["c1"] = map[string]bool{"nullsec": true, "frigates": true}
+	watchlists["c2"] = []WatchEntry{{EntityType: "character", EntityID: 90000001, Name: "Victim Pilot", Side: "losses"}}
+	channelConfigs["c2"] = &ChannelConfig{DigestWindow: time.Minute, PodMode: podModeHide}
+	subscriptions["c3"] = map[string]bool{"all": true}
+	api := NewAdminAPI(testAdminToken, NewESIClient("test"), nil)
+
+	var guilds []adminGuild
+	if code := adminRequest(t, api, http.MethodGet, "/admin/guilds", &guilds); code != http.StatusOK {
+		t.Fatalf("guilds: got %d", code)
+	}
+	if len(guilds) != 2 || guilds[0].ID != "g1" || guilds[1].ID != "g2" {
+		t.Fatalf("guilds = %+v", guilds)
+	}
+	if g := guilds[0]; g.EmbedStyle != embedStyleCompact || g.MinValue != 1e6 || g.Standings != 1 || !slices.Equal(g.Channels, []string{"c1", "c2"}) {
+		t.Errorf("g1 = %+v", g)
+	}
+	if g := guilds[1]; g.EmbedStyle != embedStyleStandard || !slices.Equal(g.Channels, []string{"c3"}) {
+		t.Errorf("g2 has no settings and should show the defaults, got %+v", g)
+	}
+
+	var channels []channelView
+	if code := adminRequest(t, api, http.MethodGet, "/admin/channels?guild=g1", &channels); code != http.StatusOK {
+		t.Fatalf("channels: got %d", code)
+	}
+	if len(channels) != 2 {
+		t.Fatalf("channels = %+v", channels)
+	}
+	if c := channels[0]; c.ID != "c1" || !slices.Equal(c.Topics, []string{"frigates", "nullsec"}) {
+		t.Errorf("c1 = %+v", c)
+	}
+	if c := channels[1]; c.ID != "c2" || len(c.Watchlist) != 1 || c.DigestWindowSeconds != 60 || c.PodMode != podModeHide {
+		t.Errorf("c2 = %+v", c)
+	}
+
+	if adminRequest(t, api, http.MethodGet, "/admin/channels", &channels); len(channels) != 3 {
+		t.Errorf("unfiltered channels = %+v, want all three", channels)
+	}
+}
+
+func TestAdminAPIFlushesCaches(t *testing.T) {
+	esi := NewESIClient("test")
+	esi.characterNames[1] = "Pilot"
+	esi.shipNames[587] = "Rifter"
+	esi.systemInfoCache[30000142] = &ESISystemInfo{Name: "Jita"}
+	api := NewAdminAPI(testAdminToken, esi, nil)
+
+	var sizes map[string]int
+	adminRequest(t, api, http.MethodGet, "/admin/caches", &sizes)
+	if sizes["characterNames"] != 1 || sizes["shipNames"] != 1 || sizes["systemInfoCache"] != 1 {
+		t.Errorf("sizes = %v", sizes)
+	}
+
+	var flushed struct{ Flushed map[string]int }
+	if code := adminRequest(t, api, http.MethodPost, "/admin/caches/flush?cache=shipNames", &flushed); code != http.StatusOK {
+		t.Fatalf("flush shipNames: got %d", code)
+	}
+	if len(flushed.Flushed) != 1 || flushed.Flushed["shipNames"] != 1 {
+		t.Errorf("flushed = %v, want shipNames only", flushed.Flushed)
+	}
+	if esi.GetCharacterName(context.Background(), 1) != "Pilot" || len(esi.shipNames) != 0 {
+		t.Error("only shipNames should have been emptied")
+	}
+
+	adminRequest(t, api, http.MethodPost, "/admin/caches/flush", &flushed)
+	if flushed.Flushed["characterNames"] != 1 || len(esi.characterNames) != 0 {
+		t.Errorf("flushing everything left characterNames, flushed = %v", flushed.Flushed)
+	}
+	if _, ok := flushed.Flushed["systemInfoCache"]; ok || len(esi.systemInfoCache) != 1 {
+		t.Error("the static system cache should never be flushed")
+	}
+
+	for _, cache := range []string{"systemInfoCache", "nope"} {
+		var body map[string]string
+		if code := adminRequest(t, api, http.MethodPost, "/admin/caches/flush?cache="+cache, &body); code != http.StatusBadRequest || body["error"] == "" {
+			t.Errorf("flush %s: got %d %v, want 400 with an error", cache, code, body)
+		}
+	}
+	if code := adminRequest(t, api, http.MethodGet, "/admin/caches/flush", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET flush: got %d, want 405", code)
+	}
+}
+
+func TestAdminAPIReconnectsSource(t *testing.T) {
+	srv := httptest.NewServer(&ReplayServer{Frames: []recordedFrame{{Frame: `{"type":"info"}`}}})
+	defer srv.Close()
+	evekill := newEveKillSource("ws" + strings.TrimPrefix(srv.URL, "http"))
+	api := NewAdminAPI(testAdminToken, NewESIClient("test"), []KillmailSource{evekill, &staticSource{name: sourceR2Z2}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go evekill.Run(ctx, make(chan *KillmailData))
+	waitFor(t, func() bool { return evekill.State().Connected })
+
+	var states []SourceState
+	adminRequest(t, api, http.MethodGet, "/admin/sources", &states)
+	if len(states) != 2 || states[0].Name != sourceEveKill || !states[0].Connected {
+		t.Errorf("sources = %+v", states)
+	}
+
+	if code := adminRequest(t, api, http.MethodPost, "/admin/sources/evekill/reconnect", nil); code != http.StatusAccepted {
+		t.Fatalf("reconnect evekill: got %d", code)
+	}
+	// A requested reconnect skips the backoff, so it is back almost at once.
+	waitFor(t, func() bool { s := evekill.State(); return s.Connected && s.Reconnects == 1 })
+
+	if code := adminRequest(t, api, http.MethodPost, "/admin/sources/r2z2/reconnect", nil); code != http.StatusConflict {
+		t.Errorf("reconnect r2z2: got %d, want 409 as it has no connection", code)
+	}
+	if code := adminRequest(t, api, http.MethodPost, "/admin/sources/redisq/reconnect", nil); code != http.StatusNotFound {
+		t.Errorf("reconnect redisq: got %d, want 404 as it isn't running", code)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,25 +20,10 @@ type ServerStatus struct {
 }
 
 // getAPIStatus is now a method on ESIClient to ensure it uses the correct HTTP client.
-func (c *ESIClient) getAPIStatus() (*ServerStatus, error) {
-	resp, err := c.httpClient.Get("https://esi.evetech.net/latest/status/?datasource=tranquility&vip")
-	if err != nil {
-		return nil, fmt.Errorf("failed to make ESI status request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ESI status endpoint returned a non-200 status: %s", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading ESI status response body: %w", err)
-	}
-
+func (c *ESIClient) getAPIStatus(ctx context.Context) (*ServerStatus, error) {
 	var status ServerStatus
-	if err := json.Unmarshal(body, &status); err != nil {
-		return nil, fmt.Errorf("error unmarshaling ESI status JSON: %w", err)
+	if err := c.makeRequest(ctx, http.MethodGet, c.baseURL+"/status/?datasource=tranquility&vip", nil, &status); err != nil {
+		return nil, fmt.Errorf("failed to get the ESI status: %w", err)
 	}
 	return &status, nil
 }
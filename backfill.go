@@ -0,0 +1,204 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Backfill tuning. A window can't start further back than the ledger remembers, or kills that
+// were posted before then could be posted again. EVEKILL_API_URL overrides the API base URL.
+const (
+	defaultEveKillAPIURL = "https://eve-kill.com/api"
+	backfillMaxWindow    = seenKillmailWindow
+	backfillPageSize     = 200
+	backfillPageDelay    = time.Second // Between API pages, to be polite to eve-kill.
+	backfillInterval     = time.Second // Between kills that go out to at least one channel.
+	backfillMaxKillmails = 500         // Kills posted per run; a busy feed would flood otherwise.
+	backfillMaxPages     = 25          // Pages fetched per run, so a busy window isn't held in memory whole.
+
+	// backfillCommandTimeout ends a /backfill run while its interaction can still be edited.
+	backfillCommandTimeout = 14 * time.Minute
+)
+
+// backfillRunning allows one backfill at a time, across all guilds and the CLI.
+var backfillRunning atomic.Bool
+
+// eveKillAPI reads killmails from eve-kill's HTTP API.
+type eveKillAPI struct {
+	baseURL string
+	client  *http.Client
+
+	// Backfill pacing, backfillPageDelay and backfillInterval; tests shorten them.
+	pageDelay, postInterval time.Duration
+}
+
+func newEveKillAPI() *eveKillAPI {
+	baseURL := os.Getenv("EVEKILL_API_URL")
+	if baseURL == "" {
+		baseURL = defaultEveKillAPIURL
+	}
+	return &eveKillAPI{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		client:       &http.Client{Timeout: 30 * time.Second},
+		pageDelay:    backfillPageDelay,
+		postInterval: backfillInterval,
+	}
+}
+
+// killmailsBetween fetches one page of the kills that happened in [from, to). The killmails
+// have the same shape as the ones on the WebSocket feed.
+func (a *eveKillAPI) killmailsBetween(ctx context.Context, from, to time.Time, page int) ([]Killmail, error) {
+	url := fmt.Sprintf("%s/killmails?start_time=%d&end_time=%d&page=%d&limit=%d", a.baseURL, from.Unix(), to.Unix(), page, backfillPageSize)
+	var kills []Killmail
+	status, err := getJSON(ctx, a.client, url, &kills)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("eve-kill API returned status %d", status)
+	}
+	return kills, nil
+}
+
+// BackfillResult summarises a backfill run.
+type BackfillResult struct {
+	Fetched   int  // Kills in the window.
+	Posted    int  // Kills queued for at least one channel.
+	Posts     int  // Channel posts queued, which is more than Posted when kills match several channels.
+	Truncated bool // The run stopped at backfillMaxPages or backfillMaxKillmails.
+}
+
+func (r BackfillResult) String() string {
+	s := fmt.Sprintf("%d kills fetched, %d posted (%d messages)", r.Fetched, r.Posted, r.Posts)
+	if r.Truncated {
+		s += fmt.Sprintf(", stopped at the limit of %d kills fetched or %d posted", backfillMaxPages*backfillPageSize, backfillMaxKillmails)
+	}
+	return s
+}
+
+// runBackfill fetches the kills in [from, to) and runs each through the live pipeline, oldest
+// first, with the embeds marked as backfilled. Only channels in channels receive them, or every
+// feed when channels is nil. The ledger's channel claims are the dedup: a kill is never posted
+// to a channel it already went to, whether live or by an earlier backfill. Kills that go out are
+// paced by backfillInterval, so the delivery queue never overflows.
+func runBackfill(ctx context.Context, api *eveKillAPI, q *DeliveryQueue, from, to time.Time, channels map[string]bool) (BackfillResult, error) {
+	var result BackfillResult
+	if !backfillRunning.CompareAndSwap(false, true) {
+		return result, fmt.Errorf("a backfill is already running")
+	}
+	defer backfillRunning.Store(false)
+
+	// The API doesn't promise an order across pages, so the window is fetched and sorted before
+	// anything is posted. A window with more than backfillMaxPages pages is cut short there.
+	var kills []Killmail
+	for page := 1; ; page++ {
+		if page > backfillMaxPages {
+			result.Truncated = true
+			break
+		}
+		if page > 1 && !sleepContext(ctx, api.pageDelay) {
+			return result, ctx.Err()
+		}
+		batch, err := api.killmailsBetween(ctx, from, to, page)
+		if err != nil {
+			return result, fmt.Errorf("failed to fetch page %d: %w", page, err)
+		}
+		kills = append(kills, batch...)
+		if len(batch) < backfillPageSize {
+			break
+		}
+	}
+	slices.SortStableFunc(kills, func(a, b Killmail) int { return cmp.Compare(a.KillmailTime.UnixNano(), b.KillmailTime.UnixNano()) })
+	result.Fetched = len(kills)
+
+	pace := time.NewTicker(api.postInterval)
+	defer pace.Stop()
+	for _, km := range kills {
+		posts := deliverKillmail(q, &KillmailData{Killmail: km}, deliveryOptions{Channels: channels, Backfilled: true})
+		if posts == 0 {
+			continue
+		}
+		result.Posted++
+		result.Posts += posts
+		if result.Posted >= backfillMaxKillmails {
+			result.Truncated = true
+			return result, nil
+		}
+		select {
+		case <-pace.C:
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+	}
+	return result, nil
+}
+
+// backfilledEmbed returns a copy of an embed marked as posted after the fact.
+func backfilledEmbed(embed *discordgo.MessageEmbed) *discordgo.MessageEmbed {
+	marked := *embed
+	marked.Title += " (backfilled)"
+	return &marked
+}
+
+// checkBackfillWindow validates a requested window against what the ledger can dedup.
+func checkBackfillWindow(from, to, now time.Time) error {
+	switch {
+	case !from.Before(to):
+		return fmt.Errorf("the window must start before it ends")
+	case to.After(now):
+		return fmt.Errorf("the window can't end in the future")
+	case now.Sub(from) > backfillMaxWindow:
+		return fmt.Errorf("the window can't start more than %d hours ago", int(backfillMaxWindow/time.Hour))
+	}
+	return nil
+}
+
+// runBackfillCLI is the `firehawk backfill` mode: it delivers a window to every feed, or to
+// one channel, and returns once everything is queued.
+func runBackfillCLI(args []string, q *DeliveryQueue) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	since := flags.Duration("since", time.Hour, "how far back the window starts")
+	fromFlag := flags.String("from", "", "window start as RFC 3339; overrides -since")
+	toFlag := flags.String("to", "", "window end as RFC 3339 (defaults to now)")
+	channelID := flags.String("channel", "", "only backfill this channel")
+	flags.Parse(args)
+
+	now := time.Now()
+	from, to := now.Add(-*since), now
+	var err error
+	if *fromFlag != "" {
+		if from, err = time.Parse(time.RFC3339, *fromFlag); err != nil {
+			log.Fatalf("Invalid -from: %v", err)
+		}
+	}
+	if *toFlag != "" {
+		if to, err = time.Parse(time.RFC3339, *toFlag); err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+	}
+	if err := checkBackfillWindow(from, to, now); err != nil {
+		log.Fatalf("Invalid backfill window: %v", err)
+	}
+	var channels map[string]bool
+	if *channelID != "" {
+		channels = map[string]bool{*channelID: true}
+	}
+
+	log.Printf("Backfilling kills from %s to %s...", from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	result, err := runBackfill(context.Background(), newEveKillAPI(), q, from, to, channels)
+	if err != nil {
+		log.Printf("Backfill stopped early: %v", err)
+	}
+	log.Printf("Backfill finished: %s.", result)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEveKillAPI serves kills from /killmails a page at a time, newest first, so a backfill that
+// only sorted within each page would post them out of order.
+type fakeEveKillAPI struct {
+	kills    []Killmail // Newest first.
+	from, to time.Time
+
+	mu    sync.Mutex
+	pages []int
+}
+
+func (f *fakeEveKillAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if r.URL.Path != "/killmails" || q.Get("start_time") != strconv.FormatInt(f.from.Unix(), 10) || q.Get("end_time") != strconv.FormatInt(f.to.Unix(), 10) {
+		http.Error(w, "unexpected request "+r.URL.String(), http.StatusBadRequest)
+		return
+	}
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	f.mu.Lock()
+	f.pages = append(f.pages, page)
+	f.mu.Unlock()
+
+	start := min((page-1)*limit, len(f.kills))
+	end := min(start+limit, len(f.kills))
+	json.NewEncoder(w).Encode(f.kills[start:end])
+}
+
+// backfillTest serves n high-sec kills, one a second and numbered from 1 in time order, and
+// returns an API for them and a delivery queue that posts straight away.
+func backfillTest(t *testing.T, n int) (*fakeEveKillAPI, *eveKillAPI, *DeliveryQueue, *scriptedSender) {
+	t.Helper()
+	useAdminState(t)
+	now := time.Now()
+	fake := &fakeEveKillAPI{from: now.Add(-time.Hour), to: now}
+	for id := n; id >= 1; id-- {
+		fake.kills = append(fake.kills, Killmail{KillmailID: id, KillmailTime: fake.from.Add(time.Duration(id) * time.Second), SystemSecurity: 0.9})
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	api := newEveKillAPI()
+	api.baseURL = srv.URL
+	api.pageDelay = time.Millisecond
+	api.postInterval = time.Millisecond
+
+	sender := newScriptedSender(nil)
+	q, _ := testDeliveryQueue(sender)
+	q.limiter.Reset(time.Millisecond / 10)
+	return fake, api, q, sender
+}
+
+// postedKillmails returns the IDs of the kills posted to the channel, in order.
+func postedKillmails(t *testing.T, sender *scriptedSender, channelID string) []int {
+	t.Helper()
+	var ids []int
+	for _, msg := range sender.sentMessages(channelID) {
+		id, err := strconv.Atoi(strings.TrimPrefix(msg.Embeds[0].URL, "https://eve-kill.com/kill/"))
+		if err != nil || !strings.HasSuffix(msg.Embeds[0].Title, " (backfilled)") {
+			t.Fatalf("unexpected message: %+v", msg.Embeds[0])
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestRunBackfillPostsInTimeOrderAcrossPages(t *testing.T) {
+	fake, api, q, sender := backfillTest(t, 250)
+	api.postInterval = 5 * time.Millisecond // Slow enough for the fake Discord under -race.
+	subscriptions["c1"] = map[string]bool{"all": true}
+	subscriptions["c2"] = map[string]bool{"highsec": true}
+	// Kill 5 already went to c1 on the live feed.
+	killmailLedger.MarkSeen(5)
+	killmailLedger.ClaimChannels(5, []string{"c1"})
+
+	result, err := runBackfill(context.Background(), api, q, fake.from, fake.to, map[string]bool{"c1": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Close(5 * time.Second)
+
+	if want := (BackfillResult{Fetched: 250, Posted: 249, Posts: 249}); result != want {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+	if !slices.Equal(fake.pages, []int{1, 2}) {
+		t.Errorf("pages fetched = %v", fake.pages)
+	}
+	var want []int
+	for id := 1; id <= 250; id++ {
+		if id != 5 {
+			want = append(want, id)
+		}
+	}
+	if got := postedKillmails(t, sender, "c1"); !slices.Equal(got, want) {
+		t.Errorf("posted to c1 = %v", got)
+	}
+	if got := sender.sent("c2"); len(got) != 0 {
+		t.Errorf("%d posts to c2, which the backfill was not for", len(got))
+	}
+}
+
+func TestRunBackfillSkipsWhatItAlreadyPosted(t *testing.T) {
+	fake, api, q, sender := backfillTest(t, 3)
+	subscriptions["c1"] = map[string]bool{"all": true}
+	if _, err := runBackfill(context.Background(), api, q, fake.from, fake.to, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second run, and the live feed replaying one of the kills, post nothing more to c1.
+	subscriptions["c2"] = map[string]bool{"all": true}
+	result, err := runBackfill(context.Background(), api, q, fake.from, fake.to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Posted != 3 || result.Posts != 3 {
+		t.Errorf("second run = %+v, want the kills posted to c2 only", result)
+	}
+	processAndSendKillmail(q, &KillmailData{Killmail: fake.kills[0]})
+	q.Close(5 * time.Second)
+
+	if got := postedKillmails(t, sender, "c1"); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("posted to c1 = %v", got)
+	}
+	if got := postedKillmails(t, sender, "c2"); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("posted to c2 = %v", got)
+	}
+}
+
+func TestRunBackfillStopsAtTheLimit(t *testing.T) {
+	fake, api, q, _ := backfillTest(t, backfillMaxKillmails+100)
+	subscriptions["c1"] = map[string]bool{"all": true}
+
+	result, err := runBackfill(context.Background(), api, q, fake.from, fake.to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Truncated || result.Posted != backfillMaxKillmails || result.Fetched != backfillMaxKillmails+100 {
+		t.Errorf("result = %+v", result)
+	}
+	// The oldest kills are the ones that went out.
+	if killmailLedger.ClaimChannels(backfillMaxKillmails, []string{"c1"}) != nil {
+		t.Errorf("kill %d was not posted", backfillMaxKillmails)
+	}
+	if got := killmailLedger.ClaimChannels(backfillMaxKillmails+1, []string{"c1"}); len(got) != 1 {
+		t.Errorf("kill %d was posted past the limit", backfillMaxKillmails+1)
+	}
+	q.Close(5 * time.Second)
+}
+
+func TestRunBackfillStopsFetchingAtThePageLimit(t *testing.T) {
+	fake, api, q, _ := backfillTest(t, backfillMaxPages*backfillPageSize+50)
+	subscriptions["c1"] = map[string]bool{"all": true}
+
+	result, err := runBackfill(context.Background(), api, q, fake.from, fake.to, map[string]bool{"nobody": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Close(5 * time.Second)
+	if !result.Truncated || result.Fetched != backfillMaxPages*backfillPageSize || result.Posted != 0 {
+		t.Errorf("result = %+v", result)
+	}
+	if len(fake.pages) != backfillMaxPages {
+		t.Errorf("fetched %d pages, want %d", len(fake.pages), backfillMaxPages)
+	}
+}
+
+func TestRunBackfillFailsOnAPIError(t *testing.T) {
+	useAdminState(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	api := newEveKillAPI()
+	api.baseURL = srv.URL
+	q, _ := testDeliveryQueue(newScriptedSender(nil))
+	defer q.Close(time.Second)
+
+	now := time.Now()
+	if _, err := runBackfill(context.Background(), api, q, now.Add(-time.Hour), now, nil); err == nil || !strings.Contains(err.Error(), "status 502") {
+		t.Errorf("runBackfill = %v, want the API status", err)
+	}
+	if backfillRunning.Load() {
+		t.Error("a failed backfill still counts as running")
+	}
+}
+
+func TestCheckBackfillWindow(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		name     string
+		from, to time.Time
+		want     string
+	}{
+		{"last hour", now.Add(-time.Hour), now, ""},
+		{"whole ledger window", now.Add(-backfillMaxWindow), now, ""},
+		{"empty", now, now, "must start before it ends"},
+		{"backwards", now, now.Add(-time.Hour), "must start before it ends"},
+		{"future", now.Add(-time.Hour), now.Add(time.Minute), "can't end in the future"},
+		{"too old", now.Add(-backfillMaxWindow - time.Minute), now.Add(-time.Hour), "more than 6 hours ago"},
+	} {
+		err := checkBackfillWindow(tc.from, tc.to, now)
+		if (tc.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
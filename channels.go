@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits for /feed digest.
+const (
+	defaultDigestWindow = 60 * time.Second
+	minDigestWindow     = 10 * time.Second
+	maxDigestWindow     = 10 * time.Minute
+)
+
+// ChannelConfig is the per-channel delivery configuration managed through /feed.
+type ChannelConfig struct {
+	DigestWindow    time.Duration // Batch kills arriving within this window into one message; 0 posts each kill.
+	SuspendedReason string        // Set when deliveries keep failing; nothing is posted until /feed resume.
+	EmbedStyle      string        // Overrides the guild's embed style when set.
+	PodMode         string        // How pod kills are handled; see the podMode constants.
+}
+
+// Keys used for ChannelConfig in the store's channel_settings table.
+const (
+	channelKeyDigestWindow = "digest_window"
+	channelKeySuspended    = "suspended"
+	channelKeyEmbedStyle   = "embed_style"
+	channelKeyPodMode      = "pod_mode"
+)
+
+// channelConfigs is guarded by mu, like subscriptions.
+var channelConfigs = make(map[string]*ChannelConfig)
+
+// channelConfigFromSettings builds a ChannelConfig from the raw key/value rows in the store.
+func channelConfigFromSettings(settings map[string]string) *ChannelConfig {
+	cfg := &ChannelConfig{}
+	if seconds, err := strconv.Atoi(settings[channelKeyDigestWindow]); err == nil && seconds > 0 {
+		cfg.DigestWindow = time.Duration(seconds) * time.Second
+	}
+	cfg.SuspendedReason = settings[channelKeySuspended]
+	cfg.EmbedStyle = settings[channelKeyEmbedStyle]
+	cfg.PodMode = settings[channelKeyPodMode]
+	return cfg
+}
+
+// settings flattens the config back into key/value rows for the store.
+func (cfg *ChannelConfig) settings() map[string]string {
+	return map[string]string{
+		channelKeyDigestWindow: strconv.Itoa(int(cfg.DigestWindow / time.Second)),
+		channelKeySuspended:    cfg.SuspendedReason,
+		channelKeyEmbedStyle:   cfg.EmbedStyle,
+		channelKeyPodMode:      cfg.PodMode,
+	}
+}
+
+// getChannelConfig returns a copy of the channel's config, or the defaults if it has none.
+func getChannelConfig(channelID string) ChannelConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+	if cfg, ok := channelConfigs[channelID]; ok {
+		return *cfg
+	}
+	return ChannelConfig{}
+}
+
+// saveChannelConfig persists the config and then swaps it into memory.
+func saveChannelConfig(channelID string, cfg ChannelConfig) error {
+	for key, value := range cfg.settings() {
+		if err := store.SetChannelSetting(channelID, key, value); err != nil {
+			return err
+		}
+	}
+	mu.Lock()
+	channelConfigs[channelID] = &cfg
+	mu.Unlock()
+	return nil
+}
+
+// loadChannelConfigsFromStore fills channelConfigs when the bot starts.
+func loadChannelConfigsFromStore(st Store) error {
+	allSettings, err := st.ChannelSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load channel settings: %w", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for channelID, settings := range allSettings {
+		channelConfigs[channelID] = channelConfigFromSettings(settings)
+	}
+	log.Printf("Loaded delivery settings for %d channels.", len(channelConfigs))
+	return nil
+}
+
+// describeChannelConfig renders the config for /feed view.
+func describeChannelConfig(channelID string, cfg ChannelConfig) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📡 **Feed settings for <#%s>**\n", channelID))
+	if cfg.SuspendedReason != "" {
+		b.WriteString(fmt.Sprintf("• ⏸️ **Suspended**: %s. Fix the bot's access, then use `/feed resume`.\n", cfg.SuspendedReason))
+	}
+	if cfg.DigestWindow > 0 {
+		b.WriteString(fmt.Sprintf("• Digest: bursts are batched every %s\n", formatWindow(cfg.DigestWindow)))
+	} else {
+		b.WriteString("• Digest: *off*, every kill is posted on its own\n")
+	}
+	if cfg.EmbedStyle != "" {
+		b.WriteString(fmt.Sprintf("• Embed style: `%s`\n", cfg.EmbedStyle))
+	} else {
+		b.WriteString("• Embed style: *server default*\n")
+	}
+	b.WriteString("• Pod kills: " + podModeDescriptions[cfg.PodMode] + "\n")
+	return b.String()
+}
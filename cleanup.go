@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// suspendAfterFailures is how many messages in a row must fail with a channel-level error
+// before the channel is suspended or removed. One failure can be a permissions edit in progress.
+const suspendAfterFailures = 3
+
+// noticeSender is the part of *discordgo.Session the janitor needs to tell guilds what it
+// cleaned up, so it can be faked.
+type noticeSender interface {
+	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	Guild(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error)
+}
+
+// channelJanitor watches delivery results and Discord events, and retires channels the bot can
+// no longer post in.
+type channelJanitor struct {
+	s        noticeSender
+	mu       sync.Mutex
+	failures map[string]int // channel ID -> consecutive channel-level failures
+}
+
+func newChannelJanitor(s noticeSender) *channelJanitor {
+	return &channelJanitor{s: s, failures: make(map[string]int)}
+}
+
+// delivered resets the channel's failure count.
+func (j *channelJanitor) delivered(channelID string) {
+	j.mu.Lock()
+	delete(j.failures, channelID)
+	j.mu.Unlock()
+}
+
+// permanentFailure counts a failed delivery. Channels that no longer exist are removed, and
+// channels the bot has lost access to are suspended so the guild can fix permissions.
+func (j *channelJanitor) permanentFailure(channelID string, err error) {
+	code := discordErrorCode(err)
+	switch code {
+	case discordgo.ErrCodeUnknownChannel, discordgo.ErrCodeUnknownGuild,
+		discordgo.ErrCodeMissingAccess, discordgo.ErrCodeMissingPermissions:
+	default:
+		return // Something wrong with the message itself, not the channel.
+	}
+
+	j.mu.Lock()
+	j.failures[channelID]++
+	count := j.failures[channelID]
+	if count >= suspendAfterFailures {
+		delete(j.failures, channelID)
+	}
+	j.mu.Unlock()
+	if count < suspendAfterFailures {
+		return
+	}
+
+	if code == discordgo.ErrCodeUnknownChannel || code == discordgo.ErrCodeUnknownGuild {
+		removeFeedChannel(j.s, channelID, fmt.Sprintf("<#%s>", channelID), "the channel no longer exists")
+		return
+	}
+	suspendFeedChannel(j.s, channelID, describeChannelError(code))
+}
+
+// describeChannelError explains a channel-level Discord error to a server admin.
+func describeChannelError(code int) string {
+	switch code {
+	case discordgo.ErrCodeMissingAccess:
+		return "Firehawk can no longer see the channel (Missing Access)"
+	case discordgo.ErrCodeMissingPermissions:
+		return "Firehawk is not allowed to post embeds there (Missing Permissions)"
+	default:
+		return fmt.Sprintf("Discord rejected every message (error %d)", code)
+	}
+}
+
+// onChannelDelete removes the feeds of a channel as soon as it is deleted.
+func (j *channelJanitor) onChannelDelete(_ *discordgo.Session, e *discordgo.ChannelDelete) {
+	removeFeedChannel(j.s, e.ID, "#"+e.Name, "the channel was deleted")
+}
+
+// onGuildDelete removes every feed in a guild when the bot is kicked from it. Discord also
+// sends GuildDelete during outages, with Unavailable set; those guilds come back on their own.
+func (j *channelJanitor) onGuildDelete(_ *discordgo.Session, e *discordgo.GuildDelete) {
+	if e.Unavailable {
+		return
+	}
+
+	mu.RLock()
+	var channels []string
+	for channelID, guildID := range channelGuilds {
+		if guildID == e.ID {
+			channels = append(channels, channelID)
+		}
+	}
+	mu.RUnlock()
+
+	var removed []string
+	for _, channelID := range channels {
+		if summary := clearFeedChannel(channelID); summary != "" {
+			removed = append(removed, fmt.Sprintf("<#%s>: %s", channelID, summary))
+		}
+	}
+	if err := store.DeleteGuildSettings(e.ID); err != nil {
+		log.Printf("Failed to delete settings for guild %s: %v", e.ID, err)
+	}
+	mu.Lock()
+	delete(guildConfigs, e.ID)
+	delete(guildStandings, e.ID)
+	mu.Unlock()
+
+	log.Printf("Removed from guild %s, cleared %d feed channel(s).", e.ID, len(removed))
+	recordSystemAudit(e.ID, "", "cleanup guild", fmt.Sprintf("bot removed from server, cleared %d feed channel(s)", len(removed)))
+	if len(removed) == 0 || e.BeforeDelete == nil {
+		return
+	}
+
+	// The admin channel is gone with the guild, so the only way left to tell anyone is the owner's DMs.
+	notice := fmt.Sprintf("🧹 Firehawk was removed from **%s**, so these feeds were deleted:\n• %s", e.BeforeDelete.Name, strings.Join(removed, "\n• "))
+	sendOwnerNotice(j.s, e.BeforeDelete.OwnerID, notice)
+}
+
+// removeFeedChannel deletes a channel's feeds and tells the guild what was removed.
+func removeFeedChannel(s noticeSender, channelID, label, reason string) {
+	mu.RLock()
+	guildID := channelGuilds[channelID]
+	mu.RUnlock()
+
+	summary := clearFeedChannel(channelID)
+	if summary == "" {
+		return
+	}
+	log.Printf("Removed feeds for channel %s in guild %s because %s: %s", channelID, guildID, reason, summary)
+	recordSystemAudit(guildID, channelID, "cleanup channel", fmt.Sprintf("%s; removed %s", reason, summary))
+	notifyGuild(s, guildID, channelID, fmt.Sprintf("🧹 Firehawk removed the killmail feeds for %s because %s: %s.", label, reason, summary))
+}
+
+// suspendFeedChannel stops deliveries to a channel until someone runs /feed resume there.
+func suspendFeedChannel(s noticeSender, channelID, reason string) {
+	cfg := getChannelConfig(channelID)
+	if cfg.SuspendedReason != "" {
+		return
+	}
+	cfg.SuspendedReason = reason
+	if err := saveChannelConfig(channelID, cfg); err != nil {
+		log.Printf("Failed to suspend channel %s: %v", channelID, err)
+		return
+	}
+
+	mu.RLock()
+	guildID := channelGuilds[channelID]
+	mu.RUnlock()
+	log.Printf("Suspended feeds for channel %s in guild %s: %s", channelID, guildID, reason)
+	recordSystemAudit(guildID, channelID, "cleanup suspend", reason)
+	notifyGuild(s, guildID, channelID, fmt.Sprintf("⏸️ Firehawk paused the killmail feed in <#%s>: %s. Give Firehawk permission to view the channel, send messages and embed links, then run `/feed resume` there.", channelID, reason))
+}
+
+// clearFeedChannel removes everything stored for a channel and returns a summary of the feeds
+// it had, or "" if it had none.
+func clearFeedChannel(channelID string) string {
+	mu.Lock()
+	var parts []string
+	if n := len(subscriptions[channelID]); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d topic(s)", n))
+	}
+	if _, ok := channelFilters[channelID]; ok {
+		parts = append(parts, "a filter")
+	}
+	if n := len(watchlists[channelID]); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d watch(es)", n))
+	}
+	if n := len(locationSubscriptions[channelID]); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d location(s)", n))
+	}
+	_, hasSettings := channelConfigs[channelID]
+	guildID, known := channelGuilds[channelID]
+
+	delete(subscriptions, channelID)
+	delete(channelFilters, channelID)
+	delete(watchlists, channelID)
+	delete(locationSubscriptions, channelID)
+	delete(channelConfigs, channelID)
+	delete(channelGuilds, channelID)
+
+	// Don't leave the guild pointing at a channel that is gone.
+	var clearedKeys []string
+	if cfg, ok := guildConfigs[guildID]; ok {
+		if cfg.DefaultChannelID == channelID {
+			cfg.DefaultChannelID = ""
+			clearedKeys = append(clearedKeys, guildKeyDefaultChannel)
+		}
+		if cfg.AdminChannelID == channelID {
+			cfg.AdminChannelID = ""
+			clearedKeys = append(clearedKeys, guildKeyAdminChannel)
+		}
+	}
+	mu.Unlock()
+
+	for _, key := range clearedKeys {
+		if err := store.SetGuildSetting(guildID, key, ""); err != nil {
+			log.Printf("Failed to clear %s for guild %s: %v", key, guildID, err)
+		}
+	}
+	if len(parts) > 0 || hasSettings || known {
+		if err := store.DeleteChannel(channelID); err != nil {
+			log.Printf("Failed to delete stored feeds for channel %s: %v", channelID, err)
+		}
+		signalTopicsChanged()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// notifyGuild posts a notice to the guild's admin channel, or DMs the owner if it has none.
+func notifyGuild(s noticeSender, guildID, skipChannelID, notice string) {
+	if guildID == "" {
+		return
+	}
+	cfg := getGuildConfig(guildID)
+	if cfg.AdminChannelID != "" && cfg.AdminChannelID != skipChannelID {
+		_, err := s.ChannelMessageSend(cfg.AdminChannelID, notice)
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to post notice to admin channel %s: %v", cfg.AdminChannelID, err)
+	}
+
+	// Prefer the session's cached copy of the guild, and ask Discord when it has none.
+	var guild *discordgo.Guild
+	if session, ok := s.(*discordgo.Session); ok && session.State != nil {
+		guild, _ = session.State.Guild(guildID)
+	}
+	if guild == nil {
+		var err error
+		if guild, err = s.Guild(guildID); err != nil {
+			log.Printf("Could not look up owner of guild %s for notice: %v", guildID, err)
+			return
+		}
+	}
+	sendOwnerNotice(s, guild.OwnerID, notice)
+}
+
+func sendOwnerNotice(s noticeSender, ownerID, notice string) {
+	dm, err := s.UserChannelCreate(ownerID)
+	if err == nil {
+		_, err = s.ChannelMessageSend(dm.ID, notice)
+	}
+	if err != nil {
+		log.Printf("Failed to DM notice to guild owner %s: %v", ownerID, err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeNotices is a noticeSender that keeps every notice, keyed by the channel it went to.
+// DMs go to the channel "dm-<user ID>".
+type fakeNotices struct {
+	guilds map[string]*discordgo.Guild
+
+	mu   sync.Mutex
+	sent map[string][]string
+}
+
+func newFakeNotices() *fakeNotices {
+	return &fakeNotices{guilds: make(map[string]*discordgo.Guild), sent: make(map[string][]string)}
+}
+
+func (f *fakeNotices) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent[channelID] = append(f.sent[channelID], content)
+	return &discordgo.Message{ChannelID: channelID, Content: content}, nil
+}
+
+func (f *fakeNotices) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: "dm-" + recipientID}, nil
+}
+
+func (f *fakeNotices) Guild(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	if g, ok := f.guilds[guildID]; ok {
+		return g, nil
+	}
+	return nil, errors.New("unknown guild")
+}
+
+func (f *fakeNotices) notices(channelID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sent[channelID]
+}
+
+// addFeedChannel gives a channel in a guild a subscription, in memory and in the store.
+func addFeedChannel(t *testing.T, guildID, channelID, topic string) {
+	t.Helper()
+	if err := store.AddSubscription(channelID, topic); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetChannelGuild(channelID, guildID); err != nil {
+		t.Fatal(err)
+	}
+	subscriptions[channelID] = map[string]bool{topic: true}
+	channelGuilds[channelID] = guildID
+}
+
+func TestJanitorSuspendsAfterThreeFailures(t *testing.T) {
+	useAdminState(t)
+	notices := newFakeNotices()
+	notices.guilds["g1"] = &discordgo.Guild{ID: "g1", OwnerID: "owner"}
+	addFeedChannel(t, "g1", "c1", "nullsec")
+	j := newChannelJanitor(notices)
+	missingAccess := restError(http.StatusForbidden, discordgo.ErrCodeMissingAccess)
+
+	// A delivery in between starts the count again.
+	j.permanentFailure("c1", missingAccess)
+	j.permanentFailure("c1", missingAccess)
+	j.delivered("c1")
+	j.permanentFailure("c1", missingAccess)
+	j.permanentFailure("c1", missingAccess)
+	// Errors about the message itself are not the channel's fault.
+	j.permanentFailure("c1", restError(http.StatusBadRequest, 50035))
+	if reason := getChannelConfig("c1").SuspendedReason; reason != "" {
+		t.Fatalf("suspended after two failures in a row: %q", reason)
+	}
+
+	j.permanentFailure("c1", missingAccess)
+	if reason := getChannelConfig("c1").SuspendedReason; !strings.Contains(reason, "Missing Access") {
+		t.Errorf("suspended reason = %q", reason)
+	}
+	if settings, _ := store.ChannelSettings(); settings["c1"][channelKeySuspended] == "" {
+		t.Errorf("suspension not saved: %v", settings)
+	}
+	// The guild has no admin channel, so its owner hears about it.
+	if got := notices.notices("dm-owner"); len(got) != 1 || !strings.Contains(got[0], "/feed resume") {
+		t.Errorf("owner notices = %q", got)
+	}
+	// The subscription is kept for when permissions are fixed.
+	if !subscriptions["c1"]["nullsec"] {
+		t.Error("suspending removed the subscription")
+	}
+}
+
+func TestJanitorRemovesUnknownChannels(t *testing.T) {
+	useAdminState(t)
+	notices := newFakeNotices()
+	addFeedChannel(t, "g1", "c1", "nullsec")
+	guildConfigs["g1"] = &GuildConfig{AdminChannelID: "admin"}
+	j := newChannelJanitor(notices)
+
+	for range suspendAfterFailures {
+		j.permanentFailure("c1", restError(http.StatusNotFound, discordgo.ErrCodeUnknownChannel))
+	}
+	if _, ok := subscriptions["c1"]; ok {
+		t.Error("subscriptions left behind")
+	}
+	if got := notices.notices("admin"); len(got) != 1 || !strings.Contains(got[0], "no longer exists: 1 topic(s)") {
+		t.Errorf("admin notices = %q", got)
+	}
+}
+
+func TestJanitorOnChannelDelete(t *testing.T) {
+	useAdminState(t)
+	notices := newFakeNotices()
+	addFeedChannel(t, "g1", "c1", "nullsec")
+	addFeedChannel(t, "g1", "c2", "lowsec")
+	channelFilters["c1"], _ = ParseFilter("value >= 1b")
+	if err := store.SetGuildSetting("g1", guildKeyDefaultChannel, "c1"); err != nil {
+		t.Fatal(err)
+	}
+	guildConfigs["g1"] = &GuildConfig{DefaultChannelID: "c1", AdminChannelID: "admin"}
+	j := newChannelJanitor(notices)
+
+	j.onChannelDelete(nil, &discordgo.ChannelDelete{Channel: &discordgo.Channel{ID: "c1", Name: "kills"}})
+
+	if _, ok := subscriptions["c1"]; ok || channelFilters["c1"] != nil || channelGuilds["c1"] != "" {
+		t.Error("c1 left in memory")
+	}
+	if subs, _ := store.Subscriptions(); len(subs["c1"]) != 0 || len(subs["c2"]) != 1 {
+		t.Errorf("stored subscriptions = %v", subs)
+	}
+	// The guild no longer points at the deleted channel.
+	if guildConfigs["g1"].DefaultChannelID != "" {
+		t.Error("default channel still set")
+	}
+	if settings, _ := store.GuildSettings("g1"); settings[guildKeyDefaultChannel] != "" {
+		t.Errorf("stored guild settings = %v", settings)
+	}
+	if got := notices.notices("admin"); len(got) != 1 || !strings.Contains(got[0], "#kills because the channel was deleted: 1 topic(s), a filter") {
+		t.Errorf("admin notices = %q", got)
+	}
+
+	// Deleting a channel without feeds says nothing.
+	j.onChannelDelete(nil, &discordgo.ChannelDelete{Channel: &discordgo.Channel{ID: "c9", Name: "chat"}})
+	if got := notices.notices("admin"); len(got) != 1 {
+		t.Errorf("admin notices = %q", got)
+	}
+}
+
+func TestJanitorOnGuildDelete(t *testing.T) {
+	useAdminState(t)
+	notices := newFakeNotices()
+	addFeedChannel(t, "g1", "c1", "nullsec")
+	addFeedChannel(t, "g1", "c2", "lowsec")
+	addFeedChannel(t, "g2", "c3", "highsec")
+	guildConfigs["g1"] = &GuildConfig{MinValue: 1e9}
+	if err := store.SetGuildSetting("g1", guildKeyMinValue, "1000000000"); err != nil {
+		t.Fatal(err)
+	}
+	j := newChannelJanitor(notices)
+
+	// An outage is not a removal.
+	j.onGuildDelete(nil, &discordgo.GuildDelete{Guild: &discordgo.Guild{ID: "g1", Unavailable: true}})
+	if len(subscriptions) != 3 {
+		t.Fatalf("an unavailable guild cleared subscriptions: %v", subscriptions)
+	}
+
+	j.onGuildDelete(nil, &discordgo.GuildDelete{
+		Guild:        &discordgo.Guild{ID: "g1"},
+		BeforeDelete: &discordgo.Guild{ID: "g1", Name: "Test Alliance", OwnerID: "owner"},
+	})
+	if len(subscriptions) != 1 || !subscriptions["c3"]["highsec"] {
+		t.Errorf("subscriptions = %v, want only g2's", subscriptions)
+	}
+	if _, ok := guildConfigs["g1"]; ok {
+		t.Error("guild config left in memory")
+	}
+	if settings, _ := store.GuildSettings("g1"); len(settings) != 0 {
+		t.Errorf("stored guild settings = %v", settings)
+	}
+	got := notices.notices("dm-owner")
+	if len(got) != 1 || !strings.Contains(got[0], "**Test Alliance**") || !strings.Contains(got[0], "<#c1>: 1 topic(s)") || !strings.Contains(got[0], "<#c2>: 1 topic(s)") {
+		t.Errorf("owner notices = %q", got)
+	}
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
-	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -19,74 +19,9 @@ import (
 // Using a map of maps (a "set") for topics is more efficient for lookups and removals.
 var subscriptions = make(map[string]map[string]bool)
 var mu sync.RWMutex // RWMutex allows multiple readers, which is slightly more efficient.
-var SubMapFile = "subscriptions.json"
 
-// Note: You will need to add your esiClient initialisation back in here.
-// var esiClient = &ESIClient{}
-
-// --- Core Subscription Logic ---
-
-// loadSubscriptionsFromFile reads the JSON file into memory when the bot starts.
-func loadSubscriptionsFromFile() {
-	mu.Lock()
-	defer mu.Unlock()
-
-	data, err := os.ReadFile(SubMapFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			log.Println("subscriptions.json not found, starting with empty subscriptions.")
-			return
-		}
-		log.Printf("Error reading subscriptions file: %v", err)
-		return
-	}
-
-	if len(data) == 0 {
-		log.Println("subscriptions.json is empty, starting with empty subscriptions.")
-		return
-	}
-
-	// The file stores a map[string][]string, so we load it into a temporary structure.
-	var subsFromFile map[string][]string
-	if err := json.Unmarshal(data, &subsFromFile); err != nil {
-		log.Printf("Error unmarshaling subscriptions JSON: %v", err)
-		return
-	}
-
-	// Convert the loaded data to our more efficient map[string]map[string]bool structure.
-	for channelID, topics := range subsFromFile {
-		if subscriptions[channelID] == nil {
-			subscriptions[channelID] = make(map[string]bool)
-		}
-		for _, topic := range topics {
-			subscriptions[channelID][topic] = true
-		}
-	}
-	log.Printf("Successfully loaded subscriptions for %d channels.", len(subscriptions))
-}
-
-// saveSubscriptionsToFile writes the current subscription map to the JSON file.
-func saveSubscriptionsToFile() error {
-	mu.RLock()
-	defer mu.RUnlock()
-
-	// Convert our efficient map back to the simple map[string][]string for storage.
-	subsToSave := make(map[string][]string)
-	for channelID, topicsSet := range subscriptions {
-		topics := make([]string, 0, len(topicsSet))
-		for topic := range topicsSet {
-			topics = append(topics, topic)
-		}
-		subsToSave[channelID] = topics
-	}
-
-	data, err := json.MarshalIndent(subsToSave, "", "  ")
-	if err != nil {
-		return fmt.Errorf("error marshaling subscriptions: %w", err)
-	}
-
-	return os.WriteFile(SubMapFile, data, 0644)
-}
+// channelFilters holds each channel's compiled filter expression. Guarded by mu, like subscriptions.
+var channelFilters = make(map[string]*Filter)
 
 // --- Command Definitions ---
 
@@ -103,28 +38,327 @@ var killmailTopicChoices = []*discordgo.ApplicationCommandOptionChoice{
 	{Name: "Battlecruiser Kills", Value: "battlecruisers"}, {Name: "Battleship Kills", Value: "battleships"},
 	{Name: "Capital Kills", Value: "capitals"}, {Name: "Freighter Kills", Value: "freighters"},
 	{Name: "Supercarrier Kills", Value: "supercarriers"}, {Name: "Titan Kills", Value: "titans"},
+	{Name: "Pod Kills", Value: "pods"},
+}
+
+// shipClassTopicChoices are the ship classes from shipgroups.json that did not fit in
+// killmailTopicChoices, which is at Discord's limit of 25 choices.
+var shipClassTopicChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Industrial Kills", Value: "industrials"}, {Name: "Mining Ship Kills", Value: "mining"},
+	{Name: "Dreadnought Kills", Value: "dreadnoughts"}, {Name: "Carrier Kills", Value: "carriers"},
+	{Name: "Shuttle Kills", Value: "shuttles"}, {Name: "Corvette Kills", Value: "corvettes"},
+}
+
+// topicChoices is every topic a channel can subscribe to. There are more than Discord allows as
+// fixed choices, so the topic options autocomplete from it instead, see topicSuggestions.
+var topicChoices = slices.Concat(killmailTopicChoices, shipClassTopicChoices)
+
+var watchEntityChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Character", Value: "character"}, {Name: "Corporation", Value: "corporation"}, {Name: "Alliance", Value: "alliance"},
 }
 
+var watchSideChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Kills and Losses", Value: "both"}, {Name: "Kills Only", Value: "kills"}, {Name: "Losses Only", Value: "losses"},
+}
+
+var minStandingOption = float64(minStanding)
+
+var minBackfillHours = 1.0
+
+var locationKindChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Region", Value: "region"}, {Name: "Constellation", Value: "constellation"}, {Name: "System", Value: "system"},
+}
+
+var embedStyleChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Standard", Value: embedStyleStandard}, {Name: "Compact", Value: embedStyleCompact}, {Name: "Detailed", Value: embedStyleDetailed},
+}
+
+// serverManagerPermission hides admin-only commands from members who can't manage the server.
+var serverManagerPermission int64 = discordgo.PermissionManageGuild
+
+// feedManagerPermission hides feed commands by default. Manager roles from /config are checked at
+// runtime, and server admins can expose the commands to those roles under Integrations.
+var feedManagerPermission int64 = discordgo.PermissionManageChannels
+
+// guildOnlyContexts keeps server-scoped commands out of DMs.
+var guildOnlyContexts = []discordgo.InteractionContextType{discordgo.InteractionContextGuild}
+
 var commands = []*discordgo.ApplicationCommand{
 	{Name: "status", Description: "Live Tranquility Status"},
 	{Name: "scout", Description: "Provides intel on a specific solar system.", Options: []*discordgo.ApplicationCommandOption{{Type: discordgo.ApplicationCommandOptionString, Name: "system_name", Description: "The name of the solar system to scout.", Required: true}}},
 	{Name: "lookup", Description: "Lookup an EVE Online character by name", Options: []*discordgo.ApplicationCommandOption{{Type: discordgo.ApplicationCommandOptionString, Name: "character_name", Description: "Name of the character (exact spelling required).", Required: true}}},
 	{
-		Name:        "subscribe",
-		Description: "Subscribe this channel to a killmail feed",
+		Name:                     "subscribe",
+		Description:              "Subscribe this channel to a killmail feed",
+		DefaultMemberPermissions: &feedManagerPermission,
+		Contexts:                 &guildOnlyContexts,
 		Options: []*discordgo.ApplicationCommandOption{
-			{Type: discordgo.ApplicationCommandOptionString, Name: "topic1", Description: "The first feed to subscribe to", Required: true, Choices: killmailTopicChoices},
-			{Type: discordgo.ApplicationCommandOptionString, Name: "topic2", Description: "The second feed to subscribe to", Required: false, Choices: killmailTopicChoices},
-			{Type: discordgo.ApplicationCommandOptionString, Name: "topic3", Description: "The third feed to subscribe to", Required: false, Choices: killmailTopicChoices},
-			{Type: discordgo.ApplicationCommandOptionString, Name: "topic4", Description: "The fourth feed to subscribe to", Required: false, Choices: killmailTopicChoices},
-			{Type: discordgo.ApplicationCommandOptionString, Name: "topic5", Description: "The fifth feed to subscribe to", Required: false, Choices: killmailTopicChoices},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "topic1", Description: "The first feed to subscribe to", Required: true, Autocomplete: true},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "topic2", Description: "The second feed to subscribe to", Required: false, Autocomplete: true},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "topic3", Description: "The third feed to subscribe to", Required: false, Autocomplete: true},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "topic4", Description: "The fourth feed to subscribe to", Required: false, Autocomplete: true},
+			{Type: discordgo.ApplicationCommandOptionString, Name: "topic5", Description: "The fifth feed to subscribe to", Required: false, Autocomplete: true},
 			{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to subscribe to (defaults to current channel)", Required: false},
 		},
 	},
-	{Name: "unsubscribe", Description: "Unsubscribe this channel from a killmail feed", Options: []*discordgo.ApplicationCommandOption{{Type: discordgo.ApplicationCommandOptionString, Name: "topic", Description: "The feed to unsubscribe from", Required: true, Choices: killmailTopicChoices}, {Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to unsubscribe", Required: false}}},
+	{Name: "unsubscribe", Description: "Unsubscribe this channel from a killmail feed", DefaultMemberPermissions: &feedManagerPermission, Contexts: &guildOnlyContexts, Options: []*discordgo.ApplicationCommandOption{{Type: discordgo.ApplicationCommandOptionString, Name: "topic", Description: "The feed to unsubscribe from", Required: true, Autocomplete: true}, {Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to unsubscribe", Required: false}}},
 	{Name: "alliance", Description: "Provides intel on a specific alliance.", Options: []*discordgo.ApplicationCommandOption{{Type: discordgo.ApplicationCommandOptionString, Name: "alliances", Description: "The name of an alliance you want to scout.", Required: true}}},
 	{Name: "group", Description: "Provides intel on a specific corporation.", Options: []*discordgo.ApplicationCommandOption{{Type: discordgo.ApplicationCommandOptionString, Name: "corporations", Description: "The name of a corporation you want to scout.", Required: true}}},
 	{Name: "tools", Description: "An up to date list of third party tools for Eve Online"},
+	{
+		Name:                     "filter",
+		Description:              "Manage a custom killmail filter expression for a channel",
+		DefaultMemberPermissions: &feedManagerPermission,
+		Contexts:                 &guildOnlyContexts,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "set",
+				Description: "Set the filter, e.g. nullsec AND capitals AND value >= 3b AND NOT npc",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "expression", Description: "The filter expression", Required: true},
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to filter (defaults to current channel)", Required: false},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "show",
+				Description: "Show the current filter",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to show (defaults to current channel)", Required: false},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "clear",
+				Description: "Remove the filter",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to clear (defaults to current channel)", Required: false},
+				},
+			},
+		},
+	},
+	{
+		Name:                     "watch",
+		Description:              "Alert a channel when a character, corporation or alliance kills or dies",
+		DefaultMemberPermissions: &feedManagerPermission,
+		Contexts:                 &guildOnlyContexts,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Add an entity to the channel's watchlist",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "type", Description: "What kind of entity to watch", Required: true, Choices: watchEntityChoices},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "The entity's name", Required: true},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "side", Description: "Alert on kills, losses or both (defaults to both)", Required: false, Choices: watchSideChoices},
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to alert (defaults to current channel)", Required: false},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Remove an entity from the channel's watchlist",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "type", Description: "What kind of entity to stop watching", Required: true, Choices: watchEntityChoices},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "The entity's name", Required: true},
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to update (defaults to current channel)", Required: false},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List the channel's watchlist",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to list (defaults to current channel)", Required: false},
+				},
+			},
+		},
+	},
+	{
+		Name:                     "location",
+		Description:              "Subscribe a channel to kills in a region, constellation or around a system",
+		DefaultMemberPermissions: &feedManagerPermission,
+		Contexts:                 &guildOnlyContexts,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Add a location subscription",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "kind", Description: "Region, constellation or system", Required: true, Choices: locationKindChoices},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "The location's name", Required: true},
+					{Type: discordgo.ApplicationCommandOptionInteger, Name: "radius", Description: "Systems only: also match kills within this many jumps", Required: false, MinValue: new(float64), MaxValue: maxJumpRadius},
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to subscribe (defaults to current channel)", Required: false},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Remove a location subscription",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "kind", Description: "Region, constellation or system", Required: true, Choices: locationKindChoices},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "The location's name", Required: true},
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to update (defaults to current channel)", Required: false},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List the channel's location subscriptions",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to list (defaults to current channel)", Required: false},
+				},
+			},
+		},
+	},
+	{
+		Name:                     "feed",
+		Description:              "View or change how killmails are delivered to a channel",
+		DefaultMemberPermissions: &feedManagerPermission,
+		Contexts:                 &guildOnlyContexts,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "view",
+				Description: "Show the channel's delivery settings",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to show (defaults to current channel)", Required: false},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "digest",
+				Description: "Batch kills into one message during busy periods",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionInteger, Name: "window", Description: "Seconds to collect kills before posting (0 turns digest off, defaults to 60)", Required: false, MinValue: new(float64), MaxValue: maxDigestWindow.Seconds()},
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to update (defaults to current channel)", Required: false},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "style",
+				Description: "Choose how killmails look in a channel",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "style", Description: "The embed style (leave empty to use the server's style)", Required: false, Choices: embedStyleChoices},
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to update (defaults to current channel)", Required: false},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "pods",
+				Description: "Choose whether pod kills are posted, hidden or merged into the pilot's ship loss",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "mode", Description: "What to do with pod kills", Required: true, Choices: podModeChoices},
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to update (defaults to current channel)", Required: false},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "resume",
+				Description: "Resume a feed that was paused because Firehawk lost access",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The channel to resume (defaults to current channel)", Required: false},
+				},
+			},
+		},
+	},
+	{
+		Name:                     "config",
+		Description:              "View or change this server's Firehawk settings",
+		DefaultMemberPermissions: &serverManagerPermission,
+		Contexts:                 &guildOnlyContexts,
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "view", Description: "Show the current settings"},
+			{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "audit", Description: "Show the most recent feed and settings changes"},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "default-channel",
+				Description: "Set where new feeds go when no channel is given (omit to use the current channel)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The default feed channel", Required: false, ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews}},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "admin-channel",
+				Description: "Set where Firehawk posts notices about removed or paused feeds (omit to DM the owner)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "The admin channel", Required: false, ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews}},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "min-value",
+				Description: "Never post kills worth less than this (0 to disable)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "value", Description: "An ISK amount such as 100m or 1.5b", Required: true},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "embed-style",
+				Description: "Choose how killmails are displayed",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "style", Description: "The embed style", Required: true, Choices: embedStyleChoices},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add-role",
+				Description: "Allow a role to manage feeds",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "The role", Required: true},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove-role",
+				Description: "Stop a role from managing feeds",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "The role", Required: true},
+				},
+			},
+		},
+	},
+	{
+		Name:                     "standings",
+		Description:              "Tell Firehawk who is friendly, so kills read as wins or losses",
+		DefaultMemberPermissions: &serverManagerPermission,
+		Contexts:                 &guildOnlyContexts,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Set the server's standing towards a character, corporation or alliance",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "type", Description: "What kind of entity", Required: true, Choices: watchEntityChoices},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "The entity's name", Required: true},
+					{Type: discordgo.ApplicationCommandOptionNumber, Name: "standing", Description: "From -10 to +10; positive is friendly (defaults to +10, use it for your own corp)", Required: false, MinValue: &minStandingOption, MaxValue: maxStanding},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Forget the server's standing towards an entity",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "type", Description: "What kind of entity", Required: true, Choices: watchEntityChoices},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "The entity's name", Required: true},
+				},
+			},
+			{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "list", Description: "List the server's standings"},
+		},
+	},
+	{
+		Name:                     "backfill",
+		Description:              "Post the kills this server's feeds missed, e.g. while Firehawk was down",
+		DefaultMemberPermissions: &serverManagerPermission,
+		Contexts:                 &guildOnlyContexts,
+		Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionInteger, Name: "hours", Description: "How many hours back to look", Required: true, MinValue: &minBackfillHours, MaxValue: backfillMaxWindow.Hours()},
+			{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "Only backfill this channel (defaults to every feed in the server)", Required: false},
+		},
+	},
 }
 
 // --- Command Handlers ---
@@ -143,9 +377,11 @@ var commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.Interac
 			optionMap[opt.Name] = opt
 		}
 
-		channelID := i.ChannelID
-		if opt, ok := optionMap["channel"]; ok {
-			channelID = opt.ChannelValue(s).ID
+		channelID, err := resolveFeedChannel(s, i, optionMap, true)
+		if err != nil {
+			content := fmt.Sprintf("❌ Cannot use that channel: %v.", err)
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
 		}
 
 		var topicsToAdd []string
@@ -154,32 +390,35 @@ var commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.Interac
 				topicsToAdd = append(topicsToAdd, opt.StringValue())
 			}
 		}
+		// Autocomplete only suggests topics; Discord accepts whatever was typed.
+		for _, topic := range topicsToAdd {
+			if !isTopicChoice(topic) {
+				content := fmt.Sprintf("❌ `%s` is not a killmail feed. Pick one of the suggested topics.", topic)
+				s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+				return
+			}
+		}
 
-		// --- Subscription Logic ---
-		mu.Lock()
+		// --- Save and Respond ---
+		added, err := addSubscriptions(channelID, topicsToAdd)
+		if err != nil {
+			log.Printf("CRITICAL: Failed to save subscriptions: %v", err)
+			// Let the user know something went wrong
+			content := "❌ Error saving subscriptions. Please try again later."
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+		}
 		var newlyAdded, alreadyExists []string
-		if subscriptions[channelID] == nil {
-			subscriptions[channelID] = make(map[string]bool)
+		for _, topic := range added {
+			newlyAdded = append(newlyAdded, fmt.Sprintf("`%s`", topic))
 		}
 		for _, topic := range topicsToAdd {
-			if subscriptions[channelID][topic] {
+			if !slices.Contains(added, topic) {
 				alreadyExists = append(alreadyExists, fmt.Sprintf("`%s`", topic))
-			} else {
-				subscriptions[channelID][topic] = true
-				newlyAdded = append(newlyAdded, fmt.Sprintf("`%s`", topic))
 			}
 		}
-		mu.Unlock() // Unlock before file I/O
-
-		// --- Save and Respond ---
 		if len(newlyAdded) > 0 {
-			if err := saveSubscriptionsToFile(); err != nil {
-				log.Printf("CRITICAL: Failed to save subscriptions: %v", err)
-				// Let the user know something went wrong
-				content := "❌ Error saving subscriptions. Please try again later."
-				s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
-				return
-			}
+			recordAudit(i, channelID, "subscribe", strings.Join(newlyAdded, ", "))
 		}
 
 		var b strings.Builder
@@ -209,35 +448,671 @@ var commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.Interac
 		}
 
 		topicToRemove := optionMap["topic"].StringValue()
-		channelID := i.ChannelID
-		if opt, ok := optionMap["channel"]; ok {
-			channelID = opt.ChannelValue(s).ID
+		channelID, err := resolveFeedChannel(s, i, optionMap, false)
+		if err != nil {
+			content := fmt.Sprintf("❌ Cannot use that channel: %v.", err)
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+		}
+
+		// --- Save and Respond ---
+		var content string
+		topicWasFound, err := removeSubscription(channelID, topicToRemove)
+		switch {
+		case err != nil:
+			log.Printf("CRITICAL: Failed to save subscriptions: %v", err)
+			content = "❌ Error saving subscriptions. Please try again later."
+		case topicWasFound:
+			content = fmt.Sprintf("✅ Unsubscribed channel <#%s> from the `%s` topic.", channelID, topicToRemove)
+			recordAudit(i, channelID, "unsubscribe", fmt.Sprintf("`%s`", topicToRemove))
+		default:
+			content = fmt.Sprintf("⚠️ Channel <#%s> was not subscribed to the `%s` topic.", channelID, topicToRemove)
+		}
+
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	},
+
+	"filter": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+		})
+
+		// --- Option Parsing ---
+		subcommand := i.ApplicationCommandData().Options[0]
+		optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+		for _, opt := range subcommand.Options {
+			optionMap[opt.Name] = opt
+		}
+
+		channelID, err := resolveFeedChannel(s, i, optionMap, subcommand.Name == "set")
+		if err != nil {
+			content := fmt.Sprintf("❌ Cannot use that channel: %v.", err)
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
 		}
 
-		// --- Subscription Logic ---
-		mu.Lock()
-		topicWasFound := false
-		if subs, ok := subscriptions[channelID]; ok && subs[topicToRemove] {
-			delete(subscriptions[channelID], topicToRemove)
-			if len(subscriptions[channelID]) == 0 {
-				delete(subscriptions, channelID)
+		var content string
+		switch subcommand.Name {
+		case "set":
+			filter, err := ParseFilter(optionMap["expression"].StringValue())
+			if err != nil {
+				content = fmt.Sprintf("❌ Invalid filter: %v", err)
+				break
 			}
-			topicWasFound = true
+			if err := store.SetFilter(channelID, filter.Source); err != nil {
+				log.Printf("CRITICAL: Failed to save filters: %v", err)
+				content = "❌ Error saving filter. Please try again later."
+				break
+			}
+			mu.Lock()
+			channelFilters[channelID] = filter
+			mu.Unlock()
+			content = fmt.Sprintf("✅ Filter for <#%s> set to: `%s`", channelID, filter.Source)
+			recordAudit(i, channelID, "filter set", fmt.Sprintf("`%s`", filter.Source))
+
+		case "show":
+			mu.RLock()
+			filter, ok := channelFilters[channelID]
+			mu.RUnlock()
+			if ok {
+				content = fmt.Sprintf("🔎 Filter for <#%s>: `%s`", channelID, filter.Source)
+			} else {
+				content = fmt.Sprintf("⚠️ Channel <#%s> has no filter set.", channelID)
+			}
+
+		case "clear":
+			ok, err := clearChannelFilter(channelID)
+			if err != nil {
+				log.Printf("CRITICAL: Failed to save filters: %v", err)
+				content = "❌ Error saving filter. Please try again later."
+				break
+			}
+			if !ok {
+				content = fmt.Sprintf("⚠️ Channel <#%s> has no filter set.", channelID)
+				break
+			}
+			content = fmt.Sprintf("✅ Filter for <#%s> cleared.", channelID)
+			recordAudit(i, channelID, "filter clear", "")
+		}
+
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	},
+
+	"watch": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+		})
+
+		// --- Option Parsing ---
+		subcommand := i.ApplicationCommandData().Options[0]
+		optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+		for _, opt := range subcommand.Options {
+			optionMap[opt.Name] = opt
+		}
+
+		channelID, err := resolveFeedChannel(s, i, optionMap, subcommand.Name == "add")
+		if err != nil {
+			content := fmt.Sprintf("❌ Cannot use that channel: %v.", err)
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
 		}
-		mu.Unlock()
 
-		// --- Save and Respond ---
 		var content string
-		if topicWasFound {
-			if err := saveSubscriptionsToFile(); err != nil {
-				log.Printf("CRITICAL: Failed to save subscriptions: %v", err)
-				content = "❌ Error saving subscriptions. Please try again later."
+		switch subcommand.Name {
+		case "add":
+			entityType := optionMap["type"].StringValue()
+			name := optionMap["name"].StringValue()
+			side := "both"
+			if opt, ok := optionMap["side"]; ok {
+				side = opt.StringValue()
+			}
+
+			searchResult, err := esiClient.performSearch(name)
+			if err != nil {
+				log.Printf("Error performing search for '%s': %v", name, err)
+				content = "❌ An error occurred while contacting the search API."
+				break
+			}
+			hit, err := findHitByType(searchResult, entityType)
+			if err != nil {
+				content = fmt.Sprintf("❌ Could not find a %s named `%s`.", entityType, name)
+				break
+			}
+			entry := WatchEntry{EntityType: entityType, EntityID: hit.ID, Name: hit.Name, Side: side}
+
+			sameEntity := func(e WatchEntry) bool { return e.EntityType == entry.EntityType && e.EntityID == entry.EntityID }
+			mu.RLock()
+			replaced := slices.ContainsFunc(watchlists[channelID], sameEntity)
+			full := !replaced && len(watchlists[channelID]) >= maxWatchesPerChannel
+			mu.RUnlock()
+
+			if full {
+				content = fmt.Sprintf("❌ Channel <#%s> already watches %d entities, remove one first.", channelID, maxWatchesPerChannel)
+				break
+			}
+			if err := store.SaveWatch(channelID, entry); err != nil {
+				log.Printf("CRITICAL: Failed to save watchlists: %v", err)
+				content = "❌ Error saving watchlist. Please try again later."
+				break
+			}
+			mu.Lock()
+			if idx := slices.IndexFunc(watchlists[channelID], sameEntity); idx >= 0 {
+				watchlists[channelID][idx] = entry
+			} else {
+				watchlists[channelID] = append(watchlists[channelID], entry)
+			}
+			mu.Unlock()
+			if replaced {
+				content = fmt.Sprintf("✅ Updated watch in <#%s>: %s", channelID, describeWatch(entry))
+			} else {
+				content = fmt.Sprintf("✅ Now watching in <#%s>: %s", channelID, describeWatch(entry))
+			}
+			recordAudit(i, channelID, "watch add", fmt.Sprintf("%s %s (%d, %s)", entry.EntityType, entry.Name, entry.EntityID, entry.Side))
+
+		case "remove":
+			entityType := optionMap["type"].StringValue()
+			name := optionMap["name"].StringValue()
+
+			mu.RLock()
+			idx := slices.IndexFunc(watchlists[channelID], func(e WatchEntry) bool {
+				return e.EntityType == entityType && strings.EqualFold(e.Name, name)
+			})
+			var removed WatchEntry
+			if idx >= 0 {
+				removed = watchlists[channelID][idx]
+			}
+			mu.RUnlock()
+
+			if idx < 0 {
+				content = fmt.Sprintf("⚠️ Channel <#%s> is not watching a %s named `%s`.", channelID, entityType, name)
+				break
+			}
+			if err := store.RemoveWatch(channelID, removed.EntityType, removed.EntityID); err != nil {
+				log.Printf("CRITICAL: Failed to save watchlists: %v", err)
+				content = "❌ Error saving watchlist. Please try again later."
+				break
+			}
+			mu.Lock()
+			watchlists[channelID] = slices.DeleteFunc(watchlists[channelID], func(e WatchEntry) bool {
+				return e.EntityType == removed.EntityType && e.EntityID == removed.EntityID
+			})
+			if len(watchlists[channelID]) == 0 {
+				delete(watchlists, channelID)
+			}
+			mu.Unlock()
+			content = fmt.Sprintf("✅ Stopped watching in <#%s>: %s", channelID, describeWatch(removed))
+			recordAudit(i, channelID, "watch remove", fmt.Sprintf("%s %s (%d)", removed.EntityType, removed.Name, removed.EntityID))
+
+		case "list":
+			mu.RLock()
+			entries := append([]WatchEntry(nil), watchlists[channelID]...)
+			mu.RUnlock()
+
+			if len(entries) == 0 {
+				content = fmt.Sprintf("⚠️ Channel <#%s> is not watching anything.", channelID)
+				break
+			}
+			var b strings.Builder
+			b.WriteString(fmt.Sprintf("👁️ Watchlist for <#%s>:\n", channelID))
+			for _, entry := range entries {
+				b.WriteString(fmt.Sprintf("• %s\n", describeWatch(entry)))
+			}
+			content = b.String()
+		}
+
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	},
+
+	"location": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+		})
+
+		// --- Option Parsing ---
+		subcommand := i.ApplicationCommandData().Options[0]
+		optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+		for _, opt := range subcommand.Options {
+			optionMap[opt.Name] = opt
+		}
+
+		channelID, err := resolveFeedChannel(s, i, optionMap, subcommand.Name == "add")
+		if err != nil {
+			content := fmt.Sprintf("❌ Cannot use that channel: %v.", err)
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+		}
+
+		var content string
+		switch subcommand.Name {
+		case "add":
+			kind := optionMap["kind"].StringValue()
+			name := optionMap["name"].StringValue()
+			radius := 0
+			if opt, ok := optionMap["radius"]; ok {
+				radius = int(opt.IntValue())
+			}
+			if radius > 0 && kind != "system" {
+				content = "❌ A jump radius can only be used with a system."
+				break
+			}
+
+			entry := LocationSubscription{Kind: kind, Radius: radius}
+			if kind == "system" {
+				sys, ok := esiClient.FindSystemByName(name)
+				if !ok {
+					content = fmt.Sprintf("❌ Could not find a system named `%s`.", name)
+					break
+				}
+				entry.ID, entry.Name = sys.SystemID, sys.Name
 			} else {
-				content = fmt.Sprintf("✅ Unsubscribed channel <#%s> from the `%s` topic.", channelID, topicToRemove)
-				log.Printf("Subscription removed: Channel %s, Topic %s", channelID, topicToRemove)
+				id, resolvedName, err := esiClient.ResolveLocationID(context.Background(), kind, name)
+				if err != nil {
+					log.Printf("Error resolving %s '%s': %v", kind, name, err)
+					content = fmt.Sprintf("❌ Could not find a %s named `%s`.", kind, name)
+					break
+				}
+				entry.ID, entry.Name = id, resolvedName
 			}
+
+			sameLocation := func(l LocationSubscription) bool { return l.Kind == entry.Kind && l.ID == entry.ID }
+			mu.RLock()
+			replaced := slices.ContainsFunc(locationSubscriptions[channelID], sameLocation)
+			full := !replaced && len(locationSubscriptions[channelID]) >= maxLocationsPerChannel
+			mu.RUnlock()
+
+			if full {
+				content = fmt.Sprintf("❌ Channel <#%s> already has %d locations, remove one first.", channelID, maxLocationsPerChannel)
+				break
+			}
+			if err := store.SaveLocation(channelID, entry); err != nil {
+				log.Printf("CRITICAL: Failed to save locations: %v", err)
+				content = "❌ Error saving location. Please try again later."
+				break
+			}
+			mu.Lock()
+			if idx := slices.IndexFunc(locationSubscriptions[channelID], sameLocation); idx >= 0 {
+				locationSubscriptions[channelID][idx] = entry
+			} else {
+				locationSubscriptions[channelID] = append(locationSubscriptions[channelID], entry)
+			}
+			mu.Unlock()
+			content = fmt.Sprintf("✅ Subscribed <#%s> to: %s", channelID, describeLocation(entry))
+			if radius > 0 && !esiClient.HasStargateGraph() {
+				content += "\n⚠️ No stargate data is loaded, so only kills in the system itself will match."
+			}
+			recordAudit(i, channelID, "location add", fmt.Sprintf("%s %s (%d, radius %d)", entry.Kind, entry.Name, entry.ID, entry.Radius))
+
+		case "remove":
+			kind := optionMap["kind"].StringValue()
+			name := optionMap["name"].StringValue()
+
+			mu.RLock()
+			idx := slices.IndexFunc(locationSubscriptions[channelID], func(l LocationSubscription) bool {
+				return l.Kind == kind && strings.EqualFold(l.Name, name)
+			})
+			var removed LocationSubscription
+			if idx >= 0 {
+				removed = locationSubscriptions[channelID][idx]
+			}
+			mu.RUnlock()
+
+			if idx < 0 {
+				content = fmt.Sprintf("⚠️ Channel <#%s> is not subscribed to a %s named `%s`.", channelID, kind, name)
+				break
+			}
+			if err := store.RemoveLocation(channelID, removed.Kind, removed.ID); err != nil {
+				log.Printf("CRITICAL: Failed to save locations: %v", err)
+				content = "❌ Error saving location. Please try again later."
+				break
+			}
+			mu.Lock()
+			locationSubscriptions[channelID] = slices.DeleteFunc(locationSubscriptions[channelID], func(l LocationSubscription) bool {
+				return l.Kind == removed.Kind && l.ID == removed.ID
+			})
+			if len(locationSubscriptions[channelID]) == 0 {
+				delete(locationSubscriptions, channelID)
+			}
+			mu.Unlock()
+			content = fmt.Sprintf("✅ Unsubscribed <#%s> from: %s", channelID, describeLocation(removed))
+			recordAudit(i, channelID, "location remove", fmt.Sprintf("%s %s (%d)", removed.Kind, removed.Name, removed.ID))
+
+		case "list":
+			mu.RLock()
+			entries := append([]LocationSubscription(nil), locationSubscriptions[channelID]...)
+			mu.RUnlock()
+
+			if len(entries) == 0 {
+				content = fmt.Sprintf("⚠️ Channel <#%s> has no location subscriptions.", channelID)
+				break
+			}
+			var b strings.Builder
+			b.WriteString(fmt.Sprintf("🗺️ Locations for <#%s>:\n", channelID))
+			for _, entry := range entries {
+				b.WriteString(fmt.Sprintf("• %s\n", describeLocation(entry)))
+			}
+			content = b.String()
+		}
+
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	},
+
+	"feed": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+		})
+
+		// --- Option Parsing ---
+		subcommand := i.ApplicationCommandData().Options[0]
+		optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+		for _, opt := range subcommand.Options {
+			optionMap[opt.Name] = opt
+		}
+
+		channelID, err := resolveFeedChannel(s, i, optionMap, false)
+		if err != nil {
+			content := fmt.Sprintf("❌ Cannot use that channel: %v.", err)
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+		}
+
+		cfg := getChannelConfig(channelID)
+		var content string
+		switch subcommand.Name {
+		case "view":
+			content = describeChannelConfig(channelID, cfg)
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+
+		case "digest":
+			window := defaultDigestWindow
+			if opt, ok := optionMap["window"]; ok {
+				window = time.Duration(opt.IntValue()) * time.Second
+			}
+			if window > 0 && window < minDigestWindow {
+				content = fmt.Sprintf("❌ The digest window must be at least %s.", formatWindow(minDigestWindow))
+				s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+				return
+			}
+			cfg.DigestWindow = window
+			if window > 0 {
+				content = fmt.Sprintf("✅ Busy periods in <#%s> will be batched into one message every %s.", channelID, formatWindow(window))
+			} else {
+				content = fmt.Sprintf("✅ Every kill in <#%s> will be posted on its own.", channelID)
+			}
+
+		case "style":
+			cfg.EmbedStyle = ""
+			if opt, ok := optionMap["style"]; ok {
+				cfg.EmbedStyle = opt.StringValue()
+			}
+			if cfg.EmbedStyle != "" {
+				content = fmt.Sprintf("✅ Killmails in <#%s> will use the `%s` style.", channelID, cfg.EmbedStyle)
+			} else {
+				content = fmt.Sprintf("✅ Killmails in <#%s> will use the server's style.", channelID)
+			}
+
+		case "pods":
+			cfg.PodMode = optionMap["mode"].StringValue()
+			if cfg.PodMode == "show" {
+				cfg.PodMode = podModeShow
+			}
+			content = fmt.Sprintf("✅ Pod kills in <#%s> will be %s.", channelID, podModeDescriptions[cfg.PodMode])
+			if cfg.PodMode == podModeMerge && cfg.DigestWindow > 0 {
+				content += " While the digest is on they are batched like any other kill."
+			}
+
+		case "resume":
+			if cfg.SuspendedReason == "" {
+				content = fmt.Sprintf("⚠️ The feed in <#%s> is not paused.", channelID)
+				s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+				return
+			}
+			cfg.SuspendedReason = ""
+			content = fmt.Sprintf("✅ Killmails will be posted in <#%s> again.", channelID)
+		}
+
+		if err := saveChannelConfig(channelID, cfg); err != nil {
+			log.Printf("CRITICAL: Failed to save channel config for %s: %v", channelID, err)
+			content = "❌ Error saving settings. Please try again later."
 		} else {
-			content = fmt.Sprintf("⚠️ Channel <#%s> was not subscribed to the `%s` topic.", channelID, topicToRemove)
+			recordAudit(i, channelID, "feed "+subcommand.Name, strings.TrimPrefix(content, "✅ "))
+		}
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	},
+
+	"config": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+		})
+
+		if i.GuildID == "" {
+			content := "❌ Settings can only be changed from inside a server."
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+		}
+
+		// --- Option Parsing ---
+		subcommand := i.ApplicationCommandData().Options[0]
+		optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+		for _, opt := range subcommand.Options {
+			optionMap[opt.Name] = opt
+		}
+
+		cfg := getGuildConfig(i.GuildID)
+		var content string
+		switch subcommand.Name {
+		case "view":
+			content = describeGuildConfig(cfg)
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+
+		case "audit":
+			entries, err := store.AuditLog(i.GuildID, 15)
+			if err != nil {
+				log.Printf("Error reading audit log for %s: %v", i.GuildID, err)
+				content = "❌ Error reading the audit log. Please try again later."
+			} else {
+				content = describeAuditLog(entries)
+			}
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+
+		case "default-channel":
+			cfg.DefaultChannelID = ""
+			if _, ok := optionMap["channel"]; ok {
+				channelID, err := resolveFeedChannel(s, i, optionMap, false)
+				if err != nil {
+					content = fmt.Sprintf("❌ Cannot use that channel: %v.", err)
+					s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+					return
+				}
+				cfg.DefaultChannelID = channelID
+				content = fmt.Sprintf("✅ New feeds will go to <#%s> by default.", channelID)
+			} else {
+				content = "✅ New feeds will go to the channel the command is used in."
+			}
+
+		case "admin-channel":
+			cfg.AdminChannelID = ""
+			if _, ok := optionMap["channel"]; ok {
+				channelID, err := resolveFeedChannel(s, i, optionMap, false)
+				if err != nil {
+					content = fmt.Sprintf("❌ Cannot use that channel: %v.", err)
+					s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+					return
+				}
+				cfg.AdminChannelID = channelID
+				content = fmt.Sprintf("✅ Notices about removed or paused feeds will be posted in <#%s>.", channelID)
+			} else {
+				content = "✅ Notices about removed or paused feeds will be sent to the server owner."
+			}
+
+		case "min-value":
+			value, err := parseISK(optionMap["value"].StringValue())
+			if err != nil {
+				content = fmt.Sprintf("❌ %v", err)
+				s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+				return
+			}
+			cfg.MinValue = value
+			if value > 0 {
+				content = fmt.Sprintf("✅ Only kills worth at least %s will be posted.", formatISKHuman(value))
+			} else {
+				content = "✅ Kills of any value will be posted."
+			}
+
+		case "embed-style":
+			cfg.EmbedStyle = optionMap["style"].StringValue()
+			content = fmt.Sprintf("✅ Killmails will use the `%s` style.", cfg.EmbedStyle)
+
+		case "add-role", "remove-role":
+			role := optionMap["role"].RoleValue(nil, i.GuildID)
+			var kept []string
+			for _, roleID := range cfg.ManagerRoles {
+				if roleID != role.ID {
+					kept = append(kept, roleID)
+				}
+			}
+			if subcommand.Name == "add-role" {
+				kept = append(kept, role.ID)
+				content = fmt.Sprintf("✅ <@&%s> can now manage feeds.", role.ID)
+			} else {
+				content = fmt.Sprintf("✅ <@&%s> can no longer manage feeds.", role.ID)
+			}
+			cfg.ManagerRoles = kept
+		}
+
+		if err := saveGuildConfig(i.GuildID, cfg); err != nil {
+			log.Printf("CRITICAL: Failed to save guild config for %s: %v", i.GuildID, err)
+			content = "❌ Error saving settings. Please try again later."
+		} else {
+			recordAudit(i, "", "config "+subcommand.Name, strings.TrimPrefix(content, "✅ "))
+		}
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	},
+
+	"standings": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+		})
+
+		if i.GuildID == "" {
+			content := "❌ Standings can only be set inside a server."
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+		}
+
+		// --- Option Parsing ---
+		subcommand := i.ApplicationCommandData().Options[0]
+		optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+		for _, opt := range subcommand.Options {
+			optionMap[opt.Name] = opt
+		}
+
+		var content string
+		switch subcommand.Name {
+		case "add":
+			entityType := optionMap["type"].StringValue()
+			name := optionMap["name"].StringValue()
+			value := float64(maxStanding)
+			if opt, ok := optionMap["standing"]; ok {
+				value = opt.FloatValue()
+			}
+
+			searchResult, err := esiClient.performSearch(name)
+			if err != nil {
+				log.Printf("Error performing search for '%s': %v", name, err)
+				content = "❌ An error occurred while contacting the search API."
+				break
+			}
+			hit, err := findHitByType(searchResult, entityType)
+			if err != nil {
+				content = fmt.Sprintf("❌ Could not find a %s named `%s`.", entityType, name)
+				break
+			}
+			standing := Standing{EntityType: entityType, EntityID: hit.ID, Name: hit.Name, Value: value}
+
+			sameEntity := func(st Standing) bool {
+				return st.EntityType == standing.EntityType && st.EntityID == standing.EntityID
+			}
+			mu.RLock()
+			full := !slices.ContainsFunc(guildStandings[i.GuildID], sameEntity) && len(guildStandings[i.GuildID]) >= maxStandingsPerGuild
+			mu.RUnlock()
+
+			if full {
+				content = fmt.Sprintf("❌ This server already has %d standings, remove one first.", maxStandingsPerGuild)
+				break
+			}
+			if err := store.SaveStanding(i.GuildID, standing); err != nil {
+				log.Printf("CRITICAL: Failed to save standings: %v", err)
+				content = "❌ Error saving standings. Please try again later."
+				break
+			}
+			mu.Lock()
+			if idx := slices.IndexFunc(guildStandings[i.GuildID], sameEntity); idx >= 0 {
+				guildStandings[i.GuildID][idx] = standing
+			} else {
+				guildStandings[i.GuildID] = append(guildStandings[i.GuildID], standing)
+			}
+			mu.Unlock()
+			content = fmt.Sprintf("✅ Standing set: %s", describeStanding(standing))
+			recordAudit(i, "", "standings add", fmt.Sprintf("%s %s (%d) %+g", standing.EntityType, standing.Name, standing.EntityID, standing.Value))
+
+		case "remove":
+			entityType := optionMap["type"].StringValue()
+			name := optionMap["name"].StringValue()
+
+			mu.RLock()
+			idx := slices.IndexFunc(guildStandings[i.GuildID], func(st Standing) bool {
+				return st.EntityType == entityType && strings.EqualFold(st.Name, name)
+			})
+			var removed Standing
+			if idx >= 0 {
+				removed = guildStandings[i.GuildID][idx]
+			}
+			mu.RUnlock()
+
+			if idx < 0 {
+				content = fmt.Sprintf("⚠️ This server has no standing towards a %s named `%s`.", entityType, name)
+				break
+			}
+			if err := store.RemoveStanding(i.GuildID, removed.EntityType, removed.EntityID); err != nil {
+				log.Printf("CRITICAL: Failed to save standings: %v", err)
+				content = "❌ Error saving standings. Please try again later."
+				break
+			}
+			mu.Lock()
+			guildStandings[i.GuildID] = slices.DeleteFunc(guildStandings[i.GuildID], func(st Standing) bool {
+				return st.EntityType == removed.EntityType && st.EntityID == removed.EntityID
+			})
+			if len(guildStandings[i.GuildID]) == 0 {
+				delete(guildStandings, i.GuildID)
+			}
+			mu.Unlock()
+			content = fmt.Sprintf("✅ Standing removed: %s", describeStanding(removed))
+			recordAudit(i, "", "standings remove", fmt.Sprintf("%s %s (%d)", removed.EntityType, removed.Name, removed.EntityID))
+
+		case "list":
+			mu.RLock()
+			standings := append([]Standing(nil), guildStandings[i.GuildID]...)
+			mu.RUnlock()
+
+			if len(standings) == 0 {
+				content = "⚠️ This server has no standings, so kills are shown without a side. Add your corporation with `/standings add`."
+				break
+			}
+			var b strings.Builder
+			b.WriteString("🤝 **Standings** (positive standings count as friendly):\n")
+			for _, standing := range standings {
+				b.WriteString(fmt.Sprintf("• %s\n", describeStanding(standing)))
+			}
+			content = b.String()
 		}
 
 		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
@@ -247,7 +1122,7 @@ var commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.Interac
 		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 		})
-		status, err := esiClient.getAPIStatus()
+		status, err := esiClient.getAPIStatus(context.Background())
 		if err != nil {
 			log.Printf("Error fetching API status: %v", err)
 			s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
@@ -290,7 +1165,7 @@ var commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.Interac
 			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 		})
 		charName := i.ApplicationCommandData().Options[0].StringValue()
-		charID, err := esiClient.GetCharacterID(charName)
+		charID, err := esiClient.GetCharacterID(context.Background(), charName)
 		if err != nil {
 			errorMessage := fmt.Sprintf("❌ Could not find a character named `%s`.", charName)
 			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
@@ -376,8 +1251,8 @@ var commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.Interac
 		}
 
 		secStatusColor := getSecStatusColor(systemDetails.SecurityStatus)
-		regionName := esiClient.GetRegionName(systemDetails.RegionID)
-		constellationName := esiClient.GetConstellationName(systemDetails.ConstellationID)
+		regionName := esiClient.GetRegionName(context.Background(), systemDetails.RegionID)
+		constellationName := esiClient.GetConstellationName(context.Background(), systemDetails.ConstellationID)
 		finalURL := fmt.Sprintf("https://eve-kill.com/system/%d", systemHit.ID)
 		embed := &discordgo.MessageEmbed{
 			Title: fmt.Sprintf("Intel Report: %s", systemHit.Name),
@@ -501,4 +1376,155 @@ var commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.Interac
 			log.Printf("Failed to send scout followup message: %v", err)
 		}
 	},
+
+	"backfill": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+		})
+
+		optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+		for _, opt := range i.ApplicationCommandData().Options {
+			optionMap[opt.Name] = opt
+		}
+
+		// Only this server's feeds are backfilled.
+		channels := make(map[string]bool)
+		scope := "every feed in this server"
+		if _, ok := optionMap["channel"]; ok {
+			channelID, err := resolveFeedChannel(s, i, optionMap, false)
+			if err != nil {
+				content := fmt.Sprintf("❌ Cannot use that channel: %v.", err)
+				s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+				return
+			}
+			channels[channelID] = true
+			scope = fmt.Sprintf("<#%s>", channelID)
+		} else {
+			mu.RLock()
+			for channelID, guildID := range channelGuilds {
+				if guildID == i.GuildID {
+					channels[channelID] = true
+				}
+			}
+			mu.RUnlock()
+		}
+
+		hours := optionMap["hours"].IntValue()
+		to := time.Now()
+		from := to.Add(-time.Duration(hours) * time.Hour)
+		if err := checkBackfillWindow(from, to, to); err != nil {
+			content := fmt.Sprintf("❌ %v.", err)
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+		}
+		if backfillRunning.Load() {
+			content := "⚠️ A backfill is already running. Please try again in a few minutes."
+			s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+			return
+		}
+
+		content := fmt.Sprintf("⏳ Backfilling the last %d hour(s) for %s. Kills already posted are skipped; this can take a few minutes.", hours, scope)
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+
+		// The interaction can only be edited for 15 minutes, so the run has to finish before then.
+		ctx, cancel := context.WithTimeout(context.Background(), backfillCommandTimeout)
+		defer cancel()
+		result, err := runBackfill(ctx, newEveKillAPI(), deliveries, from, to, channels)
+		if err != nil {
+			log.Printf("Backfill for guild %s stopped early: %v", i.GuildID, err)
+			content = fmt.Sprintf("❌ The backfill stopped early (%v): %s.", err, result)
+		} else {
+			content = fmt.Sprintf("✅ Backfill of the last %d hour(s) for %s finished: %s.", hours, scope, result)
+			recordAudit(i, "", "backfill", strings.TrimPrefix(content, "✅ "))
+		}
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	},
+}
+
+// autocompleteTopic answers the autocomplete request of a /subscribe or /unsubscribe topic option.
+func autocompleteTopic(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var typed string
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Focused {
+			typed = opt.StringValue()
+		}
+	}
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: topicSuggestions(typed)},
+	})
+}
+
+// addSubscriptions subscribes the channel to those of the topics it doesn't have yet, and
+// returns them. All of them are saved before any goes live, so the feed never posts a topic the
+// database doesn't have; when a save fails, the ones already saved are removed again.
+func addSubscriptions(channelID string, topics []string) ([]string, error) {
+	var added []string
+	mu.RLock()
+	for _, topic := range topics {
+		if !subscriptions[channelID][topic] && !slices.Contains(added, topic) {
+			added = append(added, topic)
+		}
+	}
+	mu.RUnlock()
+
+	for n, topic := range added {
+		if err := store.AddSubscription(channelID, topic); err != nil {
+			for _, saved := range added[:n] {
+				if err := store.RemoveSubscription(channelID, saved); err != nil {
+					log.Printf("CRITICAL: Failed to undo the subscription of %s to %s: %v", channelID, saved, err)
+				}
+			}
+			return nil, err
+		}
+	}
+	mu.Lock()
+	if subscriptions[channelID] == nil && len(added) > 0 {
+		subscriptions[channelID] = make(map[string]bool)
+	}
+	for _, topic := range added {
+		subscriptions[channelID][topic] = true
+	}
+	mu.Unlock()
+	return added, nil
+}
+
+// removeSubscription unsubscribes the channel from the topic, saving before the feed stops, and
+// reports whether it was subscribed.
+func removeSubscription(channelID, topic string) (bool, error) {
+	mu.RLock()
+	found := subscriptions[channelID][topic]
+	mu.RUnlock()
+	if !found {
+		return false, nil
+	}
+	if err := store.RemoveSubscription(channelID, topic); err != nil {
+		return false, err
+	}
+	mu.Lock()
+	delete(subscriptions[channelID], topic)
+	if len(subscriptions[channelID]) == 0 {
+		delete(subscriptions, channelID)
+	}
+	mu.Unlock()
+	return true, nil
+}
+
+// clearChannelFilter removes the channel's filter, saving before the matcher drops it, and
+// reports whether it had one.
+func clearChannelFilter(channelID string) (bool, error) {
+	mu.RLock()
+	_, ok := channelFilters[channelID]
+	mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	if err := store.ClearFilter(channelID); err != nil {
+		return false, err
+	}
+	mu.Lock()
+	delete(channelFilters, channelID)
+	mu.Unlock()
+	return true, nil
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// failingStore is the test store with some writes failing: adding the topic failTopic, and every
+// removal when failRemoves is set.
+type failingStore struct {
+	Store
+	failTopic   string
+	failRemoves bool
+}
+
+var errTestStore = errors.New("disk full")
+
+func (f *failingStore) AddSubscription(channelID, topic string) error {
+	if topic == f.failTopic {
+		return errTestStore
+	}
+	return f.Store.AddSubscription(channelID, topic)
+}
+
+func (f *failingStore) RemoveSubscription(channelID, topic string) error {
+	if f.failRemoves {
+		return errTestStore
+	}
+	return f.Store.RemoveSubscription(channelID, topic)
+}
+
+func (f *failingStore) ClearFilter(channelID string) error {
+	if f.failRemoves {
+		return errTestStore
+	}
+	return f.Store.ClearFilter(channelID)
+}
+
+func TestAddSubscriptionsSavesFirst(t *testing.T) {
+	useFeedState(t)
+	subscriptions["c1"] = map[string]bool{"nullsec": true}
+	store.AddSubscription("c1", "nullsec")
+
+	added, err := addSubscriptions("c1", []string{"nullsec", "frigates", "frigates", "highsec"})
+	if err != nil || !slices.Equal(added, []string{"frigates", "highsec"}) || len(subscriptions["c1"]) != 3 {
+		t.Fatalf("addSubscriptions = %v, %v; subscriptions %v", added, err, subscriptions["c1"])
+	}
+
+	// A failed save leaves both the feed and the database as they were.
+	failing := &failingStore{Store: store, failTopic: "wspace"}
+	store = failing
+	if _, err := addSubscriptions("c2", []string{"lowsec", "wspace"}); err == nil {
+		t.Fatal("addSubscriptions succeeded with a failing store")
+	}
+	if subscriptions["c2"] != nil {
+		t.Errorf("live subscriptions after the failure = %v", subscriptions["c2"])
+	}
+	saved, _ := store.Subscriptions()
+	if saved["c2"] != nil {
+		t.Errorf("saved subscriptions after the failure = %v", saved["c2"])
+	}
+
+	failing.failRemoves = true
+	if _, err := removeSubscription("c1", "nullsec"); err == nil || !subscriptions["c1"]["nullsec"] {
+		t.Errorf("removeSubscription with a failing store = %v; the feed has %v", err, subscriptions["c1"])
+	}
+	failing.failRemoves = false
+	if found, err := removeSubscription("c1", "nullsec"); !found || err != nil || subscriptions["c1"]["nullsec"] {
+		t.Errorf("removeSubscription = %v, %v; the feed has %v", found, err, subscriptions["c1"])
+	}
+	if found, _ := removeSubscription("c1", "nullsec"); found {
+		t.Error("removed a topic twice")
+	}
+}
+
+func TestClearChannelFilterSavesFirst(t *testing.T) {
+	useAdminState(t)
+	filter, err := ParseFilter("highsec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	channelFilters["c1"] = filter
+	store.SetFilter("c1", filter.Source)
+
+	failing := &failingStore{Store: store, failRemoves: true}
+	store = failing
+	if _, err := clearChannelFilter("c1"); err == nil || channelFilters["c1"] == nil {
+		t.Errorf("clearChannelFilter with a failing store = %v; the filter is %v", err, channelFilters["c1"])
+	}
+	failing.failRemoves = false
+	if ok, err := clearChannelFilter("c1"); !ok || err != nil || channelFilters["c1"] != nil {
+		t.Errorf("clearChannelFilter = %v, %v", ok, err)
+	}
+	if saved, _ := store.Filters(); len(saved) != 0 {
+		t.Errorf("saved filters = %v", saved)
+	}
+	if ok, _ := clearChannelFilter("c1"); ok {
+		t.Error("cleared a filter twice")
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// webFiles is the dashboard's page, script and the sample killmail used for previews.
+//
+//go:embed web
+var webFiles embed.FS
+
+// Dashboard cookies. The state cookie only lives for one trip through the login page.
+const (
+	dashboardSessionCookie = "firehawk_session"
+	dashboardStateCookie   = "firehawk_oauth_state"
+)
+
+// Dashboard is a web UI under /dashboard/ where guild admins manage their channels' topics and
+// filters and preview how a kill will look. It is served on the health-check port when
+// DISCORD_CLIENT_ID, DISCORD_CLIENT_SECRET and DASHBOARD_URL are set.
+//
+// The page talks to a JSON API under /dashboard/api/. Every change is checked like the slash
+// commands: the user must manage the guild, the channel must belong to it, and the request must
+// carry the session's CSRF token.
+type Dashboard struct {
+	auth          AuthProvider
+	sessions      *dashboardSessions
+	secureCookies bool
+	guildRecheck  time.Duration // dashboardGuildRecheck; tests shorten it.
+
+	// GuildChannels lists a guild's text channels, so feeds can be started in channels that
+	// have none yet. When nil, only channels that already have a feed are shown.
+	GuildChannels func(guildID string) ([]DashboardChannel, error)
+	// InGuild reports whether Firehawk is in a guild. When nil, guilds Firehawk has settings or
+	// feeds for are listed.
+	InGuild func(guildID string) bool
+}
+
+// DashboardChannel is a text channel the dashboard can start a feed in.
+type DashboardChannel struct {
+	ID   string
+	Name string
+}
+
+// dashboardChannel is a channel as the dashboard's page sees it.
+type dashboardChannel struct {
+	channelView
+	Name string `json:"name,omitempty"`
+}
+
+func NewDashboard(auth AuthProvider, secureCookies bool) *Dashboard {
+	return &Dashboard{auth: auth, sessions: newDashboardSessions(), secureCookies: secureCookies, guildRecheck: dashboardGuildRecheck}
+}
+
+// Handler returns the dashboard's routes.
+func (d *Dashboard) Handler() http.Handler {
+	static, _ := fs.Sub(webFiles, "web")
+	mux := http.NewServeMux()
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", http.FileServerFS(static)))
+	mux.HandleFunc("GET /dashboard/login", d.login)
+	mux.HandleFunc("GET /dashboard/callback", d.callback)
+	mux.HandleFunc("POST /dashboard/logout", d.logout)
+	mux.HandleFunc("GET /dashboard/api/me", d.me)
+	mux.HandleFunc("GET /dashboard/api/guilds/{guild}/channels", d.guildAccess(d.listChannels))
+	mux.HandleFunc("PUT /dashboard/api/guilds/{guild}/channels/{channel}/topics/{topic}", d.channelAccess(d.subscribe))
+	mux.HandleFunc("DELETE /dashboard/api/guilds/{guild}/channels/{channel}/topics/{topic}", d.channelAccess(d.unsubscribe))
+	mux.HandleFunc("PUT /dashboard/api/guilds/{guild}/channels/{channel}/filter", d.channelAccess(d.setFilter))
+	mux.HandleFunc("DELETE /dashboard/api/guilds/{guild}/channels/{channel}/filter", d.channelAccess(d.clearFilter))
+	mux.HandleFunc("GET /dashboard/api/guilds/{guild}/channels/{channel}/preview", d.channelAccess(d.preview))
+	return mux
+}
+
+// --- Login ---
+
+func (d *Dashboard) login(w http.ResponseWriter, r *http.Request) {
+	state := randomToken()
+	http.SetCookie(w, d.cookie(dashboardStateCookie, state, 10*time.Minute))
+	http.Redirect(w, r, d.auth.AuthURL(state), http.StatusFound)
+}
+
+func (d *Dashboard) callback(w http.ResponseWriter, r *http.Request) {
+	state, err := r.Cookie(dashboardStateCookie)
+	if err != nil || state.Value == "" || r.URL.Query().Get("state") != state.Value {
+		http.Error(w, "The login expired or came from somewhere else. Please try again.", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, d.cookie(dashboardStateCookie, "", -1))
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "Discord didn't sign you in: "+r.URL.Query().Get("error"), http.StatusBadRequest)
+		return
+	}
+
+	user, err := d.auth.Exchange(r.Context(), code)
+	if err != nil {
+		log.Printf("Dashboard login failed: %v", err)
+		http.Error(w, "Signing in with Discord failed. Please try again.", http.StatusBadGateway)
+		return
+	}
+	id := d.sessions.Create(user, time.Now())
+	http.SetCookie(w, d.cookie(dashboardSessionCookie, id, dashboardSessionTTL))
+	log.Printf("Dashboard login: %s (%s)", user.Name, user.ID)
+	http.Redirect(w, r, "/dashboard/", http.StatusFound)
+}
+
+func (d *Dashboard) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(dashboardSessionCookie); err == nil {
+		if session := d.sessions.Get(cookie.Value, time.Now()); session != nil && session.validCSRF(r.Header.Get("X-CSRF-Token")) {
+			d.sessions.Delete(cookie.Value)
+		}
+	}
+	http.SetCookie(w, d.cookie(dashboardSessionCookie, "", -1))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cookie builds a dashboard cookie; a negative maxAge deletes it.
+func (d *Dashboard) cookie(name, value string, maxAge time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/dashboard/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   d.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// session returns the request's session, or nil when signed out. The user's guilds are fetched
+// again once they are older than guildRecheck; if that fails, the user is signed out, since
+// what they may manage can no longer be told.
+func (d *Dashboard) session(r *http.Request) *dashboardSession {
+	cookie, err := r.Cookie(dashboardSessionCookie)
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	session := d.sessions.Get(cookie.Value, now)
+	if session == nil || now.Sub(session.checked) < d.guildRecheck {
+		return session
+	}
+	guilds, err := d.auth.Guilds(r.Context(), session.user)
+	if err != nil {
+		log.Printf("Dashboard: signing out %s (%s), their servers could not be checked: %v", session.user.Name, session.user.ID, err)
+		d.sessions.Delete(cookie.Value)
+		return nil
+	}
+	return d.sessions.SetGuilds(cookie.Value, guilds, now)
+}
+
+// --- Access checks ---
+
+// guildAccess wraps an API handler so it only runs for a signed-in user who manages the
+// {guild} in the path, with a valid CSRF token on anything but a GET.
+func (d *Dashboard) guildAccess(next func(w http.ResponseWriter, r *http.Request, session *dashboardSession)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := d.session(r)
+		if session == nil {
+			writeAdminError(w, http.StatusUnauthorized, "not signed in")
+			return
+		}
+		if r.Method != http.MethodGet && !session.validCSRF(r.Header.Get("X-CSRF-Token")) {
+			writeAdminError(w, http.StatusForbidden, "missing or invalid CSRF token")
+			return
+		}
+		guildID := r.PathValue("guild")
+		if !slices.ContainsFunc(d.guilds(session.user), func(g DashboardGuild) bool { return g.ID == guildID }) {
+			writeAdminError(w, http.StatusForbidden, "you don't manage that server, or Firehawk isn't in it")
+			return
+		}
+		next(w, r, session)
+	}
+}
+
+// channelAccess is guildAccess that also checks the {channel} in the path is in the guild.
+func (d *Dashboard) channelAccess(next func(w http.ResponseWriter, r *http.Request, session *dashboardSession)) http.HandlerFunc {
+	return d.guildAccess(func(w http.ResponseWriter, r *http.Request, session *dashboardSession) {
+		guildID, channelID := r.PathValue("guild"), r.PathValue("channel")
+		mu.RLock()
+		known, inGuild := channelGuilds[channelID]
+		mu.RUnlock()
+		if inGuild && known != guildID {
+			inGuild = false
+		} else if !inGuild && d.GuildChannels != nil {
+			channels, err := d.GuildChannels(guildID)
+			if err != nil {
+				log.Printf("Failed to list channels of guild %s: %v", guildID, err)
+			}
+			inGuild = slices.ContainsFunc(channels, func(c DashboardChannel) bool { return c.ID == channelID })
+		}
+		if !inGuild {
+			writeAdminError(w, http.StatusNotFound, "no such channel in that server")
+			return
+		}
+		next(w, r, session)
+	})
+}
+
+// guilds returns the user's manageable guilds that Firehawk is in.
+func (d *Dashboard) guilds(user *DashboardUser) []DashboardGuild {
+	mu.RLock()
+	known := make(map[string]bool)
+	for id := range guildConfigs {
+		known[id] = true
+	}
+	for _, id := range channelGuilds {
+		known[id] = true
+	}
+	mu.RUnlock()
+
+	var guilds []DashboardGuild
+	for _, g := range user.Guilds {
+		if known[g.ID] || (d.InGuild != nil && d.InGuild(g.ID)) {
+			guilds = append(guilds, g)
+		}
+	}
+	return guilds
+}
+
+// --- API ---
+
+func (d *Dashboard) me(w http.ResponseWriter, r *http.Request) {
+	session := d.session(r)
+	if session == nil {
+		writeAdminError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+	type topic struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	topics := make([]topic, 0, len(topicChoices))
+	for _, choice := range topicChoices {
+		topics = append(topics, topic{Name: choice.Name, Value: fmt.Sprint(choice.Value)})
+	}
+	guilds := d.guilds(session.user)
+	if guilds == nil {
+		guilds = []DashboardGuild{}
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]any{
+		"id":           session.user.ID,
+		"name":         session.user.Name,
+		"guilds":       guilds,
+		"csrf_token":   session.csrf,
+		"topics":       topics,
+		"embed_styles": []string{embedStyleStandard, embedStyleCompact, embedStyleDetailed},
+	})
+}
+
+func (d *Dashboard) listChannels(w http.ResponseWriter, r *http.Request, session *dashboardSession) {
+	guildID := r.PathValue("guild")
+	var list []dashboardChannel
+	listed := make(map[string]int) // Channel ID -> index in list.
+	for _, view := range channelViews(guildID) {
+		listed[view.ID] = len(list)
+		list = append(list, dashboardChannel{channelView: view})
+	}
+	if d.GuildChannels != nil {
+		channels, err := d.GuildChannels(guildID)
+		if err != nil {
+			log.Printf("Failed to list channels of guild %s: %v", guildID, err)
+		}
+		for _, c := range channels {
+			if i, ok := listed[c.ID]; ok {
+				list[i].Name = c.Name
+				continue
+			}
+			list = append(list, dashboardChannel{channelView: channelView{ID: c.ID, GuildID: guildID, Topics: []string{}}, Name: c.Name})
+		}
+	}
+	if list == nil {
+		list = []dashboardChannel{}
+	}
+	writeAdminJSON(w, http.StatusOK, list)
+}
+
+func (d *Dashboard) subscribe(w http.ResponseWriter, r *http.Request, session *dashboardSession) {
+	guildID, channelID, topic := r.PathValue("guild"), r.PathValue("channel"), r.PathValue("topic")
+	if !isTopicChoice(topic) {
+		writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("unknown topic %q", topic))
+		return
+	}
+	if err := recordChannelGuild(channelID, guildID); err != nil {
+		log.Printf("CRITICAL: Failed to save channel guild: %v", err)
+		writeAdminError(w, http.StatusInternalServerError, "error saving the subscription")
+		return
+	}
+
+	added, err := addSubscriptions(channelID, []string{topic})
+	if err != nil {
+		log.Printf("CRITICAL: Failed to save subscriptions: %v", err)
+		writeAdminError(w, http.StatusInternalServerError, "error saving the subscription")
+		return
+	}
+	if len(added) > 0 {
+		recordDashboardAudit(session.user, guildID, channelID, "subscribe", fmt.Sprintf("`%s`", topic))
+		signalTopicsChanged()
+	}
+	d.writeChannel(w, channelID)
+}
+
+func (d *Dashboard) unsubscribe(w http.ResponseWriter, r *http.Request, session *dashboardSession) {
+	guildID, channelID, topic := r.PathValue("guild"), r.PathValue("channel"), r.PathValue("topic")
+	removed, err := removeSubscription(channelID, topic)
+	if err != nil {
+		log.Printf("CRITICAL: Failed to save subscriptions: %v", err)
+		writeAdminError(w, http.StatusInternalServerError, "error saving the subscription")
+		return
+	}
+	if removed {
+		recordDashboardAudit(session.user, guildID, channelID, "unsubscribe", fmt.Sprintf("`%s`", topic))
+		signalTopicsChanged()
+	}
+	d.writeChannel(w, channelID)
+}
+
+func (d *Dashboard) setFilter(w http.ResponseWriter, r *http.Request, session *dashboardSession) {
+	guildID, channelID := r.PathValue("guild"), r.PathValue("channel")
+	var body struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "the body must be {\"expression\": \"...\"}")
+		return
+	}
+	filter, err := ParseFilter(body.Expression)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("invalid filter: %v", err))
+		return
+	}
+	if err := recordChannelGuild(channelID, guildID); err != nil {
+		log.Printf("CRITICAL: Failed to save channel guild: %v", err)
+		writeAdminError(w, http.StatusInternalServerError, "error saving the filter")
+		return
+	}
+	if err := store.SetFilter(channelID, filter.Source); err != nil {
+		log.Printf("CRITICAL: Failed to save filters: %v", err)
+		writeAdminError(w, http.StatusInternalServerError, "error saving the filter")
+		return
+	}
+	mu.Lock()
+	channelFilters[channelID] = filter
+	mu.Unlock()
+	recordDashboardAudit(session.user, guildID, channelID, "filter set", fmt.Sprintf("`%s`", filter.Source))
+	signalTopicsChanged()
+	d.writeChannel(w, channelID)
+}
+
+func (d *Dashboard) clearFilter(w http.ResponseWriter, r *http.Request, session *dashboardSession) {
+	guildID, channelID := r.PathValue("guild"), r.PathValue("channel")
+	cleared, err := clearChannelFilter(channelID)
+	if err != nil {
+		log.Printf("CRITICAL: Failed to save filters: %v", err)
+		writeAdminError(w, http.StatusInternalServerError, "error saving the filter")
+		return
+	}
+	if cleared {
+		recordDashboardAudit(session.user, guildID, channelID, "filter clear", "")
+		signalTopicsChanged()
+	}
+	d.writeChannel(w, channelID)
+}
+
+// preview renders the sample killmail the way the channel would get it: in its embed style, or
+// ?style= to try another, and framed by the guild's standings. It also says whether the
+// channel's topics, filter, watchlist or locations would pick the sample up.
+func (d *Dashboard) preview(w http.ResponseWriter, r *http.Request, session *dashboardSession) {
+	guildID, channelID := r.PathValue("guild"), r.PathValue("channel")
+	raw, err := webFiles.ReadFile("web/sample-killmail.json")
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, "the sample killmail is missing")
+		return
+	}
+	var sample KillmailData
+	if err := json.Unmarshal(raw, &sample); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, "the sample killmail is invalid")
+		return
+	}
+	topics := generateKillmailTopics(&sample)
+
+	mu.RLock()
+	style := defaultGuildConfig().EmbedStyle
+	if cfg, ok := guildConfigs[guildID]; ok {
+		style = cfg.EmbedStyle
+	}
+	if cfg, ok := channelConfigs[channelID]; ok && cfg.EmbedStyle != "" {
+		style = cfg.EmbedStyle
+	}
+	perspective := killPerspective(guildStandings[guildID], &sample)
+	matches := channelFeedsMatchLocked(channelID, &sample, topics)
+	mu.RUnlock()
+
+	switch requested := r.URL.Query().Get("style"); requested {
+	case "":
+	case embedStyleStandard, embedStyleCompact, embedStyleDetailed:
+		style = requested
+	default:
+		writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("unknown embed style %q", requested))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]any{
+		"style":   style,
+		"topics":  topics,
+		"matches": matches,
+		"embed":   buildKillmailEmbed(&sample, style, perspective),
+	})
+}
+
+// writeChannel answers a change with the channel's feed as it now is.
+func (d *Dashboard) writeChannel(w http.ResponseWriter, channelID string) {
+	mu.RLock()
+	view := channelViewLocked(channelID)
+	mu.RUnlock()
+	writeAdminJSON(w, http.StatusOK, view)
+}
+
+// recordDashboardAudit writes a change made on the dashboard to the audit log, like recordAudit
+// does for slash commands.
+func recordDashboardAudit(user *DashboardUser, guildID, channelID, action, detail string) {
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		GuildID:   guildID,
+		ChannelID: channelID,
+		UserID:    user.ID,
+		UserName:  user.Name,
+		Action:    action,
+		Detail:    strings.TrimSpace(detail + " (dashboard)"),
+	}
+	log.Printf("AUDIT: guild=%s channel=%s user=%s (%s) action=%s %s", entry.GuildID, entry.ChannelID, entry.UserName, entry.UserID, entry.Action, entry.Detail)
+	if err := store.AppendAudit(entry); err != nil {
+		log.Printf("Failed to write audit log entry: %v", err)
+	}
+}
+
+// sessionGuildChannels lists a guild's text channels through the bot's session.
+func sessionGuildChannels(s *discordgo.Session) func(guildID string) ([]DashboardChannel, error) {
+	return func(guildID string) ([]DashboardChannel, error) {
+		channels, err := s.GuildChannels(guildID)
+		if err != nil {
+			return nil, err
+		}
+		var list []DashboardChannel
+		for _, c := range channels {
+			if c.Type == discordgo.ChannelTypeGuildText || c.Type == discordgo.ChannelTypeGuildNews {
+				list = append(list, DashboardChannel{ID: c.ID, Name: c.Name})
+			}
+		}
+		return list, nil
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord's OAuth2 endpoints. DiscordAuth keeps them in fields so tests can point it elsewhere.
+const (
+	discordAuthorizeURL = "https://discord.com/oauth2/authorize"
+	discordAPIURL       = "https://discord.com/api/v10"
+)
+
+// dashboardSessionTTL is how long a dashboard login lasts. A session's guilds are fetched again
+// every dashboardGuildRecheck, so a user who loses Manage Server or leaves a server loses access
+// to it within minutes rather than at the end of the session.
+const (
+	dashboardSessionTTL   = 12 * time.Hour
+	dashboardGuildRecheck = 5 * time.Minute
+)
+
+// DashboardUser is someone signed in to the dashboard, with the guilds they may manage there.
+type DashboardUser struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Guilds      []DashboardGuild `json:"guilds"`
+	AccessToken string           `json:"-"` // The provider's token, for fetching Guilds again.
+}
+
+// DashboardGuild is a guild as the dashboard lists it.
+type DashboardGuild struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// AuthProvider signs dashboard users in. DiscordAuth is the real one; tests plug in a fake.
+type AuthProvider interface {
+	// AuthURL is where the login link sends the browser. The provider must send state back to
+	// the callback untouched.
+	AuthURL(state string) string
+	// Exchange turns the code from the callback into the user and the guilds they manage.
+	Exchange(ctx context.Context, code string) (*DashboardUser, error)
+	// Guilds returns the guilds a signed-in user manages now.
+	Guilds(ctx context.Context, user *DashboardUser) ([]DashboardGuild, error)
+}
+
+// DiscordAuth signs users in with Discord's OAuth2 code flow, asking only for their identity and
+// guild list. A guild is manageable when the user owns it or has Manage Server or Administrator,
+// the same as the server manager commands.
+type DiscordAuth struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // The dashboard's /dashboard/callback, as registered with Discord.
+	AuthorizeURL string
+	APIURL       string
+	Client       *http.Client
+}
+
+func NewDiscordAuth(clientID, clientSecret, redirectURL string) *DiscordAuth {
+	return &DiscordAuth{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthorizeURL: discordAuthorizeURL,
+		APIURL:       discordAPIURL,
+		Client:       &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (d *DiscordAuth) AuthURL(state string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", d.ClientID)
+	query.Set("scope", "identify guilds")
+	query.Set("redirect_uri", d.RedirectURL)
+	query.Set("state", state)
+	query.Set("prompt", "none")
+	return d.AuthorizeURL + "?" + query.Encode()
+}
+
+func (d *DiscordAuth) Exchange(ctx context.Context, code string) (*DashboardUser, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", d.RedirectURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.APIURL+"/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(d.ClientID, d.ClientSecret)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}
+	if err := d.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+
+	var me struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+	}
+	if err := d.get(ctx, token.AccessToken, "/users/@me", &me); err != nil {
+		return nil, fmt.Errorf("failed to read the user: %w", err)
+	}
+	user := &DashboardUser{ID: me.ID, Name: me.GlobalName, AccessToken: token.AccessToken}
+	if user.Name == "" {
+		user.Name = me.Username
+	}
+	if user.Guilds, err = d.Guilds(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (d *DiscordAuth) Guilds(ctx context.Context, user *DashboardUser) ([]DashboardGuild, error) {
+	var guilds []struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		Owner       bool   `json:"owner"`
+		Permissions string `json:"permissions"` // A bitfield, sent as a string.
+	}
+	if err := d.get(ctx, user.AccessToken, "/users/@me/guilds", &guilds); err != nil {
+		return nil, fmt.Errorf("failed to read the user's guilds: %w", err)
+	}
+
+	var manageable []DashboardGuild
+	for _, g := range guilds {
+		perms, _ := strconv.ParseInt(g.Permissions, 10, 64)
+		if g.Owner || perms&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) != 0 {
+			manageable = append(manageable, DashboardGuild{ID: g.ID, Name: g.Name})
+		}
+	}
+	return manageable, nil
+}
+
+func (d *DiscordAuth) get(ctx context.Context, accessToken, path string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.APIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return d.doJSON(req, target)
+}
+
+func (d *DiscordAuth) doJSON(req *http.Request, target any) error {
+	req.Header.Set("User-Agent", "Firehawk Discord Bot")
+	status, err := doJSON(d.Client, req, target)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("Discord returned status %d", status)
+	}
+	return err
+}
+
+// dashboardSession is one signed-in browser.
+type dashboardSession struct {
+	user    *DashboardUser
+	csrf    string // Sent back in X-CSRF-Token on every change.
+	expires time.Time
+	checked time.Time // When the user's guilds were last fetched.
+}
+
+// validCSRF reports whether token is the session's CSRF token, compared in constant time. An
+// empty token never matches.
+func (s *dashboardSession) validCSRF(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.csrf)) == 1
+}
+
+// dashboardSessions keeps sessions in memory, so a restart signs everyone out.
+type dashboardSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*dashboardSession
+}
+
+func newDashboardSessions() *dashboardSessions {
+	return &dashboardSessions{sessions: make(map[string]*dashboardSession)}
+}
+
+// Create starts a session for the user and returns its ID.
+func (s *dashboardSessions) Create(user *DashboardUser, now time.Time) string {
+	id := randomToken()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		if now.After(session.expires) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[id] = &dashboardSession{user: user, csrf: randomToken(), expires: now.Add(dashboardSessionTTL), checked: now}
+	return id
+}
+
+// Get returns a copy of the live session with the ID, or nil. Sessions are only changed by
+// replacing their user, so the copy is safe to read after the lock is released.
+func (s *dashboardSessions) Get(id string, now time.Time) *dashboardSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session := s.sessions[id]
+	if session == nil || now.After(session.expires) {
+		return nil
+	}
+	copied := *session
+	return &copied
+}
+
+// SetGuilds records the guilds the session's user manages as of now, and returns the updated
+// session, or nil if it has ended in the meantime.
+func (s *dashboardSessions) SetGuilds(id string, guilds []DashboardGuild, now time.Time) *dashboardSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session := s.sessions[id]
+	if session == nil {
+		return nil
+	}
+	user := *session.user
+	user.Guilds = guilds
+	session.user, session.checked = &user, now
+	copied := *session
+	return &copied
+}
+
+func (s *dashboardSessions) Delete(id string) {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+}
+
+// randomToken returns 32 random bytes, URL-safe encoded, for session IDs and OAuth2 state.
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
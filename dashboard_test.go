@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAuth signs in whoever the code names, without leaving the test. Guilds reports what the
+// user with the ID manages in users now; a user missing from it has revoked the app.
+type fakeAuth struct {
+	mu    sync.Mutex
+	users map[string]*DashboardUser
+}
+
+func (f *fakeAuth) AuthURL(state string) string {
+	return "/fake-discord?state=" + url.QueryEscape(state)
+}
+
+func (f *fakeAuth) Exchange(ctx context.Context, code string) (*DashboardUser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user := f.users[code]; user != nil {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+func (f *fakeAuth) Guilds(ctx context.Context, user *DashboardUser) ([]DashboardGuild, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.users {
+		if u.ID == user.ID {
+			return slices.Clone(u.Guilds), nil
+		}
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// setGuilds changes what the user behind code manages, or revokes the app with nil.
+func (f *fakeAuth) setGuilds(code string, guilds []DashboardGuild) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if guilds == nil {
+		delete(f.users, code)
+		return
+	}
+	f.users[code].Guilds = guilds
+}
+
+// dashboardBrowser is a cookie-keeping client for a dashboard test server that doesn't follow
+// redirects, so each step of the login can be checked.
+type dashboardBrowser struct {
+	t    *testing.T
+	srv  *httptest.Server
+	http *http.Client
+	csrf string
+}
+
+func newDashboardBrowser(t *testing.T, dash *Dashboard) *dashboardBrowser {
+	t.Helper()
+	srv := httptest.NewServer(dash.Handler())
+	t.Cleanup(srv.Close)
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return &dashboardBrowser{t: t, srv: srv, http: client}
+}
+
+// do sends a request, with the CSRF token once signed in, and decodes a JSON reply into target
+// when given.
+func (b *dashboardBrowser) do(method, path, body string, target any) *http.Response {
+	b.t.Helper()
+	req, _ := http.NewRequest(method, b.srv.URL+path, strings.NewReader(body))
+	if b.csrf != "" {
+		req.Header.Set("X-CSRF-Token", b.csrf)
+	}
+	resp, err := b.http.Do(req)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if target != nil {
+		if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+			b.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// login goes through the login page and callback as the user behind code.
+func (b *dashboardBrowser) login(code string) {
+	b.t.Helper()
+	resp := b.do(http.MethodGet, "/dashboard/login", "", nil)
+	target, _ := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || target.Path != "/fake-discord" {
+		b.t.Fatalf("login: got %d to %s", resp.StatusCode, target)
+	}
+	state := target.Query().Get("state")
+	resp = b.do(http.MethodGet, "/dashboard/callback?code="+code+"&state="+url.QueryEscape(state), "", nil)
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/dashboard/" {
+		b.t.Fatalf("callback: got %d to %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	var me struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	b.do(http.MethodGet, "/dashboard/api/me", "", &me)
+	b.csrf = me.CSRFToken
+}
+
+func testDashboard() *Dashboard {
+	return NewDashboard(&fakeAuth{users: map[string]*DashboardUser{
+		"admin": {ID: "u1", Name: "Admin", Guilds: []DashboardGuild{{ID: "g1", Name: "Guild One"}, {ID: "g3", Name: "Not Firehawk's"}}},
+	}}, false)
+}
+
+func TestDashboardLogin(t *testing.T) {
+	useAdminState(t)
+	guildConfigs["g1"] = defaultGuildConfig()
+	b := newDashboardBrowser(t, testDashboard())
+
+	if resp := b.do(http.MethodGet, "/dashboard/api/me", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("me before login: got %d, want 401", resp.StatusCode)
+	}
+	if resp := b.do(http.MethodGet, "/dashboard/", "", nil); resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("page: got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// A callback whose state doesn't match the cookie set by the login page is refused.
+	b.do(http.MethodGet, "/dashboard/login", "", nil)
+	if resp := b.do(http.MethodGet, "/dashboard/callback?code=admin&state=forged", "", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("forged state: got %d, want 400", resp.StatusCode)
+	}
+	if resp := b.do(http.MethodGet, "/dashboard/api/me", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("me after a forged callback: got %d, want 401", resp.StatusCode)
+	}
+
+	b.login("admin")
+	var me struct {
+		ID     string
+		Guilds []DashboardGuild
+		Topics []struct{ Name, Value string }
+	}
+	if resp := b.do(http.MethodGet, "/dashboard/api/me", "", &me); resp.StatusCode != http.StatusOK {
+		t.Fatalf("me: got %d", resp.StatusCode)
+	}
+	// g3 is manageable, but Firehawk isn't in it.
+	if me.ID != "u1" || len(me.Guilds) != 1 || me.Guilds[0].ID != "g1" || len(me.Topics) == 0 || b.csrf == "" {
+		t.Errorf("me = %+v", me)
+	}
+
+	b.csrf = ""
+	if resp := b.do(http.MethodPost, "/dashboard/logout", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("logout: got %d", resp.StatusCode)
+	}
+	if resp := b.do(http.MethodGet, "/dashboard/api/me", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("me after logout: got %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestDashboardManagesChannels(t *testing.T) {
+	useAdminState(t)
+	channelGuilds["c1"] = "g1"
+	channelGuilds["other"] = "g2"
+	subscriptions["c1"] = map[string]bool{"nullsec": true}
+	dash := testDashboard()
+	dash.GuildChannels = func(guildID string) ([]DashboardChannel, error) {
+		return []DashboardChannel{{ID: "c1", Name: "kills"}, {ID: "c2", Name: "general"}}, nil
+	}
+	b := newDashboardBrowser(t, dash)
+	b.login("admin")
+
+	var channels []dashboardChannel
+	b.do(http.MethodGet, "/dashboard/api/guilds/g1/channels", "", &channels)
+	if len(channels) != 2 || channels[0].ID != "c1" || channels[0].Name != "kills" || !slices.Equal(channels[0].Topics, []string{"nullsec"}) || channels[1].ID != "c2" {
+		t.Fatalf("channels = %+v", channels)
+	}
+
+	// c2 has no feed yet, but it's one of the guild's channels, so one can be started there.
+	var view channelView
+	if resp := b.do(http.MethodPut, "/dashboard/api/guilds/g1/channels/c2/topics/frigates", "", &view); resp.StatusCode != http.StatusOK {
+		t.Fatalf("subscribe: got %d", resp.StatusCode)
+	}
+	if !slices.Equal(view.Topics, []string{"frigates"}) || channelGuilds["c2"] != "g1" {
+		t.Errorf("after subscribing c2 = %+v", view)
+	}
+	b.do(http.MethodDelete, "/dashboard/api/guilds/g1/channels/c1/topics/nullsec", "", &view)
+	if len(view.Topics) != 0 || subscriptions["c1"] != nil {
+		t.Errorf("after unsubscribing c1 = %+v", view)
+	}
+	saved, err := store.Subscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(saved["c2"], []string{"frigates"}) {
+		t.Errorf("saved subscriptions = %v", saved)
+	}
+	audit, _ := store.AuditLog("g1", 10)
+	if len(audit) != 2 || audit[0].UserID != "u1" || !strings.HasSuffix(audit[0].Detail, "(dashboard)") {
+		t.Errorf("audit = %+v", audit)
+	}
+
+	b.do(http.MethodPut, "/dashboard/api/guilds/g1/channels/c1/filter", `{"expression":"highsec AND value >= 100m"}`, &view)
+	if view.Filter != "highsec AND value >= 100m" || channelFilters["c1"] == nil {
+		t.Errorf("after setting the filter c1 = %+v", view)
+	}
+	if resp := b.do(http.MethodPut, "/dashboard/api/guilds/g1/channels/c1/filter", `{"expression":"value >="}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid filter: got %d, want 400", resp.StatusCode)
+	}
+	view = channelView{}
+	b.do(http.MethodDelete, "/dashboard/api/guilds/g1/channels/c1/filter", "", &view)
+	if filters, _ := store.Filters(); view.Filter != "" || len(filters) != 0 {
+		t.Errorf("after clearing the filter c1 = %+v, saved %v", view, filters)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPut, "/dashboard/api/guilds/g1/channels/c1/topics/nope", http.StatusBadRequest},
+		{http.MethodPut, "/dashboard/api/guilds/g1/channels/other/topics/frigates", http.StatusNotFound},  // g2's channel.
+		{http.MethodPut, "/dashboard/api/guilds/g1/channels/c9/topics/frigates", http.StatusNotFound},     // In no guild.
+		{http.MethodPut, "/dashboard/api/guilds/g2/channels/other/topics/frigates", http.StatusForbidden}, // Not managed.
+		{http.MethodGet, "/dashboard/api/guilds/g3/channels", http.StatusForbidden},                       // Firehawk isn't there.
+	} {
+		if resp := b.do(tc.method, tc.path, "", nil); resp.StatusCode != tc.want {
+			t.Errorf("%s %s: got %d, want %d", tc.method, tc.path, resp.StatusCode, tc.want)
+		}
+	}
+
+	b.csrf = ""
+	if resp := b.do(http.MethodPut, "/dashboard/api/guilds/g1/channels/c1/topics/frigates", "", nil); resp.StatusCode != http.StatusForbidden || subscriptions["c1"] != nil {
+		t.Errorf("change without the CSRF token: got %d, want 403 and no change", resp.StatusCode)
+	}
+}
+
+func TestDashboardSavesBeforeApplying(t *testing.T) {
+	useAdminState(t)
+	channelGuilds["c1"] = "g1"
+	subscriptions["c1"] = map[string]bool{"nullsec": true}
+	filter, _ := ParseFilter("highsec")
+	channelFilters["c1"] = filter
+	b := newDashboardBrowser(t, testDashboard())
+	b.login("admin")
+	store = &failingStore{Store: store, failTopic: "frigates", failRemoves: true}
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodPut, "/dashboard/api/guilds/g1/channels/c1/topics/frigates"},
+		{http.MethodDelete, "/dashboard/api/guilds/g1/channels/c1/topics/nullsec"},
+		{http.MethodDelete, "/dashboard/api/guilds/g1/channels/c1/filter"},
+	} {
+		if resp := b.do(tc.method, tc.path, "", nil); resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("%s %s: got %d, want 500", tc.method, tc.path, resp.StatusCode)
+		}
+	}
+	// The feed goes on as it was saved.
+	if len(subscriptions["c1"]) != 1 || !subscriptions["c1"]["nullsec"] || channelFilters["c1"] == nil {
+		t.Errorf("after failed saves c1 has %v and filter %v", subscriptions["c1"], channelFilters["c1"])
+	}
+}
+
+func TestDashboardRechecksGuilds(t *testing.T) {
+	useAdminState(t)
+	channelGuilds["c1"] = "g1"
+	auth := &fakeAuth{users: map[string]*DashboardUser{
+		"admin": {ID: "u1", Name: "Admin", Guilds: []DashboardGuild{{ID: "g1", Name: "Guild One"}}},
+	}}
+	dash := NewDashboard(auth, false)
+	b := newDashboardBrowser(t, dash)
+	b.login("admin")
+	const path = "/dashboard/api/guilds/g1/channels/c1/topics/frigates"
+
+	// Within the recheck interval the guilds from the login stand.
+	auth.setGuilds("admin", []DashboardGuild{})
+	if resp := b.do(http.MethodPut, path, "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("before the recheck: got %d, want 200", resp.StatusCode)
+	}
+
+	// Once it's due, losing Manage Server loses the guild.
+	dash.guildRecheck = 0
+	if resp := b.do(http.MethodDelete, path, "", nil); resp.StatusCode != http.StatusForbidden || !subscriptions["c1"]["frigates"] {
+		t.Errorf("after losing the guild: got %d, want 403 and no change", resp.StatusCode)
+	}
+	auth.setGuilds("admin", []DashboardGuild{{ID: "g1", Name: "Guild One"}})
+	if resp := b.do(http.MethodDelete, path, "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("after getting it back: got %d, want 200", resp.StatusCode)
+	}
+
+	// A user who can't be checked, here because they revoked the app, is signed out.
+	auth.setGuilds("admin", nil)
+	if resp := b.do(http.MethodGet, "/dashboard/api/me", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("me after revoking: got %d, want 401", resp.StatusCode)
+	}
+	// Authorizing again doesn't bring the old session back.
+	auth.mu.Lock()
+	auth.users["admin"] = &DashboardUser{ID: "u1", Name: "Admin", Guilds: []DashboardGuild{{ID: "g1", Name: "Guild One"}}}
+	auth.mu.Unlock()
+	if resp := b.do(http.MethodGet, "/dashboard/api/me", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("me after being signed out: got %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestDashboardPreview(t *testing.T) {
+	useAdminState(t)
+	channelGuilds["c1"] = "g1"
+	guildConfigs["g1"] = &GuildConfig{EmbedStyle: embedStyleCompact}
+	subscriptions["c1"] = map[string]bool{"highsec": true}
+	b := newDashboardBrowser(t, testDashboard())
+	b.login("admin")
+
+	var preview struct {
+		Style   string
+		Topics  []string
+		Matches bool
+		Embed   struct{ Title string }
+	}
+	if resp := b.do(http.MethodGet, "/dashboard/api/guilds/g1/channels/c1/preview", "", &preview); resp.StatusCode != http.StatusOK {
+		t.Fatalf("preview: got %d", resp.StatusCode)
+	}
+	if preview.Style != embedStyleCompact || !preview.Matches || !strings.Contains(preview.Embed.Title, "Hurricane") {
+		t.Errorf("preview = %+v", preview)
+	}
+
+	b.do(http.MethodGet, "/dashboard/api/guilds/g1/channels/c1/preview?style="+embedStyleDetailed, "", &preview)
+	if preview.Style != embedStyleDetailed {
+		t.Errorf("style override: got %s", preview.Style)
+	}
+	if resp := b.do(http.MethodGet, "/dashboard/api/guilds/g1/channels/c1/preview?style=fancy", "", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown style: got %d, want 400", resp.StatusCode)
+	}
+
+	// Watchlists and locations feed a channel too, as they do on the live feed.
+	channelGuilds["watch"], channelGuilds["region"], channelGuilds["none"] = "g1", "g1", "g1"
+	watchlists["watch"] = []WatchEntry{{EntityType: "character", EntityID: 90000001, Name: "Victim"}}
+	locationSubscriptions["region"] = []LocationSubscription{{Kind: "region", ID: 10000002, Name: "The Forge"}}
+	for channelID, want := range map[string]bool{"watch": true, "region": true, "none": false} {
+		preview.Matches = !want
+		b.do(http.MethodGet, "/dashboard/api/guilds/g1/channels/"+channelID+"/preview", "", &preview)
+		if preview.Matches != want {
+			t.Errorf("%s: matches = %v, want %v", channelID, preview.Matches, want)
+		}
+	}
+}
+
+func TestDiscordAuthExchange(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "secret" || r.FormValue("code") != "good" || r.FormValue("redirect_uri") != "https://firehawk.example/dashboard/callback" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"access_token":"token","token_type":"Bearer"}`)
+	})
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token" {
+				http.Error(w, "{}", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("GET /users/@me", authorized(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id":"u1","username":"pilot","global_name":"Pilot One"}`)
+	}))
+	mux.HandleFunc("GET /users/@me/guilds", authorized(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[
+			{"id":"owned","name":"Owned","owner":true,"permissions":"0"},
+			{"id":"admin","name":"Admin","permissions":"8"},
+			{"id":"manager","name":"Manager","permissions":"32"},
+			{"id":"member","name":"Member","permissions":"1024"}
+		]`)
+	}))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	auth := NewDiscordAuth("client", "secret", "https://firehawk.example/dashboard/callback")
+	auth.APIURL = srv.URL
+
+	link, _ := url.Parse(auth.AuthURL("xyz"))
+	if q := link.Query(); q.Get("client_id") != "client" || q.Get("state") != "xyz" || q.Get("scope") != "identify guilds" || q.Get("redirect_uri") != auth.RedirectURL {
+		t.Errorf("AuthURL = %s", link)
+	}
+
+	user, err := auth.Exchange(context.Background(), "good")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var guilds []string
+	for _, g := range user.Guilds {
+		guilds = append(guilds, g.ID)
+	}
+	if user.ID != "u1" || user.Name != "Pilot One" || !slices.Equal(guilds, []string{"owned", "admin", "manager"}) {
+		t.Errorf("user = %+v", user)
+	}
+
+	// The token is kept, so the guilds can be checked again during the session.
+	recheck, err := auth.Guilds(context.Background(), user)
+	if err != nil || len(recheck) != 3 {
+		t.Errorf("Guilds = %+v, %v", recheck, err)
+	}
+	if _, err := auth.Guilds(context.Background(), &DashboardUser{ID: "u1", AccessToken: "revoked"}); err == nil {
+		t.Error("a revoked token should fail the guild check")
+	}
+
+	if _, err := auth.Exchange(context.Background(), "bad"); err == nil {
+		t.Error("a rejected code should fail the exchange")
+	}
+}
+
+func TestDashboardSessionValidCSRF(t *testing.T) {
+	session := &dashboardSession{csrf: "token"}
+	for token, want := range map[string]bool{"token": true, "": false, "toke": false, "token2": false} {
+		if got := session.validCSRF(token); got != want {
+			t.Errorf("validCSRF(%q) = %v, want %v", token, got, want)
+		}
+	}
+	// A session without a token, which Create never makes, still refuses an empty header.
+	if (&dashboardSession{}).validCSRF("") {
+		t.Error("an empty token matched an empty session token")
+	}
+}
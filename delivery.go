@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Delivery tuning. Discord allows roughly 5 messages per 5 seconds per channel and 50 requests
+// per second globally; discordgo waits out per-route buckets, and the global limiter keeps us
+// well under the global cap during big fights.
+const (
+	deliveryIntakeSize      = 1000
+	deliveryChannelQueue    = 100
+	deliveryGlobalPerSecond = 40
+	deliveryMaxAttempts     = 5
+	deliveryBaseBackoff     = 2 * time.Second
+	deliveryMaxBackoff      = time.Minute
+	deliveryWorkerIdle      = 5 * time.Minute
+	deadLetterHistory       = 50
+)
+
+// errNothingToAmend is returned by send for an edit-only job whose message was never posted or
+// has since been deleted.
+var errNothingToAmend = errors.New("nothing to amend")
+
+// messageSender is the part of *discordgo.Session the delivery queue needs, so it can be faked.
+type messageSender interface {
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+// deliveryJob is a single message bound for a single channel.
+type deliveryJob struct {
+	ChannelID  string
+	KillmailID int
+	Topics     []string // The topics of every kill in the message, for the delivered metric.
+	Message    *discordgo.MessageSend
+
+	// Amend, when set, turns the job into an edit of an earlier message in the same channel.
+	// It is called at delivery time, after everything queued before the job has gone out, and
+	// returns the message and its new embeds; ok is false when there is nothing to edit, in
+	// which case Message is posted instead. A job without a Message is then dropped.
+	Amend func() (messageID string, embeds []*discordgo.MessageEmbed, ok bool)
+	// OnSent is called with the ID of the posted message.
+	OnSent func(messageID string)
+
+	attempts int
+}
+
+// DeadLetter records a message we gave up on, for operators to inspect.
+type DeadLetter struct {
+	Time       time.Time `json:"time"`
+	ChannelID  string    `json:"channel_id"`
+	KillmailID int       `json:"killmail_id"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error"`
+}
+
+// DeliveryStats is the snapshot exposed on /debug/vars.
+type DeliveryStats struct {
+	IntakeDepth    int   `json:"intake_depth"`
+	ChannelDepth   int   `json:"channel_depth"`
+	ActiveChannels int   `json:"active_channels"`
+	Enqueued       int64 `json:"enqueued"`
+	Delivered      int64 `json:"delivered"`
+	Retried        int64 `json:"retried"`
+	Dropped        int64 `json:"dropped"`
+	DeadLettered   int64 `json:"dead_lettered"`
+}
+
+// DeliveryQueue fans killmail messages out to Discord: a bounded intake queue feeds one worker
+// per channel, so a slow or rate-limited channel never holds up the others.
+type DeliveryQueue struct {
+	sender  messageSender
+	intake  chan *deliveryJob
+	limiter *time.Ticker
+	sleep   func(time.Duration) // Waits out a retry backoff; tests replace it.
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	closeMu sync.RWMutex // Guards closed, so Enqueue never sends on a closed intake.
+	closed  bool
+
+	// OnDelivered and OnPermanentFailure let the channel janitor spot dead channels.
+	// Set them before anything is enqueued.
+	OnDelivered        func(channelID string)
+	OnPermanentFailure func(channelID string, err error)
+
+	mu          sync.Mutex
+	workers     map[string]chan *deliveryJob
+	deadLetters []DeadLetter
+
+	enqueued, delivered, retried, dropped, deadLettered atomic.Int64
+}
+
+// deliveries is the process-wide queue, created in main() once the Discord session exists.
+var deliveries *DeliveryQueue
+
+// NewDeliveryQueue creates the queue and starts its dispatcher.
+func NewDeliveryQueue(sender messageSender) *DeliveryQueue {
+	q := &DeliveryQueue{
+		sender:  sender,
+		intake:  make(chan *deliveryJob, deliveryIntakeSize),
+		limiter: time.NewTicker(time.Second / deliveryGlobalPerSecond),
+		sleep:   time.Sleep,
+		done:    make(chan struct{}),
+		workers: make(map[string]chan *deliveryJob),
+	}
+	go q.dispatch()
+	return q
+}
+
+// publishDeliveryStats exposes queue depth and counters on the /debug/vars endpoint.
+func publishDeliveryStats(q *DeliveryQueue) {
+	expvar.Publish("delivery", expvar.Func(func() any { return q.Stats() }))
+}
+
+// Enqueue hands a message to the queue without blocking. If the queue is full the message is
+// dropped, because stalling the WebSocket reader would lose far more than one post.
+func (q *DeliveryQueue) Enqueue(job *deliveryJob) bool {
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.intake <- job:
+		q.enqueued.Add(1)
+		return true
+	default:
+		q.dropped.Add(1)
+		log.Printf("Delivery queue full, dropping killmail %d for channel %s", job.KillmailID, job.ChannelID)
+		return false
+	}
+}
+
+// Close stops accepting work and waits up to timeout for queued messages to go out.
+func (q *DeliveryQueue) Close(timeout time.Duration) {
+	q.closeMu.Lock()
+	q.closed = true
+	close(q.intake)
+	q.closeMu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		<-q.done
+		q.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(timeout):
+		log.Printf("Delivery queue did not drain within %s, %d messages left.", timeout, q.Stats().ChannelDepth)
+	}
+	q.limiter.Stop()
+}
+
+// Stats returns a point-in-time view of the queue.
+func (q *DeliveryQueue) Stats() DeliveryStats {
+	q.mu.Lock()
+	depth := 0
+	for _, ch := range q.workers {
+		depth += len(ch)
+	}
+	active := len(q.workers)
+	q.mu.Unlock()
+
+	return DeliveryStats{
+		IntakeDepth:    len(q.intake),
+		ChannelDepth:   depth,
+		ActiveChannels: active,
+		Enqueued:       q.enqueued.Load(),
+		Delivered:      q.delivered.Load(),
+		Retried:        q.retried.Load(),
+		Dropped:        q.dropped.Load(),
+		DeadLettered:   q.deadLettered.Load(),
+	}
+}
+
+// DeadLetters returns the most recent messages that could not be delivered.
+func (q *DeliveryQueue) DeadLetters() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeadLetter(nil), q.deadLetters...)
+}
+
+// dispatch routes jobs from the intake queue to per-channel workers.
+func (q *DeliveryQueue) dispatch() {
+	defer close(q.done)
+	for job := range q.intake {
+		q.mu.Lock()
+		ch, ok := q.workers[job.ChannelID]
+		if !ok {
+			ch = make(chan *deliveryJob, deliveryChannelQueue)
+			q.workers[job.ChannelID] = ch
+			q.wg.Add(1)
+			go q.work(job.ChannelID, ch)
+		}
+		select {
+		case ch <- job:
+		default:
+			q.dropped.Add(1)
+			log.Printf("Channel %s has %d queued messages, dropping killmail %d", job.ChannelID, deliveryChannelQueue, job.KillmailID)
+		}
+		q.mu.Unlock()
+	}
+
+	// Intake closed: let every worker finish what it has and exit.
+	q.mu.Lock()
+	for channelID, ch := range q.workers {
+		close(ch)
+		delete(q.workers, channelID)
+	}
+	q.mu.Unlock()
+}
+
+// work sends one channel's messages in order, and exits after a quiet period.
+func (q *DeliveryQueue) work(channelID string, ch chan *deliveryJob) {
+	defer q.wg.Done()
+	idle := time.NewTimer(deliveryWorkerIdle)
+	defer idle.Stop()
+
+	for {
+		select {
+		case job, ok := <-ch:
+			if !ok {
+				return
+			}
+			q.deliver(job)
+			idle.Reset(deliveryWorkerIdle)
+		case <-idle.C:
+			q.mu.Lock()
+			if len(ch) == 0 && q.workers[channelID] == ch {
+				delete(q.workers, channelID)
+				q.mu.Unlock()
+				return
+			}
+			q.mu.Unlock()
+			idle.Reset(deliveryWorkerIdle)
+		}
+	}
+}
+
+// deliver sends a job, retrying transient failures with exponential backoff.
+func (q *DeliveryQueue) deliver(job *deliveryJob) {
+	for {
+		<-q.limiter.C
+		job.attempts++
+		msg, err := q.send(job)
+		if errors.Is(err, errNothingToAmend) {
+			return
+		}
+		if err == nil {
+			q.delivered.Add(1)
+			for _, topic := range job.Topics {
+				killmailsDelivered.WithLabelValues(topic).Inc()
+			}
+			if job.OnSent != nil {
+				job.OnSent(msg.ID)
+			}
+			if q.OnDelivered != nil {
+				q.OnDelivered(job.ChannelID)
+			}
+			return
+		}
+		countDiscordFailure(err)
+		if job.Amend != nil && discordErrorCode(err) == discordgo.ErrCodeUnknownMessage {
+			// Someone deleted the message we meant to edit; post this one on its own.
+			job.Amend = nil
+			job.attempts--
+			continue
+		}
+
+		permanent, retryAfter := classifyDeliveryError(err)
+		if permanent || job.attempts >= deliveryMaxAttempts {
+			q.deadLetter(job, err)
+			if permanent && q.OnPermanentFailure != nil {
+				q.OnPermanentFailure(job.ChannelID, err)
+			}
+			return
+		}
+
+		backoff := deliveryBaseBackoff << (job.attempts - 1)
+		if backoff > deliveryMaxBackoff {
+			backoff = deliveryMaxBackoff
+		}
+		if retryAfter > backoff {
+			backoff = retryAfter
+		}
+		q.retried.Add(1)
+		log.Printf("Failed to send killmail %d to channel %s (attempt %d), retrying in %s: %v", job.KillmailID, job.ChannelID, job.attempts, backoff, err)
+		q.sleep(backoff)
+	}
+}
+
+// send posts the job's message, or edits the message it amends.
+func (q *DeliveryQueue) send(job *deliveryJob) (*discordgo.Message, error) {
+	if job.Amend != nil {
+		if messageID, embeds, ok := job.Amend(); ok {
+			return q.sender.ChannelMessageEditComplex(&discordgo.MessageEdit{ID: messageID, Channel: job.ChannelID, Embeds: &embeds})
+		}
+	}
+	if job.Message == nil {
+		return nil, errNothingToAmend
+	}
+	return q.sender.ChannelMessageSendComplex(job.ChannelID, job.Message)
+}
+
+func (q *DeliveryQueue) deadLetter(job *deliveryJob, err error) {
+	q.deadLettered.Add(1)
+	log.Printf("DEAD-LETTER: killmail %d to channel %s failed after %d attempt(s): %v", job.KillmailID, job.ChannelID, job.attempts, err)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.deadLetters = append(q.deadLetters, DeadLetter{
+		Time:       time.Now().UTC(),
+		ChannelID:  job.ChannelID,
+		KillmailID: job.KillmailID,
+		Attempts:   job.attempts,
+		Error:      err.Error(),
+	})
+	if len(q.deadLetters) > deadLetterHistory {
+		q.deadLetters = q.deadLetters[len(q.deadLetters)-deadLetterHistory:]
+	}
+}
+
+// classifyDeliveryError decides whether a send failure is worth retrying. Deleted channels and
+// missing permissions will never succeed; rate limits, server errors and network blips might.
+func classifyDeliveryError(err error) (permanent bool, retryAfter time.Duration) {
+	var rateLimited *discordgo.RateLimitError
+	if errors.As(err, &rateLimited) {
+		return false, rateLimited.RetryAfter
+	}
+
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) {
+		return false, 0 // Network errors and timeouts.
+	}
+	switch discordErrorCode(err) {
+	case discordgo.ErrCodeUnknownChannel, discordgo.ErrCodeUnknownGuild,
+		discordgo.ErrCodeMissingAccess, discordgo.ErrCodeMissingPermissions:
+		return true, 0
+	}
+	if restErr.Response != nil {
+		status := restErr.Response.StatusCode
+		if status == http.StatusTooManyRequests || status >= 500 {
+			return false, 0
+		}
+		return status >= 400, 0
+	}
+	return false, 0
+}
+
+// discordErrorCode returns Discord's JSON error code from a REST error, or 0.
+func discordErrorCode(err error) int {
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Message != nil {
+		return restErr.Message.Code
+	}
+	return 0
+}
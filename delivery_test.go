@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// scriptedSender is a messageSender whose failures are chosen by the test. It records the
+// killmail ID, kept in each message's Content, and the message itself of every successful post
+// in every channel, and every successful edit.
+type scriptedSender struct {
+	fail     func(channelID string, attempt int) error // attempt counts every send to the channel.
+	editFail func(m *discordgo.MessageEdit) error      // Edits fail unless it is set.
+
+	mu       sync.Mutex
+	attempts map[string]int
+	posted   map[string][]int
+	messages map[string][]*discordgo.MessageSend
+	edits    map[string][]*discordgo.MessageEdit
+}
+
+func newScriptedSender(fail func(channelID string, attempt int) error) *scriptedSender {
+	return &scriptedSender{
+		fail:     fail,
+		attempts: make(map[string]int),
+		posted:   make(map[string][]int),
+		messages: make(map[string][]*discordgo.MessageSend),
+		edits:    make(map[string][]*discordgo.MessageEdit),
+	}
+}
+
+func (s *scriptedSender) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts[channelID]++
+	if s.fail != nil {
+		if err := s.fail(channelID, s.attempts[channelID]); err != nil {
+			return nil, err
+		}
+	}
+	id, _ := strconv.Atoi(data.Content)
+	s.posted[channelID] = append(s.posted[channelID], id)
+	s.messages[channelID] = append(s.messages[channelID], data)
+	return &discordgo.Message{ID: fmt.Sprintf("m%d", id), ChannelID: channelID}, nil
+}
+
+func (s *scriptedSender) ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if s.editFail == nil {
+		return nil, errors.New("not expected")
+	}
+	if err := s.editFail(m); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.edits[m.Channel] = append(s.edits[m.Channel], m)
+	return &discordgo.Message{ID: m.ID, ChannelID: m.Channel}, nil
+}
+
+func (s *scriptedSender) edited(channelID string) []*discordgo.MessageEdit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.edits[channelID])
+}
+
+func (s *scriptedSender) sent(channelID string) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.posted[channelID])
+}
+
+// testDeliveryQueue returns a queue that records its backoffs instead of sleeping.
+func testDeliveryQueue(sender messageSender) (*DeliveryQueue, func() []time.Duration) {
+	q := NewDeliveryQueue(sender)
+	var mu sync.Mutex
+	var waits []time.Duration
+	q.sleep = func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		waits = append(waits, d)
+	}
+	return q, func() []time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(waits)
+	}
+}
+
+func testJob(channelID string, killmailID int) *deliveryJob {
+	return &deliveryJob{ChannelID: channelID, KillmailID: killmailID, Message: &discordgo.MessageSend{Content: strconv.Itoa(killmailID)}}
+}
+
+func restError(status, code int) error {
+	err := &discordgo.RESTError{Response: &http.Response{StatusCode: status}}
+	if code != 0 {
+		err.Message = &discordgo.APIErrorMessage{Code: code}
+	}
+	return err
+}
+
+func TestDeliveryQueueKeepsChannelOrderAndDrainsOnClose(t *testing.T) {
+	// The slow channel fails its first sends, which must not hold up the others or reorder it.
+	sender := newScriptedSender(func(channelID string, attempt int) error {
+		if channelID == "slow" && attempt <= 2 {
+			return restError(http.StatusBadGateway, 0)
+		}
+		return nil
+	})
+	q, _ := testDeliveryQueue(sender)
+	channels := []string{"slow", "c2", "c3"}
+	var want []int
+	for i := 1; i <= 10; i++ {
+		want = append(want, i)
+		for _, channelID := range channels {
+			if !q.Enqueue(testJob(channelID, i)) {
+				t.Fatalf("Enqueue %s %d refused", channelID, i)
+			}
+		}
+	}
+
+	// Close waits for everything already queued.
+	q.Close(5 * time.Second)
+	for _, channelID := range channels {
+		if got := sender.sent(channelID); !slices.Equal(got, want) {
+			t.Errorf("%s got %v, want %v", channelID, got, want)
+		}
+	}
+	stats := q.Stats()
+	if stats.Enqueued != 30 || stats.Delivered != 30 || stats.Retried != 2 || stats.ChannelDepth != 0 || stats.ActiveChannels != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if q.Enqueue(testJob("c2", 11)) {
+		t.Error("Enqueue accepted a job after Close")
+	}
+}
+
+func TestDeliveryQueueBacksOff(t *testing.T) {
+	sender := newScriptedSender(func(channelID string, attempt int) error {
+		switch attempt {
+		case 1, 2, 3:
+			return restError(http.StatusInternalServerError, 0)
+		case 4:
+			// Discord's retry_after wins when it is longer than our own backoff.
+			return &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{TooManyRequests: &discordgo.TooManyRequests{RetryAfter: 90 * time.Second}}}
+		}
+		return nil
+	})
+	q, waits := testDeliveryQueue(sender)
+	q.Enqueue(testJob("c1", 1))
+	q.Close(5 * time.Second)
+
+	want := []time.Duration{deliveryBaseBackoff, 2 * deliveryBaseBackoff, 4 * deliveryBaseBackoff, 90 * time.Second}
+	if got := waits(); !slices.Equal(got, want) {
+		t.Errorf("waits = %v, want %v", got, want)
+	}
+	if got := sender.sent("c1"); !slices.Equal(got, []int{1}) {
+		t.Errorf("sent %v", got)
+	}
+	if letters := q.DeadLetters(); len(letters) != 0 {
+		t.Errorf("dead letters = %+v", letters)
+	}
+}
+
+func TestDeliveryQueueDeadLetters(t *testing.T) {
+	sender := newScriptedSender(func(channelID string, attempt int) error {
+		if channelID == "gone" {
+			return restError(http.StatusNotFound, discordgo.ErrCodeUnknownChannel)
+		}
+		return errors.New("connection reset")
+	})
+	q, waits := testDeliveryQueue(sender)
+	var mu sync.Mutex
+	var permanent []string
+	q.OnPermanentFailure = func(channelID string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		permanent = append(permanent, channelID)
+	}
+	q.Enqueue(testJob("flaky", 1))
+	q.Enqueue(testJob("gone", 2))
+	q.Close(5 * time.Second)
+
+	letters := q.DeadLetters()
+	slices.SortFunc(letters, func(a, b DeadLetter) int { return a.KillmailID - b.KillmailID })
+	if len(letters) != 2 {
+		t.Fatalf("dead letters = %+v", letters)
+	}
+	// A transient failure is tried deliveryMaxAttempts times, a permanent one only once.
+	if l := letters[0]; l.ChannelID != "flaky" || l.Attempts != deliveryMaxAttempts || l.Error != "connection reset" {
+		t.Errorf("flaky dead letter = %+v", l)
+	}
+	if l := letters[1]; l.ChannelID != "gone" || l.Attempts != 1 {
+		t.Errorf("gone dead letter = %+v", l)
+	}
+	if got := waits(); len(got) != deliveryMaxAttempts-1 || got[len(got)-1] != deliveryBaseBackoff<<(deliveryMaxAttempts-2) {
+		t.Errorf("waits = %v", got)
+	}
+	// Only the permanent failure is reported to the janitor.
+	if !slices.Equal(permanent, []string{"gone"}) {
+		t.Errorf("permanent failures = %v", permanent)
+	}
+	if stats := q.Stats(); stats.DeadLettered != 2 || stats.Delivered != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestClassifyDeliveryError(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		err        error
+		permanent  bool
+		retryAfter time.Duration
+	}{
+		{"network", errors.New("i/o timeout"), false, 0},
+		{"rate limited", &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{TooManyRequests: &discordgo.TooManyRequests{RetryAfter: 3 * time.Second}}}, false, 3 * time.Second},
+		{"unknown channel", restError(http.StatusNotFound, discordgo.ErrCodeUnknownChannel), true, 0},
+		{"unknown guild", restError(http.StatusNotFound, discordgo.ErrCodeUnknownGuild), true, 0},
+		{"missing access", restError(http.StatusForbidden, discordgo.ErrCodeMissingAccess), true, 0},
+		{"missing permissions", restError(http.StatusForbidden, discordgo.ErrCodeMissingPermissions), true, 0},
+		{"bad request", restError(http.StatusBadRequest, 50035), true, 0},
+		{"429", restError(http.StatusTooManyRequests, 0), false, 0},
+		{"server error", restError(http.StatusBadGateway, 0), false, 0},
+		{"no response", &discordgo.RESTError{}, false, 0},
+		{"wrapped", fmt.Errorf("posting: %w", restError(http.StatusForbidden, discordgo.ErrCodeMissingAccess)), true, 0},
+	} {
+		permanent, retryAfter := classifyDeliveryError(tc.err)
+		if permanent != tc.permanent || retryAfter != tc.retryAfter {
+			t.Errorf("%s: got %v, %s, want %v, %s", tc.name, permanent, retryAfter, tc.permanent, tc.retryAfter)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord allows 10 embeds per message, 4096 characters in an embed description and 6000
+// characters across all the embeds of a message.
+const (
+	maxDigestEmbeds      = 10
+	maxDigestDescription = 4000
+	maxDigestEmbedsTotal = 6000
+)
+
+// digestItem is a kill waiting in a digest, with the embed already built for its channel.
+type digestItem struct {
+	data   *KillmailData
+	embed  *discordgo.MessageEmbed
+	topics []string
+}
+
+// digestBucket is the open window of a single channel.
+type digestBucket struct {
+	window time.Duration
+	items  []digestItem
+	timer  *time.Timer
+}
+
+// Digester batches kills for channels with digest mode on. The first kill in a quiet channel
+// is posted straight away and opens a window; kills arriving before it closes are posted
+// together when it does. A window that closes empty ends the burst, so a quiet channel goes
+// back to individual posts.
+type Digester struct {
+	queue   *DeliveryQueue
+	mu      sync.Mutex
+	buckets map[string]*digestBucket
+}
+
+// digester is the process-wide digest batcher, created in main() alongside the delivery queue.
+var digester *Digester
+
+// NewDigester creates a digester that hands finished digests to the delivery queue.
+func NewDigester(q *DeliveryQueue) *Digester {
+	return &Digester{queue: q, buckets: make(map[string]*digestBucket)}
+}
+
+// Add routes a kill for a channel in digest mode.
+func (d *Digester) Add(channelID string, window time.Duration, data *KillmailData, embed *discordgo.MessageEmbed, topics []string) {
+	d.mu.Lock()
+	if b, open := d.buckets[channelID]; open {
+		b.items = append(b.items, digestItem{data: data, embed: embed, topics: topics})
+		d.mu.Unlock()
+		return
+	}
+	b := &digestBucket{window: window}
+	b.timer = time.AfterFunc(window, func() { d.flush(channelID) })
+	d.buckets[channelID] = b
+	d.mu.Unlock()
+
+	d.queue.Enqueue(&deliveryJob{
+		ChannelID:  channelID,
+		KillmailID: data.Killmail.KillmailID,
+		Topics:     topics,
+		Message:    &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}},
+	})
+}
+
+// flush posts whatever the channel collected during its window and opens the next one,
+// or closes the window if nothing arrived.
+func (d *Digester) flush(channelID string) {
+	d.mu.Lock()
+	b, ok := d.buckets[channelID]
+	if !ok {
+		d.mu.Unlock()
+		return
+	}
+	items := b.items
+	b.items = nil
+	if len(items) == 0 {
+		delete(d.buckets, channelID)
+	} else {
+		b.timer.Reset(b.window)
+	}
+	d.mu.Unlock()
+
+	if len(items) > 0 {
+		d.queue.Enqueue(buildDigestJob(channelID, items, b.window))
+	}
+}
+
+// FlushAll posts every pending digest immediately, for shutdown.
+func (d *Digester) FlushAll() {
+	d.mu.Lock()
+	buckets := d.buckets
+	d.buckets = make(map[string]*digestBucket)
+	d.mu.Unlock()
+
+	for channelID, b := range buckets {
+		b.timer.Stop()
+		if len(b.items) > 0 {
+			d.queue.Enqueue(buildDigestJob(channelID, b.items, b.window))
+		}
+	}
+}
+
+// buildDigestJob turns a window's worth of kills into one message: the embeds themselves when
+// they fit, otherwise a compact table sorted by value.
+func buildDigestJob(channelID string, items []digestItem, window time.Duration) *deliveryJob {
+	job := &deliveryJob{ChannelID: channelID, KillmailID: items[0].data.Killmail.KillmailID}
+	for _, item := range items {
+		job.Topics = append(job.Topics, item.topics...)
+	}
+
+	if len(items) == 1 {
+		job.Message = &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{items[0].embed}}
+		return job
+	}
+
+	heading := fmt.Sprintf("💥 %d kills in the last %s", len(items), formatWindow(window))
+	if len(items) <= maxDigestEmbeds {
+		embeds := make([]*discordgo.MessageEmbed, len(items))
+		total := 0
+		for idx, item := range items {
+			embeds[idx] = item.embed
+			total += embedLength(item.embed)
+		}
+		if total <= maxDigestEmbedsTotal {
+			job.Message = &discordgo.MessageSend{Content: "**" + heading + "**", Embeds: embeds}
+			return job
+		}
+	}
+
+	job.Message = &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{buildDigestTable(heading, items)}}
+	return job
+}
+
+// buildDigestTable lists many kills in a single embed, one line each, most valuable first.
+func buildDigestTable(heading string, items []digestItem) *discordgo.MessageEmbed {
+	sorted := append([]digestItem(nil), items...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].data.Killmail.TotalValue > sorted[b].data.Killmail.TotalValue
+	})
+
+	var b strings.Builder
+	var total float64
+	for _, item := range sorted {
+		total += item.data.Killmail.TotalValue
+	}
+	for idx, item := range sorted {
+		km := item.data.Killmail
+		line := fmt.Sprintf("`%7s` [%s](https://eve-kill.com/kill/%d) · %s · %s\n",
+			formatISKHuman(km.TotalValue), km.Victim.ShipName.En, km.KillmailID, km.SystemName, km.Victim.CharacterName)
+		if b.Len()+len(line) > maxDigestDescription {
+			b.WriteString(fmt.Sprintf("…and %d more", len(sorted)-idx))
+			break
+		}
+		b.WriteString(line)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       heading,
+		Color:       0xBF2A2A,
+		Description: b.String(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%s destroyed · Powered by Firehawk", formatISKHuman(total))},
+	}
+}
+
+// embedLength counts the characters of an embed the way Discord does for its per-message limit.
+func embedLength(e *discordgo.MessageEmbed) int {
+	n := utf8.RuneCountInString(e.Title) + utf8.RuneCountInString(e.Description)
+	for _, f := range e.Fields {
+		n += utf8.RuneCountInString(f.Name) + utf8.RuneCountInString(f.Value)
+	}
+	if e.Footer != nil {
+		n += utf8.RuneCountInString(e.Footer.Text)
+	}
+	if e.Author != nil {
+		n += utf8.RuneCountInString(e.Author.Name)
+	}
+	return n
+}
+
+// formatWindow prints a digest window the way users typed it, e.g. "60s" or "5m".
+func formatWindow(window time.Duration) string {
+	if window >= time.Minute && window%time.Minute == 0 {
+		return fmt.Sprintf("%dm", int(window/time.Minute))
+	}
+	return fmt.Sprintf("%ds", int(window/time.Second))
+}
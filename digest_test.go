@@ -0,0 +1,109 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func digestKill(id int, value float64) (*KillmailData, *discordgo.MessageEmbed) {
+	data := &KillmailData{Killmail: Killmail{KillmailID: id, TotalValue: value, SystemName: "Jita", Victim: KillmailVictim{CharacterName: "Pilot", ShipName: LocalizedName{En: "Rifter"}}}}
+	return data, &discordgo.MessageEmbed{Title: "Kill " + formatISKHuman(value)}
+}
+
+func (s *scriptedSender) sentMessages(channelID string) []*discordgo.MessageSend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.messages[channelID])
+}
+
+func TestDigesterBatchesABurst(t *testing.T) {
+	sender := newScriptedSender(nil)
+	q, _ := testDeliveryQueue(sender)
+	d := NewDigester(q)
+	add := func(id int) {
+		data, embed := digestKill(id, float64(id)*1e6)
+		// The window is long enough never to fire, so the test closes it with flush.
+		d.Add("c1", time.Hour, data, embed, []string{"all"})
+	}
+
+	add(1) // Opens the window and goes out on its own.
+	add(2)
+	add(3)
+	d.flush("c1") // Posts 2 and 3 together and opens the next window.
+	d.flush("c1") // A quiet window closes the burst...
+	add(4)        // ...so the next kill is posted straight away again.
+	add(5)
+	d.FlushAll()
+	q.Close(5 * time.Second)
+
+	messages := sender.sentMessages("c1")
+	if len(messages) != 4 {
+		t.Fatalf("sent %d messages, want 4", len(messages))
+	}
+	if len(messages[0].Embeds) != 1 || messages[0].Content != "" {
+		t.Errorf("first message = %+v", messages[0])
+	}
+	if got := messages[1]; got.Content != "**💥 2 kills in the last 60m**" || len(got.Embeds) != 2 {
+		t.Errorf("digest = %q with %d embeds", got.Content, len(got.Embeds))
+	}
+	// FlushAll sends a lone pending kill as it is.
+	if got := messages[3]; got.Content != "" || len(got.Embeds) != 1 || got.Embeds[0].Title != "Kill "+formatISKHuman(5e6) {
+		t.Errorf("flushed = %q with %+v", got.Content, got.Embeds)
+	}
+	if len(d.buckets) != 0 {
+		t.Errorf("buckets left open: %v", d.buckets)
+	}
+}
+
+func TestBuildDigestJob(t *testing.T) {
+	items := func(n int, description string) []digestItem {
+		var out []digestItem
+		for i := 1; i <= n; i++ {
+			data, embed := digestKill(i, float64(i)*1e9)
+			embed.Description = description
+			out = append(out, digestItem{data: data, embed: embed, topics: []string{"all"}})
+		}
+		return out
+	}
+
+	job := buildDigestJob("c1", items(3, "short"), time.Minute)
+	if len(job.Message.Embeds) != 3 || job.KillmailID != 1 || len(job.Topics) != 3 {
+		t.Errorf("3 kills: %d embeds, killmail %d, topics %v", len(job.Message.Embeds), job.KillmailID, job.Topics)
+	}
+
+	// Too many embeds, or too many characters across them, fall back to the table.
+	for name, batch := range map[string][]digestItem{
+		"11 kills":            items(maxDigestEmbeds+1, "short"),
+		"3 long descriptions": items(3, strings.Repeat("x", 2500)),
+	} {
+		job := buildDigestJob("c1", batch, time.Minute)
+		if len(job.Message.Embeds) != 1 || job.Message.Embeds[0].Title != "💥 "+strings.Fields(name)[0]+" kills in the last 1m" {
+			t.Errorf("%s: embeds = %+v", name, job.Message.Embeds)
+			continue
+		}
+		// Most valuable first.
+		if desc := job.Message.Embeds[0].Description; !strings.HasPrefix(desc, "`"+formatISKHuman(float64(len(batch))*1e9)) {
+			t.Errorf("%s: table starts %q", name, desc[:min(len(desc), 40)])
+		}
+	}
+}
+
+func TestBuildDigestTableTruncates(t *testing.T) {
+	var items []digestItem
+	for i := 1; i <= 200; i++ {
+		data, embed := digestKill(i, 1e6)
+		data.Killmail.Victim.CharacterName = strings.Repeat("n", 30)
+		items = append(items, digestItem{data: data, embed: embed})
+	}
+	table := buildDigestTable("heading", items)
+	if len(table.Description) > maxDigestDescription+len("…and 200 more") || !strings.Contains(table.Description, " more") {
+		t.Errorf("description is %d bytes and ends %q", len(table.Description), table.Description[len(table.Description)-20:])
+	}
+	if embedLength(table) > maxDigestEmbedsTotal {
+		t.Errorf("table is %d characters", embedLength(table))
+	}
+}
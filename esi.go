@@ -1,14 +1,15 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,10 +20,14 @@ type (
 		Name string `json:"name"`
 	}
 	ESIIDResponse struct {
-		Characters []struct {
-			ID   int    `json:"id"`
-			Name string `json:"name"`
-		} `json:"characters"`
+		Characters     []ESIIDHit `json:"characters"`
+		Constellations []ESIIDHit `json:"constellations"`
+		Regions        []ESIIDHit `json:"regions"`
+		Systems        []ESIIDHit `json:"systems"`
+	}
+	ESIIDHit struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
 	}
 	ESISystemInfo struct {
 		Name            string  `json:"name"`
@@ -32,6 +37,17 @@ type (
 		SystemID        int     `json:"system_id"`
 		ConstellationID int     `json:"constellation_id"`
 		RegionID        int     `json:"region_id"`
+		// AdjacentSystems lists the destination system of every stargate, forming the jump graph.
+		AdjacentSystems []int `json:"adjacent_systems,omitempty"`
+	}
+	ESINameHit struct {
+		ID       int    `json:"id"`
+		Name     string `json:"name"`
+		Category string `json:"category"`
+	}
+	ESITypeInfo struct {
+		Name    string `json:"name"`
+		GroupID int    `json:"group_id"`
 	}
 	ESIRegionInfo struct {
 		Name        string `json:"name"`
@@ -39,86 +55,86 @@ type (
 		RegionID    int    `json:"region_id"`
 	}
 	ESIClient struct {
-		httpClient *http.Client
+		httpClient *http.Client   // For the eve-kill search, which isn't ESI.
+		esiHTTP    *ESIHTTPClient // Every ESI call goes through this one.
 		baseURL    string
 		userAgent  string
 
 		cacheMutex         sync.RWMutex
 		characterNames     map[int]string
 		corporationNames   map[int]string
-		shipNames          map[int]string
+		allianceNames      map[int]string
+		shipNames          map[int]string // Names of every inventory type: ships, modules, charges.
+		shipGroupIDs       map[int]int
 		systemNames        map[int]string
 		characterIDs       map[string]int
 		systemInfoCache    map[int]*ESISystemInfo
 		searchResults      map[string]SearchResponse
 		regionNames        map[int]string
 		constellationNames map[int]string
+		stargateGraph      map[int][]int
+		jumpRangeCache     map[[2]int]map[int]bool
 	}
 )
 
 // --- Constructor ---
 func NewESIClient(contactInfo string) *ESIClient {
-	return &ESIClient{
-		httpClient: &http.Client{
-			Timeout:   15 * time.Second,
-			Transport: &http.Transport{DisableCompression: false},
-		},
+	httpClient := &http.Client{
+		Timeout:   15 * time.Second,
+		Transport: &http.Transport{DisableCompression: false},
+	}
+	userAgent := fmt.Sprintf("Firehawk Discord Bot (%s)", contactInfo)
+	c := &ESIClient{
+		httpClient:         httpClient,
+		esiHTTP:            NewESIHTTPClient(httpClient, userAgent),
 		baseURL:            "https://esi.evetech.net/latest",
-		userAgent:          fmt.Sprintf("Firehawk Discord Bot (%s)", contactInfo),
+		userAgent:          userAgent,
 		characterNames:     map[int]string{},
 		corporationNames:   map[int]string{},
+		allianceNames:      map[int]string{},
 		shipNames:          map[int]string{},
+		shipGroupIDs:       map[int]int{},
 		systemNames:        map[int]string{},
 		characterIDs:       map[string]int{},
 		systemInfoCache:    map[int]*ESISystemInfo{},
 		searchResults:      map[string]SearchResponse{},
 		regionNames:        map[int]string{},
 		constellationNames: map[int]string{},
+		stargateGraph:      map[int][]int{},
+		jumpRangeCache:     map[[2]int]map[int]bool{},
 	}
+	c.esiHTTP.endpoint = func(url string) string { return esiEndpoint(c.baseURL, url) }
+	return c
 }
 
 // --- Core HTTP ---
-func (c *ESIClient) makeRequest(method, url string, body io.Reader, target interface{}) error {
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("User-Agent", c.userAgent)
-	if method == http.MethodPost {
-		req.Header.Set("Content-Type", "application/json")
-	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ESI returned %s", resp.Status)
-	}
-	return json.NewDecoder(resp.Body).Decode(target)
+// makeRequest calls ESI and decodes the response into target. Caching, the error limit and
+// retries are handled by esiHTTP; a pause for the error limit ends early with ctx.
+func (c *ESIClient) makeRequest(ctx context.Context, method, url string, body []byte, target interface{}) error {
+	return c.esiHTTP.Do(ctx, method, url, body, target)
 }
 
 // --- Character ID <-> Name ---
-func (c *ESIClient) GetCharacterID(name string) (int, error) {
+func (c *ESIClient) GetCharacterID(ctx context.Context, name string) (int, error) {
 	c.cacheMutex.RLock()
-	if id, ok := c.characterIDs[name]; ok {
-		c.cacheMutex.RUnlock()
+	id, ok := c.characterIDs[name]
+	c.cacheMutex.RUnlock()
+	countCacheLookup("characterIDs", ok)
+	if ok {
 		return id, nil
 	}
-	c.cacheMutex.RUnlock()
 
 	var idData ESIIDResponse
 	body, _ := json.Marshal([]string{name})
-	if err := c.makeRequest(http.MethodPost, c.baseURL+"/universe/ids/", bytes.NewBuffer(body), &idData); err != nil {
+	if err := c.makeRequest(ctx, http.MethodPost, c.baseURL+"/universe/ids/", body, &idData); err != nil {
 		return 0, err
 	}
 	if len(idData.Characters) == 0 {
 		return 0, fmt.Errorf("character not found: %s", name)
 	}
 
-	id := idData.Characters[0].ID
+	id = idData.Characters[0].ID
 	c.cacheMutex.Lock()
 	c.characterIDs[name] = id
 	c.cacheMutex.Unlock()
@@ -126,20 +142,22 @@ func (c *ESIClient) GetCharacterID(name string) (int, error) {
 }
 
 // --- Generic ID -> Name ---
-func (c *ESIClient) getName(id int, category string, cache map[int]string) string {
+// cacheName labels the cache in metrics.
+func (c *ESIClient) getName(ctx context.Context, id int, category, cacheName string, cache map[int]string) string {
 	if id == 0 {
 		return "Unknown"
 	}
 	c.cacheMutex.RLock()
-	if name, ok := cache[id]; ok {
-		c.cacheMutex.RUnlock()
+	name, ok := cache[id]
+	c.cacheMutex.RUnlock()
+	countCacheLookup(cacheName, ok)
+	if ok {
 		return name
 	}
-	c.cacheMutex.RUnlock()
 
 	var resp ESINameResponse
 	url := fmt.Sprintf("%s/%s/%d/", c.baseURL, category, id)
-	if err := c.makeRequest(http.MethodGet, url, nil, &resp); err != nil {
+	if err := c.makeRequest(ctx, http.MethodGet, url, nil, &resp); err != nil {
 		log.Printf("Failed to get name for ID %d (%s): %v", id, category, err)
 		return "Unknown"
 	}
@@ -151,40 +169,138 @@ func (c *ESIClient) getName(id int, category string, cache map[int]string) strin
 }
 
 // --- Public Name Helpers ---
-func (c *ESIClient) GetCharacterName(id int) string {
-	return c.getName(id, "characters", c.characterNames)
+func (c *ESIClient) GetCharacterName(ctx context.Context, id int) string {
+	return c.getName(ctx, id, "characters", "characterNames", c.characterNames)
+}
+func (c *ESIClient) GetCorporationName(ctx context.Context, id int) string {
+	return c.getName(ctx, id, "corporations", "corporationNames", c.corporationNames)
+}
+func (c *ESIClient) GetShipName(ctx context.Context, id int) string {
+	return c.getName(ctx, id, "universe/types", "shipNames", c.shipNames)
 }
-func (c *ESIClient) GetCorporationName(id int) string {
-	return c.getName(id, "corporations", c.corporationNames)
+func (c *ESIClient) GetAllianceName(ctx context.Context, id int) string {
+	return c.getName(ctx, id, "alliances", "allianceNames", c.allianceNames)
 }
-func (c *ESIClient) GetShipName(id int) string { return c.getName(id, "universe/types", c.shipNames) }
-func (c *ESIClient) GetConstellationName(id int) string {
-	return c.getName(id, "universe/constellations", c.constellationNames)
+
+// GetShipGroupID returns the inventory group of a ship type, which generateKillmailTopics needs
+// for sources that only carry type IDs. The type's name is cached on the way.
+func (c *ESIClient) GetShipGroupID(ctx context.Context, typeID int) int {
+	if typeID == 0 {
+		return 0
+	}
+	c.cacheMutex.RLock()
+	groupID, ok := c.shipGroupIDs[typeID]
+	c.cacheMutex.RUnlock()
+	countCacheLookup("shipGroupIDs", ok)
+	if ok {
+		return groupID
+	}
+
+	var info ESITypeInfo
+	url := fmt.Sprintf("%s/universe/types/%d/", c.baseURL, typeID)
+	if err := c.makeRequest(ctx, http.MethodGet, url, nil, &info); err != nil {
+		log.Printf("Failed to get group for type %d: %v", typeID, err)
+		return 0
+	}
+
+	c.cacheMutex.Lock()
+	c.shipGroupIDs[typeID] = info.GroupID
+	c.shipNames[typeID] = info.Name
+	c.cacheMutex.Unlock()
+	return info.GroupID
+}
+
+// ResolveNames fills the name caches for a batch of character, corporation, alliance and type
+// IDs with a single POST to /universe/names/, instead of one request per ID.
+func (c *ESIClient) ResolveNames(ctx context.Context, ids []int) {
+	c.cacheMutex.RLock()
+	var missing []int
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		_, isChar := c.characterNames[id]
+		_, isCorp := c.corporationNames[id]
+		_, isAlliance := c.allianceNames[id]
+		_, isType := c.shipNames[id]
+		if !isChar && !isCorp && !isAlliance && !isType {
+			missing = append(missing, id)
+		}
+	}
+	c.cacheMutex.RUnlock()
+	// The batch checks all four name caches at once, so it is counted on its own.
+	esiCacheLookups.WithLabelValues("names", "hit").Add(float64(len(seen) - len(missing)))
+	esiCacheLookups.WithLabelValues("names", "miss").Add(float64(len(missing)))
+
+	// ESI accepts up to 1000 IDs per call.
+	for start := 0; start < len(missing); start += 1000 {
+		end := min(start+1000, len(missing))
+		body, _ := json.Marshal(missing[start:end])
+		var hits []ESINameHit
+		if err := c.makeRequest(ctx, http.MethodPost, c.baseURL+"/universe/names/", body, &hits); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Failed to resolve %d names: %v", end-start, err)
+			continue
+		}
+
+		c.cacheMutex.Lock()
+		for _, hit := range hits {
+			switch hit.Category {
+			case "character":
+				c.characterNames[hit.ID] = hit.Name
+			case "corporation":
+				c.corporationNames[hit.ID] = hit.Name
+			case "alliance":
+				c.allianceNames[hit.ID] = hit.Name
+			case "inventory_type":
+				c.shipNames[hit.ID] = hit.Name
+			}
+		}
+		c.cacheMutex.Unlock()
+	}
+}
+
+// cachedName returns a name already in cache, or "" without calling ESI.
+func (c *ESIClient) cachedName(id int, cache map[int]string) string {
+	c.cacheMutex.RLock()
+	defer c.cacheMutex.RUnlock()
+	return cache[id]
+}
+
+func (c *ESIClient) GetConstellationName(ctx context.Context, id int) string {
+	return c.getName(ctx, id, "universe/constellations", "constellationNames", c.constellationNames)
 }
 
 func (c *ESIClient) GetSystemName(id int) string {
 	c.cacheMutex.RLock()
 	defer c.cacheMutex.RUnlock()
-	if sys, ok := c.systemInfoCache[id]; ok {
+	sys, ok := c.systemInfoCache[id]
+	countCacheLookup("systemInfoCache", ok)
+	if ok {
 		return sys.Name
 	}
 	return "Unknown"
 }
 
-func (c *ESIClient) GetRegionName(id int) string {
+func (c *ESIClient) GetRegionName(ctx context.Context, id int) string {
 	if id == 0 {
 		return "Unknown"
 	}
 	c.cacheMutex.RLock()
-	if name, ok := c.regionNames[id]; ok {
-		c.cacheMutex.RUnlock()
+	name, ok := c.regionNames[id]
+	c.cacheMutex.RUnlock()
+	countCacheLookup("regionNames", ok)
+	if ok {
 		return name
 	}
-	c.cacheMutex.RUnlock()
 
 	var region ESIRegionInfo
 	url := fmt.Sprintf("%s/universe/regions/%d/", c.baseURL, id)
-	if err := c.makeRequest(http.MethodGet, url, nil, &region); err != nil {
+	if err := c.makeRequest(ctx, http.MethodGet, url, nil, &region); err != nil {
 		log.Printf("Failed to get region name for ID %d: %v", id, err)
 		return "Unknown"
 	}
@@ -196,31 +312,273 @@ func (c *ESIClient) GetRegionName(id int) string {
 }
 
 // --- System Cache ---
+
+// LoadSystemCache loads the static universe data written by `firehawk gen-sde`. Region and
+// constellation names come from the same file, so lookups for them never need ESI. The older
+// flat map of systems is still accepted.
 func (c *ESIClient) LoadSystemCache(filename string) error {
-	f, err := os.Open(filename)
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		return fmt.Errorf("failed to open cache file: %w", err)
 	}
-	defer f.Close()
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("failed to unmarshal system cache: %w", err)
+	}
+
+	var universe staticUniverse
+	if isLegacySystemCache(raw) {
+		err = json.Unmarshal(data, &universe.Systems)
+	} else {
+		err = json.Unmarshal(data, &universe)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal system cache: %w", err)
+	}
 
 	c.cacheMutex.Lock()
 	defer c.cacheMutex.Unlock()
-	if err := json.NewDecoder(f).Decode(&c.systemInfoCache); err != nil {
-		return fmt.Errorf("failed to unmarshal system cache: %w", err)
+	c.systemInfoCache = universe.Systems
+	if c.systemInfoCache == nil {
+		c.systemInfoCache = map[int]*ESISystemInfo{}
+	}
+	for id, region := range universe.Regions {
+		c.regionNames[id] = region.Name
+	}
+	for id, constellation := range universe.Constellations {
+		c.constellationNames[id] = constellation.Name
+	}
+	if universe.Regions == nil {
+		log.Printf("WARNING: %s is a flat system list from before gen-sde: regions resolve through ESI, kills from zKillboard have no region, and there is no stargate graph. Regenerate it with `firehawk gen-sde`.", filename)
 	}
-	log.Printf("Loaded %d systems from cache.", len(c.systemInfoCache))
+	log.Printf("Loaded %d systems, %d constellations and %d regions from cache.",
+		len(c.systemInfoCache), len(universe.Constellations), len(universe.Regions))
+
+	c.buildStargateGraph()
 	return nil
 }
 
+// buildStargateGraph turns each system's adjacency list into an undirected jump graph. Every
+// gate is linked both ways, even when the data only lists it from one end.
+// Callers must hold cacheMutex for writing.
+func (c *ESIClient) buildStargateGraph() {
+	c.stargateGraph = map[int][]int{}
+	c.jumpRangeCache = map[[2]int]map[int]bool{}
+	edges := 0
+	link := func(from, to int) bool {
+		if slices.Contains(c.stargateGraph[from], to) {
+			return false
+		}
+		c.stargateGraph[from] = append(c.stargateGraph[from], to)
+		return true
+	}
+	for id, sys := range c.systemInfoCache {
+		for _, dest := range sys.AdjacentSystems {
+			if link(id, dest) {
+				edges++
+			}
+			link(dest, id)
+		}
+	}
+	if edges == 0 {
+		log.Println("WARNING: static system cache has no stargate data, jump-radius subscriptions will only match the origin system.")
+		return
+	}
+	log.Printf("Built stargate graph with %d systems and %d jumps.", len(c.stargateGraph), edges)
+}
+
+// HasStargateGraph reports whether the static data included any stargate connections.
+func (c *ESIClient) HasStargateGraph() bool {
+	c.cacheMutex.RLock()
+	defer c.cacheMutex.RUnlock()
+	return len(c.stargateGraph) > 0
+}
+
+// SystemsWithinJumps returns the set of systems at most `jumps` stargate jumps from origin,
+// including origin itself. Results are memoised because subscriptions ask the same question on every kill.
+func (c *ESIClient) SystemsWithinJumps(origin, jumps int) map[int]bool {
+	key := [2]int{origin, jumps}
+	c.cacheMutex.RLock()
+	cached, ok := c.jumpRangeCache[key]
+	countCacheLookup("jumpRangeCache", ok)
+	if ok {
+		c.cacheMutex.RUnlock()
+		return cached
+	}
+
+	// Breadth-first search, one ring of neighbours per jump.
+	reached := map[int]bool{origin: true}
+	frontier := []int{origin}
+	for depth := 0; depth < jumps && len(frontier) > 0; depth++ {
+		var next []int
+		for _, sys := range frontier {
+			for _, neighbour := range c.stargateGraph[sys] {
+				if !reached[neighbour] {
+					reached[neighbour] = true
+					next = append(next, neighbour)
+				}
+			}
+		}
+		frontier = next
+	}
+	c.cacheMutex.RUnlock()
+
+	c.cacheMutex.Lock()
+	c.jumpRangeCache[key] = reached
+	c.cacheMutex.Unlock()
+	return reached
+}
+
+// FindSystemByName looks a solar system up in the static cache, ignoring case.
+func (c *ESIClient) FindSystemByName(name string) (*ESISystemInfo, bool) {
+	c.cacheMutex.RLock()
+	defer c.cacheMutex.RUnlock()
+	for _, sys := range c.systemInfoCache {
+		if strings.EqualFold(sys.Name, name) {
+			return sys, true
+		}
+	}
+	return nil, false
+}
+
+// ResolveLocationID turns a region or constellation name into its ID, checking the local
+// caches first and falling back to ESI's /universe/ids/ endpoint.
+func (c *ESIClient) ResolveLocationID(ctx context.Context, kind, name string) (int, string, error) {
+	var cache map[int]string
+	var cacheName string
+	switch kind {
+	case "region":
+		cache, cacheName = c.regionNames, "regionNames"
+	case "constellation":
+		cache, cacheName = c.constellationNames, "constellationNames"
+	default:
+		return 0, "", fmt.Errorf("unsupported location kind: %s", kind)
+	}
+
+	c.cacheMutex.RLock()
+	for id, cachedName := range cache {
+		if strings.EqualFold(cachedName, name) {
+			c.cacheMutex.RUnlock()
+			countCacheLookup(cacheName, true)
+			return id, cachedName, nil
+		}
+	}
+	c.cacheMutex.RUnlock()
+	countCacheLookup(cacheName, false)
+
+	var idData ESIIDResponse
+	body, _ := json.Marshal([]string{name})
+	if err := c.makeRequest(ctx, http.MethodPost, c.baseURL+"/universe/ids/", body, &idData); err != nil {
+		return 0, "", err
+	}
+	hits := idData.Regions
+	if kind == "constellation" {
+		hits = idData.Constellations
+	}
+	if len(hits) == 0 {
+		return 0, "", fmt.Errorf("%s not found: %s", kind, name)
+	}
+
+	c.cacheMutex.Lock()
+	cache[hits[0].ID] = hits[0].Name
+	c.cacheMutex.Unlock()
+	return hits[0].ID, hits[0].Name, nil
+}
+
 func (c *ESIClient) GetSystemDetails(id int) (*ESISystemInfo, error) {
 	c.cacheMutex.RLock()
 	defer c.cacheMutex.RUnlock()
-	if sys, ok := c.systemInfoCache[id]; ok {
+	sys, ok := c.systemInfoCache[id]
+	countCacheLookup("systemInfoCache", ok)
+	if ok {
 		return sys, nil
 	}
 	return nil, fmt.Errorf("system ID %d not found", id)
 }
 
+// --- Cache Management ---
+
+// staticCaches hold the universe data from systems.json, which ESI can't refill on demand.
+var staticCaches = map[string]bool{
+	"systemInfoCache":    true,
+	"stargateGraph":      true,
+	"regionNames":        true,
+	"constellationNames": true,
+}
+
+// esiCache is one of the ESIClient's maps, seen without its types.
+type esiCache struct {
+	size  func() int
+	flush func()
+}
+
+func mapCache[K comparable, V any](m map[K]V) esiCache {
+	return esiCache{size: func() int { return len(m) }, flush: func() { clear(m) }}
+}
+
+// cacheMaps returns every cache by name. Callers must hold cacheMutex.
+func (c *ESIClient) cacheMaps() map[string]esiCache {
+	return map[string]esiCache{
+		"characterNames":     mapCache(c.characterNames),
+		"corporationNames":   mapCache(c.corporationNames),
+		"allianceNames":      mapCache(c.allianceNames),
+		"shipNames":          mapCache(c.shipNames),
+		"shipGroupIDs":       mapCache(c.shipGroupIDs),
+		"systemNames":        mapCache(c.systemNames),
+		"characterIDs":       mapCache(c.characterIDs),
+		"systemInfoCache":    mapCache(c.systemInfoCache),
+		"searchResults":      mapCache(c.searchResults),
+		"regionNames":        mapCache(c.regionNames),
+		"constellationNames": mapCache(c.constellationNames),
+		"stargateGraph":      mapCache(c.stargateGraph),
+		"jumpRangeCache":     mapCache(c.jumpRangeCache),
+		"responses":          c.esiHTTP.cache(),
+	}
+}
+
+// CacheSizes returns the number of entries in each cache.
+func (c *ESIClient) CacheSizes() map[string]int {
+	c.cacheMutex.RLock()
+	defer c.cacheMutex.RUnlock()
+	sizes := make(map[string]int)
+	for name, cache := range c.cacheMaps() {
+		sizes[name] = cache.size()
+	}
+	return sizes
+}
+
+// FlushCaches empties the named caches, or every dynamic cache when names is empty, and returns
+// how many entries each lost. The static caches can't be flushed. The maps are cleared in place,
+// so lookups already holding one see it empty rather than writing into a stale copy.
+func (c *ESIClient) FlushCaches(names []string) (map[string]int, error) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+	caches := c.cacheMaps()
+	if len(names) == 0 {
+		for name := range caches {
+			if !staticCaches[name] {
+				names = append(names, name)
+			}
+		}
+	}
+	for _, name := range names {
+		if _, ok := caches[name]; !ok {
+			return nil, fmt.Errorf("unknown cache %q", name)
+		}
+		if staticCaches[name] {
+			return nil, fmt.Errorf("%s holds static data and can't be flushed", name)
+		}
+	}
+
+	flushed := make(map[string]int)
+	for _, name := range names {
+		flushed[name] = caches[name].size()
+		caches[name].flush()
+	}
+	return flushed, nil
+}
+
 // --- Misc ---
 func (c *ESIClient) GetRandomCorporationLogoURL() string {
 	c.cacheMutex.RLock()
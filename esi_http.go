@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Tuning for ESIHTTPClient.
+const (
+	esiMaxRetries         = 3
+	esiMinBackoff         = 500 * time.Millisecond
+	esiMaxBackoff         = 10 * time.Second
+	esiErrorLimitFloor    = 10 // Requests pause once this few errors are left in the window.
+	esiErrorLimitWindow   = time.Minute
+	esiMaxCachedResponses = 10000
+)
+
+// ESIHTTPClient sends requests to ESI the way CCP asks clients to:
+//
+//   - GET responses are cached until their Expires header, and served from memory until then.
+//   - Once a response has expired, it is revalidated with If-None-Match, and a 304 keeps it.
+//   - Every response carries the error limit: how many 4xx/5xx responses are left before ESI
+//     bans the IP for the rest of the window. When only errorLimitFloor are left, every request
+//     waits for the window to reset instead of spending them.
+//   - 502, 503 and 504 are retried with exponential backoff.
+//
+// One client is shared by everything that calls ESI, so the error limit is governed globally.
+type ESIHTTPClient struct {
+	client    *http.Client
+	userAgent string
+	endpoint  func(url string) string // Labels requests in metrics; see esiEndpoint.
+
+	maxRetries      int
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+	errorLimitFloor int
+	sleep           func(ctx context.Context, d time.Duration) bool // sleepContext, or a fake in tests.
+
+	mu           sync.Mutex
+	responses    map[string]*esiResponse // GET URL -> last 200 response.
+	errorsRemain int
+	errorReset   time.Time // When the current error window ends; zero before ESI has sent one.
+}
+
+// esiResponse is a cached GET response.
+type esiResponse struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+func NewESIHTTPClient(client *http.Client, userAgent string) *ESIHTTPClient {
+	return &ESIHTTPClient{
+		client:          client,
+		userAgent:       userAgent,
+		endpoint:        func(url string) string { return esiEndpoint("", url) },
+		maxRetries:      esiMaxRetries,
+		minBackoff:      esiMinBackoff,
+		maxBackoff:      esiMaxBackoff,
+		errorLimitFloor: esiErrorLimitFloor,
+		sleep:           sleepContext,
+		responses:       make(map[string]*esiResponse),
+	}
+}
+
+// Do sends a request and decodes a 200 or 304 response into target. body is sent as JSON when
+// not nil. Only GET responses are cached.
+func (c *ESIHTTPClient) Do(ctx context.Context, method, url string, body []byte, target any) error {
+	var cached *esiResponse
+	if method == http.MethodGet {
+		c.mu.Lock()
+		cached = c.responses[url]
+		c.mu.Unlock()
+		fresh := cached != nil && time.Now().Before(cached.expires)
+		countCacheLookup("responses", fresh)
+		if fresh {
+			return json.Unmarshal(cached.body, target)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		if !c.awaitErrorLimit(ctx) {
+			return ctx.Err()
+		}
+		resp, data, err := c.send(ctx, method, url, body, cached)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			if method == http.MethodGet {
+				c.store(url, data, resp.Header.Get("ETag"), resp.Header)
+			}
+			return json.Unmarshal(data, target)
+
+		case resp.StatusCode == http.StatusNotModified && cached != nil:
+			etag := resp.Header.Get("ETag")
+			if etag == "" {
+				etag = cached.etag
+			}
+			c.store(url, cached.body, etag, resp.Header)
+			return json.Unmarshal(cached.body, target)
+
+		case retryableESIStatus(resp.StatusCode) && attempt <= c.maxRetries:
+			delay := backoffDelay(attempt, c.minBackoff, c.maxBackoff)
+			log.Printf("ESI returned %s for %s, retrying in %s (attempt %d)", resp.Status, c.endpoint(url), delay.Round(time.Millisecond), attempt)
+			if !c.sleep(ctx, delay) {
+				return ctx.Err()
+			}
+
+		default:
+			return fmt.Errorf("ESI returned %s", resp.Status)
+		}
+	}
+}
+
+// send makes one attempt and reads the whole response.
+func (c *ESIHTTPClient) send(ctx context.Context, method, url string, body []byte, cached *esiResponse) (*http.Response, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cached != nil && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	started := time.Now()
+	resp, err := c.client.Do(req)
+	observeESIRequest(c.endpoint(url), resp, started)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	c.noteErrorLimit(resp)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading ESI response: %w", err)
+	}
+	return resp, data, nil
+}
+
+// retryableESIStatus reports whether a status means ESI or its proxy was briefly unavailable.
+func retryableESIStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// --- Response Cache ---
+
+// store caches a GET response until its Expires header. Expires is read relative to the
+// response's Date, so a skewed local clock doesn't stretch or cut the lifetime. Responses that
+// have already expired are still kept when they have an ETag, to be revalidated next time.
+func (c *ESIHTTPClient) store(url string, body []byte, etag string, header http.Header) {
+	now := time.Now()
+	var expires time.Time
+	if exp, err := http.ParseTime(header.Get("Expires")); err == nil {
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			expires = now.Add(exp.Sub(date))
+		} else {
+			expires = exp
+		}
+	}
+	if etag == "" && !expires.After(now) {
+		c.mu.Lock()
+		delete(c.responses, url)
+		c.mu.Unlock()
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.responses[url]; !ok && len(c.responses) >= esiMaxCachedResponses {
+		for key, r := range c.responses {
+			if now.After(r.expires) {
+				delete(c.responses, key)
+			}
+		}
+		for key := range c.responses { // Still full: drop entries at random.
+			if len(c.responses) < esiMaxCachedResponses {
+				break
+			}
+			delete(c.responses, key)
+		}
+	}
+	c.responses[url] = &esiResponse{body: body, etag: etag, expires: expires}
+}
+
+// cache exposes the response cache to CacheSizes and FlushCaches.
+func (c *ESIHTTPClient) cache() esiCache {
+	return esiCache{
+		size: func() int {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return len(c.responses)
+		},
+		flush: func() {
+			c.mu.Lock()
+			clear(c.responses)
+			c.mu.Unlock()
+		},
+	}
+}
+
+// --- Error Limit ---
+
+// noteErrorLimit records the error limit ESI sent with a response. A 420 means the limit has
+// been hit; should it come without the headers, the usual window is assumed.
+func (c *ESIHTTPClient) noteErrorLimit(resp *http.Response) {
+	remain, errRemain := strconv.Atoi(resp.Header.Get("X-ESI-Error-Limit-Remain"))
+	reset, errReset := strconv.Atoi(resp.Header.Get("X-ESI-Error-Limit-Reset"))
+	if resp.StatusCode == 420 {
+		remain = 0
+		if errReset != nil {
+			reset, errReset = int(esiErrorLimitWindow.Seconds()), nil
+		}
+		errRemain = nil
+	}
+	if errRemain != nil || errReset != nil {
+		return
+	}
+	c.mu.Lock()
+	c.errorsRemain = remain
+	c.errorReset = time.Now().Add(time.Duration(reset) * time.Second)
+	c.mu.Unlock()
+	esiErrorLimitRemain.Set(float64(remain))
+}
+
+// awaitErrorLimit holds a request back until the error window resets when too few errors are
+// left in it. It returns false if ctx ends first.
+func (c *ESIHTTPClient) awaitErrorLimit(ctx context.Context) bool {
+	c.mu.Lock()
+	remain, wait := c.errorsRemain, time.Until(c.errorReset)
+	c.mu.Unlock()
+	if remain > c.errorLimitFloor || wait <= 0 {
+		return true
+	}
+	log.Printf("WARNING: ESI error limit nearly reached (%d left), pausing requests for %s", remain, wait.Round(time.Second))
+	return c.sleep(ctx, wait)
+}
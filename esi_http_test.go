@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// esiFake is an httptest ESI whose replies are scripted by the test. It counts requests and
+// records the If-None-Match each one carried.
+type esiFake struct {
+	srv      *httptest.Server
+	requests atomic.Int32
+
+	mu          sync.Mutex
+	ifNoneMatch []string
+}
+
+func newESIFake(t *testing.T, reply func(w http.ResponseWriter, r *http.Request, n int)) *esiFake {
+	t.Helper()
+	f := &esiFake{}
+	f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(f.requests.Add(1))
+		f.mu.Lock()
+		f.ifNoneMatch = append(f.ifNoneMatch, r.Header.Get("If-None-Match"))
+		f.mu.Unlock()
+		reply(w, r, n)
+	}))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// testESIHTTPClient returns a client that records its waits instead of sleeping.
+func testESIHTTPClient() (*ESIHTTPClient, *[]time.Duration) {
+	c := NewESIHTTPClient(&http.Client{Timeout: 5 * time.Second}, "test")
+	var waits []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) bool {
+		waits = append(waits, d)
+		return ctx.Err() == nil
+	}
+	return c, &waits
+}
+
+// setExpiry sets Date and an Expires ttl later, the way ESI does.
+func setExpiry(w http.ResponseWriter, ttl time.Duration) {
+	now := time.Now().UTC()
+	w.Header().Set("Date", now.Format(http.TimeFormat))
+	w.Header().Set("Expires", now.Add(ttl).Format(http.TimeFormat))
+}
+
+func setErrorLimit(w http.ResponseWriter, remain, reset int) {
+	w.Header().Set("X-ESI-Error-Limit-Remain", strconv.Itoa(remain))
+	w.Header().Set("X-ESI-Error-Limit-Reset", strconv.Itoa(reset))
+}
+
+func TestESIHTTPClientCachesAndRevalidates(t *testing.T) {
+	fake := newESIFake(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		w.Header().Set("ETag", `"v1"`)
+		switch {
+		case n == 1:
+			setExpiry(w, 0) // Already stale, so the next call must revalidate.
+			w.Write([]byte(`{"name":"Rifter"}`))
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			setExpiry(w, time.Hour)
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			t.Errorf("request %d came without If-None-Match", n)
+		}
+	})
+	c, _ := testESIHTTPClient()
+	url := fake.srv.URL + "/universe/types/587/"
+
+	for i := range 3 {
+		var got ESINameResponse
+		if err := c.Do(context.Background(), http.MethodGet, url, nil, &got); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+		if got.Name != "Rifter" {
+			t.Errorf("call %d: name = %q", i+1, got.Name)
+		}
+	}
+	// The first call fetches, the second is answered 304 and renews the entry for an hour, and
+	// the third never leaves the cache.
+	if n := fake.requests.Load(); n != 2 {
+		t.Errorf("ESI saw %d requests, want 2", n)
+	}
+	if fake.ifNoneMatch[0] != "" || fake.ifNoneMatch[1] != `"v1"` {
+		t.Errorf("If-None-Match = %q", fake.ifNoneMatch)
+	}
+
+	if cache := c.cache(); cache.size() != 1 {
+		t.Errorf("cache size = %d, want 1", cache.size())
+	} else if cache.flush(); cache.size() != 0 {
+		t.Error("flush left entries behind")
+	}
+}
+
+func TestESIHTTPClientDoesNotCacheWithoutExpiresOrETag(t *testing.T) {
+	fake := newESIFake(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		w.Write([]byte(`[]`))
+	})
+	c, _ := testESIHTTPClient()
+	for range 2 {
+		var hits []ESINameHit
+		if err := c.Do(context.Background(), http.MethodGet, fake.srv.URL+"/universe/names/", nil, &hits); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fake.requests.Load(); n != 2 {
+		t.Errorf("ESI saw %d requests, want 2 as nothing could be cached", n)
+	}
+}
+
+func TestESIHTTPClientRetriesGatewayErrors(t *testing.T) {
+	statuses := []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	fake := newESIFake(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte(`{"characters":[{"id":90000001,"name":"Pilot"}]}`))
+	})
+	c, waits := testESIHTTPClient()
+
+	var ids ESIIDResponse
+	if err := c.Do(context.Background(), http.MethodPost, fake.srv.URL+"/universe/ids/", []byte(`["Pilot"]`), &ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids.Characters) != 1 || fake.requests.Load() != 4 {
+		t.Errorf("got %+v after %d requests, want the 4th to succeed", ids, fake.requests.Load())
+	}
+	if len(*waits) != 3 {
+		t.Fatalf("waits = %v, want 3 backoffs", *waits)
+	}
+	for i, d := range *waits {
+		if limit := min(c.minBackoff<<i, c.maxBackoff); d < limit/2 || d > limit {
+			t.Errorf("backoff %d = %s, want between %s and %s", i+1, d, limit/2, limit)
+		}
+	}
+}
+
+func TestESIHTTPClientGivesUp(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		want   int32
+	}{
+		{http.StatusServiceUnavailable, esiMaxRetries + 1},
+		{http.StatusNotFound, 1}, // Not worth retrying.
+		{http.StatusInternalServerError, 1},
+	} {
+		fake := newESIFake(t, func(w http.ResponseWriter, r *http.Request, n int) {
+			w.WriteHeader(tc.status)
+		})
+		c, _ := testESIHTTPClient()
+		var v any
+		if err := c.Do(context.Background(), http.MethodGet, fake.srv.URL+"/characters/1/", nil, &v); err == nil {
+			t.Errorf("status %d: want an error", tc.status)
+		}
+		if n := fake.requests.Load(); n != tc.want {
+			t.Errorf("status %d: ESI saw %d requests, want %d", tc.status, n, tc.want)
+		}
+	}
+}
+
+func TestESIHTTPClientPausesNearTheErrorLimit(t *testing.T) {
+	remain := 50
+	fake := newESIFake(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		setErrorLimit(w, remain, 30)
+		if r.URL.Path == "/limited/" {
+			w.WriteHeader(420)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	c, waits := testESIHTTPClient()
+	var v any
+	get := func(path string) {
+		t.Helper()
+		if err := c.Do(context.Background(), http.MethodGet, fake.srv.URL+path, nil, &v); err == nil {
+			t.Fatalf("GET %s: want an error", path)
+		}
+	}
+
+	get("/characters/1/")
+	get("/characters/2/")
+	if len(*waits) != 0 {
+		t.Errorf("waited %v with 50 errors left", *waits)
+	}
+
+	remain = esiErrorLimitFloor
+	get("/characters/3/") // Reports that only the floor is left.
+	get("/characters/4/") // So this one waits for the window to reset.
+	if len(*waits) != 1 || (*waits)[0] < 29*time.Second || (*waits)[0] > 30*time.Second {
+		t.Errorf("waits = %v, want one of about 30s", *waits)
+	}
+
+	// A 420 means the limit was hit, whatever the header said.
+	remain = 50
+	get("/limited/")
+	*waits = nil
+	get("/characters/5/")
+	if len(*waits) != 1 {
+		t.Errorf("waits = %v, want a pause after a 420", *waits)
+	}
+}
+
+func TestESIHTTPClientPauseEndsWithContext(t *testing.T) {
+	fake := newESIFake(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		setErrorLimit(w, 0, 60)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	c := NewESIHTTPClient(&http.Client{Timeout: 5 * time.Second}, "test")
+	var v any
+	c.Do(context.Background(), http.MethodGet, fake.srv.URL+"/characters/1/", nil, &v)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err := c.Do(ctx, http.MethodGet, fake.srv.URL+"/characters/2/", nil, &v)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(started) > 5*time.Second {
+		t.Errorf("got %v after %s, want the deadline while paused", err, time.Since(started))
+	}
+	if n := fake.requests.Load(); n != 1 {
+		t.Errorf("ESI saw %d requests, want the paused one held back", n)
+	}
+}
+
+func TestESIClientUsesTheResponseCache(t *testing.T) {
+	fake := newESIFake(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		setExpiry(w, 30*time.Second)
+		w.Write([]byte(`{"players":23000,"server_version":"2900000"}`))
+	})
+	esi := NewESIClient("test")
+	esi.baseURL = fake.srv.URL
+
+	for range 2 {
+		status, err := esi.getAPIStatus(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Players != 23000 {
+			t.Errorf("status = %+v", status)
+		}
+	}
+	if n := fake.requests.Load(); n != 1 {
+		t.Errorf("ESI saw %d requests, want 1 within the Expires window", n)
+	}
+	if sizes := esi.CacheSizes(); sizes["responses"] != 1 {
+		t.Errorf("sizes = %v", sizes)
+	}
+}
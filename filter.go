@@ -0,0 +1,402 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxFilterLength keeps stored expressions to something a human can still read in /filter show.
+const maxFilterLength = 500
+
+// Filter is a compiled per-channel killmail filter expression, e.g.
+//
+//	nullsec AND capitals AND value >= 3b AND NOT npc
+//
+// Bare words are killmail topics (the same tags /subscribe uses), and comparisons
+// work against the numeric and text fields listed in filterNumberFields/filterTextFields.
+type Filter struct {
+	Source string
+	root   filterNode
+}
+
+// filterEnv is the data a filter expression is evaluated against.
+type filterEnv struct {
+	data   *KillmailData
+	topics map[string]bool
+}
+
+type filterNode interface {
+	eval(env *filterEnv) bool
+}
+
+// --- Fields ---
+
+var filterNumberFields = map[string]func(d *KillmailData) float64{
+	"value":       func(d *KillmailData) float64 { return d.Killmail.TotalValue },
+	"security":    func(d *KillmailData) float64 { return d.Killmail.SystemSecurity },
+	"attackers":   func(d *KillmailData) float64 { return float64(len(d.Killmail.Attackers)) },
+	"system_id":   func(d *KillmailData) float64 { return float64(d.Killmail.SystemID) },
+	"region_id":   func(d *KillmailData) float64 { return float64(d.Killmail.RegionID) },
+	"ship_id":     func(d *KillmailData) float64 { return float64(d.Killmail.Victim.ShipID) },
+	"ship_group":  func(d *KillmailData) float64 { return float64(d.Killmail.Victim.ShipGroupID) },
+	"victim_id":   func(d *KillmailData) float64 { return float64(d.Killmail.Victim.CharacterID) },
+	"victim_corp": func(d *KillmailData) float64 { return float64(d.Killmail.Victim.CorporationID) },
+}
+
+var filterTextFields = map[string]func(d *KillmailData) string{
+	"system": func(d *KillmailData) string { return d.Killmail.SystemName },
+	"region": func(d *KillmailData) string { return d.Killmail.RegionName.En },
+	"ship":   func(d *KillmailData) string { return d.Killmail.Victim.ShipName.En },
+	"victim": func(d *KillmailData) string { return d.Killmail.Victim.CharacterName },
+}
+
+// isKnownTopic reports whether a bare word in a filter refers to a topic we generate: a
+// /subscribe choice or a ship class.
+func isKnownTopic(name string) bool {
+	if isTopicChoice(name) {
+		return true
+	}
+	for _, class := range shipClassesByGroupName {
+		if class.Class == name {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Public API ---
+
+// ParseFilter compiles a filter expression, returning a descriptive error if it is invalid.
+func ParseFilter(source string) (*Filter, error) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return nil, fmt.Errorf("filter expression is empty")
+	}
+	if len(source) > maxFilterLength {
+		return nil, fmt.Errorf("filter expression is longer than %d characters", maxFilterLength)
+	}
+
+	tokens, err := lexFilter(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos+1)
+	}
+	return &Filter{Source: source, root: root}, nil
+}
+
+// Match evaluates the filter against a killmail and the topics already generated for it.
+func (f *Filter) Match(data *KillmailData, topics []string) bool {
+	env := &filterEnv{data: data, topics: make(map[string]bool, len(topics))}
+	for _, t := range topics {
+		env.topics[t] = true
+	}
+	return f.root.eval(env)
+}
+
+// --- Lexer ---
+
+type filterTokenKind int
+
+const (
+	tokEOF filterTokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+	tokCompare
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+func lexFilter(src string) ([]filterToken, error) {
+	var tokens []filterToken
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == '&' || c == '|':
+			if i+1 >= len(src) || rune(src[i+1]) != c {
+				return nil, fmt.Errorf("unexpected %q at position %d (did you mean %c%c?)", string(c), i+1, c, c)
+			}
+			kind := tokAnd
+			if c == '|' {
+				kind = tokOr
+			}
+			tokens = append(tokens, filterToken{kind: kind, text: src[i : i+2], pos: i})
+			i += 2
+		case c == '>' || c == '<' || c == '=' || c == '!':
+			op := string(c)
+			if i+1 < len(src) && src[i+1] == '=' {
+				op += "="
+			}
+			switch op {
+			case "!":
+				tokens = append(tokens, filterToken{kind: tokNot, text: op, pos: i})
+			case "=":
+				// Accept a single '=' as equality, it's what most people type.
+				tokens = append(tokens, filterToken{kind: tokCompare, text: "==", pos: i})
+			default:
+				tokens = append(tokens, filterToken{kind: tokCompare, text: op, pos: i})
+			}
+			i += len(op)
+		case c == '"' || c == '\'':
+			end := strings.IndexRune(src[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string starting at position %d", i+1)
+			}
+			tokens = append(tokens, filterToken{kind: tokString, text: src[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case unicode.IsDigit(c) && isTopicWord(src[i:]) && !afterComparison(tokens):
+			// Topics like 10b look like numbers, but on their own they're the topic.
+			start := i
+			for i < len(src) && isWordChar(src[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokIdent, text: strings.ToLower(src[start:i]), pos: start})
+		case unicode.IsDigit(c) || c == '.' || c == '-':
+			start := i
+			i++
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.' || src[i] == '_') {
+				i++
+			}
+			multiplier := 1.0
+			if i < len(src) {
+				switch unicode.ToLower(rune(src[i])) {
+				case 'k':
+					multiplier, i = 1_000, i+1
+				case 'm':
+					multiplier, i = 1_000_000, i+1
+				case 'b':
+					multiplier, i = 1_000_000_000, i+1
+				}
+			}
+			text := src[start:i]
+			numText := strings.ReplaceAll(strings.TrimRight(text, "kKmMbB"), "_", "")
+			n, err := strconv.ParseFloat(numText, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", text, start+1)
+			}
+			tokens = append(tokens, filterToken{kind: tokNumber, text: text, num: n * multiplier, pos: start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && isWordChar(src[i]) {
+				i++
+			}
+			word := strings.ToLower(src[start:i])
+			switch word {
+			case "and":
+				tokens = append(tokens, filterToken{kind: tokAnd, text: word, pos: start})
+			case "or":
+				tokens = append(tokens, filterToken{kind: tokOr, text: word, pos: start})
+			case "not":
+				tokens = append(tokens, filterToken{kind: tokNot, text: word, pos: start})
+			default:
+				tokens = append(tokens, filterToken{kind: tokIdent, text: word, pos: start})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", string(c), i+1)
+		}
+	}
+	return append(tokens, filterToken{kind: tokEOF, text: "end of expression", pos: len(src)}), nil
+}
+
+func isWordChar(b byte) bool {
+	return unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b)) || b == '_'
+}
+
+// isTopicWord reports whether src starts with a whole word that is a known topic.
+func isTopicWord(src string) bool {
+	end := 0
+	for end < len(src) && isWordChar(src[end]) {
+		end++
+	}
+	return isKnownTopic(strings.ToLower(src[:end]))
+}
+
+// afterComparison reports whether the next token is the value of a comparison, where 10b is
+// always a number.
+func afterComparison(tokens []filterToken) bool {
+	return len(tokens) > 0 && tokens[len(tokens)-1].kind == tokCompare
+}
+
+// --- Parser ---
+
+// filterParser is a small recursive-descent parser. Precedence, lowest first: OR, AND, NOT, comparison.
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken { return p.tokens[p.pos] }
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' at position %d, found %q", closing.pos+1, closing.text)
+		}
+		return inner, nil
+	case tokIdent:
+		if p.peek().kind == tokCompare {
+			return p.parseComparison(tok)
+		}
+		if !isKnownTopic(tok.text) {
+			return nil, fmt.Errorf("unknown topic %q at position %d", tok.text, tok.pos+1)
+		}
+		return topicNode(tok.text), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos+1)
+	}
+}
+
+func (p *filterParser) parseComparison(field filterToken) (filterNode, error) {
+	op := p.next()
+	value := p.next()
+
+	if getter, ok := filterNumberFields[field.text]; ok {
+		if value.kind != tokNumber {
+			return nil, fmt.Errorf("field %q needs a number after %s, found %q", field.text, op.text, value.text)
+		}
+		return numberCompareNode{get: getter, op: op.text, value: value.num}, nil
+	}
+	if getter, ok := filterTextFields[field.text]; ok {
+		if value.kind != tokString && value.kind != tokIdent {
+			return nil, fmt.Errorf("field %q needs a quoted name after %s, found %q", field.text, op.text, value.text)
+		}
+		if op.text != "==" && op.text != "!=" {
+			return nil, fmt.Errorf("field %q only supports == and !=", field.text)
+		}
+		return textCompareNode{get: getter, negate: op.text == "!=", value: value.text}, nil
+	}
+	return nil, fmt.Errorf("unknown field %q at position %d", field.text, field.pos+1)
+}
+
+// --- AST nodes ---
+
+type andNode struct{ left, right filterNode }
+type orNode struct{ left, right filterNode }
+type notNode struct{ inner filterNode }
+type topicNode string
+
+type numberCompareNode struct {
+	get   func(d *KillmailData) float64
+	op    string
+	value float64
+}
+
+type textCompareNode struct {
+	get    func(d *KillmailData) string
+	negate bool
+	value  string
+}
+
+func (n andNode) eval(env *filterEnv) bool   { return n.left.eval(env) && n.right.eval(env) }
+func (n orNode) eval(env *filterEnv) bool    { return n.left.eval(env) || n.right.eval(env) }
+func (n notNode) eval(env *filterEnv) bool   { return !n.inner.eval(env) }
+func (n topicNode) eval(env *filterEnv) bool { return env.topics[string(n)] }
+
+func (n numberCompareNode) eval(env *filterEnv) bool {
+	v := n.get(env.data)
+	switch n.op {
+	case ">":
+		return v > n.value
+	case ">=":
+		return v >= n.value
+	case "<":
+		return v < n.value
+	case "<=":
+		return v <= n.value
+	case "==":
+		return v == n.value
+	case "!=":
+		return v != n.value
+	}
+	return false
+}
+
+func (n textCompareNode) eval(env *filterEnv) bool {
+	return strings.EqualFold(n.get(env.data), n.value) != n.negate
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	data := &KillmailData{Killmail: Killmail{
+		SystemName:     "Jita",
+		SystemSecurity: 0.95,
+		RegionID:       10000002,
+		RegionName:     LocalizedName{En: "The Forge"},
+		TotalValue:     12_500_000_000,
+		Victim:         KillmailVictim{CharacterName: "Sample Victim", ShipName: LocalizedName{En: "Hurricane"}, ShipGroupID: 419},
+		Attackers:      make([]KillmailAttacker, 3),
+	}}
+	topics := []string{"highsec", "10b", "5b", "battlecruisers"}
+
+	for _, tc := range []struct {
+		expr string
+		want bool
+	}{
+		{"highsec", true},
+		{"nullsec", false},
+		{"NOT nullsec", true},
+		{"!highsec", false},
+		{"not not highsec", true},
+		// AND binds tighter than OR.
+		{"nullsec AND lowsec OR highsec", true},
+		{"highsec OR nullsec AND lowsec", true},
+		{"(highsec OR nullsec) AND lowsec", false},
+		{"nullsec and lowsec || highsec && battlecruisers", true},
+		// NOT binds tighter than AND.
+		{"NOT nullsec AND highsec", true},
+		{"NOT (highsec AND battlecruisers)", false},
+		// Number suffixes and comparisons.
+		{"value >= 12.5b", true},
+		{"value > 12.5b", false},
+		{"value < 13000m", true},
+		{"value >= 12_500_000k", true},
+		{"value == 12500000000", true},
+		{"value = 12.5B", true},
+		{"value != 12.5b", false},
+		{"security <= 0.45", false},
+		{"security > -1", true},
+		{"attackers >= 3 AND attackers < 4", true},
+		{"ship_group == 419", true},
+		{"region_id == 10000002", true},
+		// Text fields ignore case.
+		{`system == "jita"`, true},
+		{`region == 'The Forge'`, true},
+		{"ship == hurricane", true},
+		{`victim != "Sample Victim"`, false},
+		// Topics that look like numbers are topics, except as a comparison's value.
+		{"10b", true},
+		{"10b OR titans", true},
+		{"5b AND NOT 10b", false},
+		{"value >= 10b AND 10b", true},
+	} {
+		f, err := ParseFilter(tc.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tc.expr, err)
+			continue
+		}
+		if got := f.Match(data, topics); got != tc.want {
+			t.Errorf("%q = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		want string // A part of the error.
+	}{
+		{"", "empty"},
+		{"   ", "empty"},
+		{strings.Repeat("highsec OR ", 50) + "nullsec", "longer than"},
+		{"gatecamps", `unknown topic "gatecamps"`},
+		{"highsec AND", "unexpected"},
+		{"highsec nullsec", `unexpected "nullsec"`},
+		{"(highsec OR nullsec", "expected ')'"},
+		{"highsec)", "unexpected"},
+		{"highsec & nullsec", "did you mean &&"},
+		{"highsec | nullsec", "did you mean ||"},
+		{"value >= big", `needs a number`},
+		{"value >= 1.2.3b", "invalid number"},
+		{"system > Jita", "only supports == and !="},
+		{"system == 5", "needs a quoted name"},
+		{"speed > 5", `unknown field "speed"`},
+		{`system == "Jita`, "unterminated string"},
+		{"highsec # nullsec", "unexpected character"},
+		{"12", "unexpected"},
+	} {
+		_, err := ParseFilter(tc.expr)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ParseFilter(%q) = %v, want an error containing %q", tc.expr, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Embed styles a guild can choose between; a channel can override its guild's choice.
+const (
+	embedStyleStandard = "standard"
+	embedStyleCompact  = "compact"
+	embedStyleDetailed = "detailed"
+)
+
+// GuildConfig is the per-server configuration managed through /config.
+type GuildConfig struct {
+	DefaultChannelID string   // Where new subscriptions go when no channel is given.
+	AdminChannelID   string   // Where Firehawk posts notices about the guild's feeds; the owner is DMed if unset.
+	MinValue         float64  // Kills worth less than this are never posted in this guild.
+	EmbedStyle       string   // embedStyleStandard, embedStyleCompact or embedStyleDetailed.
+	ManagerRoles     []string // Role IDs allowed to manage feeds, on top of server managers.
+}
+
+// Keys used for GuildConfig in the store's guild_settings table.
+const (
+	guildKeyDefaultChannel = "default_channel"
+	guildKeyAdminChannel   = "admin_channel"
+	guildKeyMinValue       = "min_value"
+	guildKeyEmbedStyle     = "embed_style"
+	guildKeyManagerRoles   = "manager_roles"
+)
+
+// guildConfigs and channelGuilds are guarded by mu, like subscriptions.
+var guildConfigs = make(map[string]*GuildConfig)
+var channelGuilds = make(map[string]string) // channel ID -> guild ID
+
+func defaultGuildConfig() *GuildConfig {
+	return &GuildConfig{EmbedStyle: embedStyleStandard}
+}
+
+// guildConfigFromSettings builds a GuildConfig from the raw key/value rows in the store.
+func guildConfigFromSettings(settings map[string]string) *GuildConfig {
+	cfg := defaultGuildConfig()
+	cfg.DefaultChannelID = settings[guildKeyDefaultChannel]
+	cfg.AdminChannelID = settings[guildKeyAdminChannel]
+	if v, err := strconv.ParseFloat(settings[guildKeyMinValue], 64); err == nil {
+		cfg.MinValue = v
+	}
+	if style := settings[guildKeyEmbedStyle]; style != "" {
+		cfg.EmbedStyle = style
+	}
+	if roles := settings[guildKeyManagerRoles]; roles != "" {
+		cfg.ManagerRoles = strings.Split(roles, ",")
+	}
+	return cfg
+}
+
+// settings flattens the config back into key/value rows for the store.
+func (cfg *GuildConfig) settings() map[string]string {
+	return map[string]string{
+		guildKeyDefaultChannel: cfg.DefaultChannelID,
+		guildKeyAdminChannel:   cfg.AdminChannelID,
+		guildKeyMinValue:       strconv.FormatFloat(cfg.MinValue, 'f', -1, 64),
+		guildKeyEmbedStyle:     cfg.EmbedStyle,
+		guildKeyManagerRoles:   strings.Join(cfg.ManagerRoles, ","),
+	}
+}
+
+// getGuildConfig returns a copy of the guild's config, or the defaults if it has none.
+func getGuildConfig(guildID string) GuildConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+	if cfg, ok := guildConfigs[guildID]; ok {
+		copied := *cfg
+		copied.ManagerRoles = append([]string(nil), cfg.ManagerRoles...)
+		return copied
+	}
+	return *defaultGuildConfig()
+}
+
+// saveGuildConfig persists the config and then swaps it into memory.
+func saveGuildConfig(guildID string, cfg GuildConfig) error {
+	for key, value := range cfg.settings() {
+		if err := store.SetGuildSetting(guildID, key, value); err != nil {
+			return err
+		}
+	}
+	mu.Lock()
+	guildConfigs[guildID] = &cfg
+	mu.Unlock()
+	return nil
+}
+
+// loadGuildsFromStore fills guildConfigs, guildStandings and channelGuilds when the bot starts.
+func loadGuildsFromStore(st Store) error {
+	allSettings, err := st.AllGuildSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load guild settings: %w", err)
+	}
+	channels, err := st.ChannelGuilds()
+	if err != nil {
+		return fmt.Errorf("failed to load channel guilds: %w", err)
+	}
+	standings, err := st.Standings()
+	if err != nil {
+		return fmt.Errorf("failed to load standings: %w", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for guildID, settings := range allSettings {
+		guildConfigs[guildID] = guildConfigFromSettings(settings)
+	}
+	channelGuilds = channels
+	guildStandings = standings
+	log.Printf("Loaded configuration for %d guilds, standings for %d guilds and %d feed channels.", len(guildConfigs), len(guildStandings), len(channelGuilds))
+	return nil
+}
+
+// recordChannelGuild remembers which guild a feed channel belongs to.
+func recordChannelGuild(channelID, guildID string) error {
+	mu.RLock()
+	known := channelGuilds[channelID] == guildID
+	mu.RUnlock()
+	if known {
+		return nil
+	}
+	if err := store.SetChannelGuild(channelID, guildID); err != nil {
+		return err
+	}
+	mu.Lock()
+	channelGuilds[channelID] = guildID
+	mu.Unlock()
+	return nil
+}
+
+// backfillChannelGuilds looks up the guild of channels subscribed before guilds were tracked.
+func backfillChannelGuilds(s *discordgo.Session) {
+	mu.RLock()
+	var unknown []string
+	for channelID := range subscriptions {
+		if _, ok := channelGuilds[channelID]; !ok {
+			unknown = append(unknown, channelID)
+		}
+	}
+	mu.RUnlock()
+
+	for _, channelID := range unknown {
+		channel, err := s.Channel(channelID)
+		if err != nil {
+			log.Printf("Could not look up guild for channel %s: %v", channelID, err)
+			continue
+		}
+		if err := recordChannelGuild(channelID, channel.GuildID); err != nil {
+			log.Printf("Failed to record guild for channel %s: %v", channelID, err)
+		}
+	}
+	if len(unknown) > 0 {
+		log.Printf("Backfilled guilds for %d legacy feed channels.", len(unknown))
+	}
+}
+
+// resolveFeedChannel works out which channel a subscription command targets and checks
+// that it belongs to the guild the command was run in. When useDefault is set and no channel
+// option was given, the guild's default feed channel wins over the current channel.
+func resolveFeedChannel(s *discordgo.Session, i *discordgo.InteractionCreate, optionMap map[string]*discordgo.ApplicationCommandInteractionDataOption, useDefault bool) (string, error) {
+	if i.GuildID == "" {
+		return "", fmt.Errorf("feeds can only be managed from inside a server")
+	}
+
+	channelID := i.ChannelID
+	if opt, ok := optionMap["channel"]; ok {
+		channelID = opt.ChannelValue(nil).ID
+	} else if useDefault {
+		if cfg := getGuildConfig(i.GuildID); cfg.DefaultChannelID != "" {
+			channelID = cfg.DefaultChannelID
+		}
+	}
+
+	channel, err := s.State.Channel(channelID)
+	if err != nil {
+		if channel, err = s.Channel(channelID); err != nil {
+			return "", fmt.Errorf("cannot access channel <#%s>", channelID)
+		}
+	}
+	if channel.GuildID != i.GuildID {
+		return "", fmt.Errorf("channel <#%s> is not part of this server", channelID)
+	}
+	if channel.Type != discordgo.ChannelTypeGuildText && channel.Type != discordgo.ChannelTypeGuildNews {
+		return "", fmt.Errorf("channel <#%s> is not a text channel", channelID)
+	}
+	if !canManageFeedChannel(s.State, i, channel) {
+		recordAudit(i, channelID, "denied", fmt.Sprintf("/%s", i.ApplicationCommandData().Name))
+		return "", fmt.Errorf("you need the **Manage Channels** permission in <#%s> or a Firehawk manager role", channelID)
+	}
+
+	if err := recordChannelGuild(channelID, i.GuildID); err != nil {
+		log.Printf("Failed to record guild for channel %s: %v", channelID, err)
+	}
+	return channelID, nil
+}
+
+// describeGuildConfig renders the config for /config view.
+func describeGuildConfig(cfg GuildConfig) string {
+	var b strings.Builder
+	b.WriteString("⚙️ **Server configuration**\n")
+	if cfg.DefaultChannelID != "" {
+		b.WriteString(fmt.Sprintf("• Default feed channel: <#%s>\n", cfg.DefaultChannelID))
+	} else {
+		b.WriteString("• Default feed channel: *current channel*\n")
+	}
+	if cfg.AdminChannelID != "" {
+		b.WriteString(fmt.Sprintf("• Admin notices: <#%s>\n", cfg.AdminChannelID))
+	} else {
+		b.WriteString("• Admin notices: *DM to the server owner*\n")
+	}
+	if cfg.MinValue > 0 {
+		b.WriteString(fmt.Sprintf("• Minimum kill value: %s\n", formatISKHuman(cfg.MinValue)))
+	} else {
+		b.WriteString("• Minimum kill value: *none*\n")
+	}
+	b.WriteString(fmt.Sprintf("• Embed style: `%s`\n", cfg.EmbedStyle))
+	if len(cfg.ManagerRoles) > 0 {
+		roles := make([]string, len(cfg.ManagerRoles))
+		for idx, roleID := range cfg.ManagerRoles {
+			roles[idx] = fmt.Sprintf("<@&%s>", roleID)
+		}
+		b.WriteString(fmt.Sprintf("• Manager roles: %s\n", strings.Join(roles, ", ")))
+	} else {
+		b.WriteString("• Manager roles: *server managers only*\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Probe thresholds. discordgo reconnects the gateway by itself and the sources reconnect with
+// backoff, so only an outage that outlasts the reconnects fails liveness and gets the bot restarted.
+const (
+	healthGatewayGrace = 5 * time.Minute  // How long the gateway may be down before /healthz fails.
+	healthFrameMaxAge  = 30 * time.Minute // How long a source may go without any frame, pings included.
+)
+
+// Health tracks what the probes report on: the Discord gateway, the killmail sources and the
+// static caches loaded at startup.
+type Health struct {
+	started time.Time
+
+	mu             sync.Mutex
+	gatewayUp      bool
+	gatewayChanged time.Time
+	sources        []KillmailSource
+	staticCaches   map[string]bool // Cache name -> whether it loaded.
+}
+
+// HealthComponent is one component's status in a probe response.
+type HealthComponent struct {
+	Name   string    `json:"name"`
+	OK     bool      `json:"ok"`
+	Detail string    `json:"detail"`
+	Since  time.Time `json:"since,omitzero"` // The gateway's last change, or a source's last frame.
+}
+
+// HealthReport is the JSON body of /healthz and /readyz.
+type HealthReport struct {
+	Status     string            `json:"status"` // "ok" or "degraded".
+	Components []HealthComponent `json:"components"`
+}
+
+var health = NewHealth()
+
+func NewHealth() *Health {
+	now := time.Now()
+	return &Health{started: now, gatewayChanged: now, staticCaches: make(map[string]bool)}
+}
+
+// SetStaticCache records whether one of the static caches loaded.
+func (h *Health) SetStaticCache(name string, loaded bool) {
+	h.mu.Lock()
+	h.staticCaches[name] = loaded
+	h.mu.Unlock()
+}
+
+// SetSources sets the killmail sources whose state the probes check.
+func (h *Health) SetSources(sources []KillmailSource) {
+	h.mu.Lock()
+	h.sources = sources
+	h.mu.Unlock()
+}
+
+// onConnect and onDisconnect are discordgo handlers that follow the gateway connection.
+func (h *Health) onConnect(_ *discordgo.Session, _ *discordgo.Connect) { h.setGateway(true) }
+
+func (h *Health) onDisconnect(_ *discordgo.Session, _ *discordgo.Disconnect) { h.setGateway(false) }
+
+func (h *Health) setGateway(up bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.gatewayUp != up {
+		h.gatewayUp = up
+		h.gatewayChanged = time.Now()
+	}
+}
+
+// Report checks every component. Liveness only fails on outages that a restart could fix: the
+// gateway down past its grace period, or no source hearing from upstream for healthFrameMaxAge.
+// Readiness also needs the gateway and a source connected right now, and the static caches
+// loaded. With several sources, the feed is up while any one of them is.
+func (h *Health) Report(ready bool, now time.Time) HealthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	healthy := true
+	var components []HealthComponent
+
+	gateway := HealthComponent{Name: "discord_gateway", Since: h.gatewayChanged}
+	downFor := now.Sub(h.gatewayChanged)
+	switch {
+	case h.gatewayUp:
+		gateway.OK = true
+		gateway.Detail = "connected"
+	case ready:
+		gateway.Detail = fmt.Sprintf("disconnected for %s", downFor.Round(time.Second))
+	default:
+		gateway.OK = downFor <= healthGatewayGrace
+		gateway.Detail = fmt.Sprintf("disconnected for %s, the limit is %s", downFor.Round(time.Second), healthGatewayGrace)
+	}
+	healthy = healthy && gateway.OK
+	components = append(components, gateway)
+
+	feedUp := false
+	for _, src := range h.sources {
+		state := src.State()
+		component := HealthComponent{Name: "source:" + src.Name(), Since: state.LastMessage}
+		lastFrame := state.LastMessage
+		if lastFrame.IsZero() {
+			lastFrame = h.started // Nothing yet; count the silence from startup.
+		}
+		age := now.Sub(lastFrame)
+		fresh := age <= healthFrameMaxAge
+		component.OK = fresh && (state.Connected || !ready)
+		switch {
+		case !fresh:
+			component.Detail = fmt.Sprintf("no frame for %s, the limit is %s", age.Round(time.Second), healthFrameMaxAge)
+		case !state.Connected:
+			component.Detail = "disconnected"
+		default:
+			component.Detail = fmt.Sprintf("connected, last frame %s ago", age.Round(time.Second))
+		}
+		if !state.Connected && state.LastError != "" {
+			component.Detail += ": " + state.LastError
+		}
+		feedUp = feedUp || component.OK
+		components = append(components, component)
+	}
+	healthy = healthy && feedUp
+
+	if ready {
+		for _, name := range []string{"systems", "ship_groups"} {
+			component := HealthComponent{Name: "static_cache:" + name, OK: h.staticCaches[name], Detail: "loaded"}
+			if !component.OK {
+				component.Detail = "not loaded"
+			}
+			healthy = healthy && component.OK
+			components = append(components, component)
+		}
+	}
+
+	report := HealthReport{Status: "ok", Components: components}
+	if !healthy {
+		report.Status = "degraded"
+	}
+	return report
+}
+
+// probeHandler serves a probe as JSON, with 503 when degraded.
+func (h *Health) probeHandler(ready bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := h.Report(ready, time.Now())
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedSource is a KillmailSource that only reports the state it was given.
+type fixedSource struct {
+	name  string
+	state SourceState
+}
+
+func (s *fixedSource) Name() string       { return s.name }
+func (s *fixedSource) State() SourceState { return s.state }
+
+func (s *fixedSource) Run(ctx context.Context, out chan<- *KillmailData) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// testHealth returns a Health whose gateway came up, and whose caches loaded, at start.
+func testHealth(start time.Time, sources ...KillmailSource) *Health {
+	h := NewHealth()
+	h.started = start
+	h.gatewayUp, h.gatewayChanged = true, start
+	h.SetSources(sources)
+	h.SetStaticCache("systems", true)
+	h.SetStaticCache("ship_groups", true)
+	return h
+}
+
+func healthComponent(t *testing.T, report HealthReport, name string) HealthComponent {
+	t.Helper()
+	for _, c := range report.Components {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no %s component in %+v", name, report)
+	return HealthComponent{}
+}
+
+func TestHealthGatewayGrace(t *testing.T) {
+	start := time.Now()
+	h := testHealth(start, &fixedSource{name: "evekill", state: SourceState{Connected: true, LastMessage: start}})
+	h.gatewayUp, h.gatewayChanged = false, start
+
+	// Liveness gives discordgo time to reconnect; readiness fails straight away.
+	if r := h.Report(false, start.Add(healthGatewayGrace)); r.Status != "ok" {
+		t.Errorf("liveness within the grace period = %+v", r)
+	}
+	if r := h.Report(true, start.Add(time.Second)); r.Status != "degraded" || healthComponent(t, r, "discord_gateway").OK {
+		t.Errorf("readiness while disconnected = %+v", r)
+	}
+	r := h.Report(false, start.Add(healthGatewayGrace+time.Second))
+	if gateway := healthComponent(t, r, "discord_gateway"); r.Status != "degraded" || gateway.OK || !strings.Contains(gateway.Detail, "the limit is 5m0s") {
+		t.Errorf("liveness past the grace period = %+v", r)
+	}
+
+	h.setGateway(true)
+	if r := h.Report(true, time.Now()); r.Status != "ok" {
+		t.Errorf("after reconnecting = %+v", r)
+	}
+}
+
+func TestHealthStaleSource(t *testing.T) {
+	start := time.Now()
+	src := &fixedSource{name: "evekill", state: SourceState{Connected: true, LastMessage: start}}
+	h := testHealth(start, src)
+
+	if r := h.Report(false, start.Add(healthFrameMaxAge)); r.Status != "ok" {
+		t.Errorf("a source quiet for the limit = %+v", r)
+	}
+	// Connected, but nothing from upstream, not even a ping: the connection is wedged.
+	r := h.Report(false, start.Add(healthFrameMaxAge+time.Minute))
+	if c := healthComponent(t, r, "source:evekill"); r.Status != "degraded" || c.OK || !strings.HasPrefix(c.Detail, "no frame for 31m0s") {
+		t.Errorf("a stale source = %+v", r)
+	}
+
+	// A source that never heard anything counts its silence from startup.
+	src.state = SourceState{LastError: "dial failed"}
+	if r := h.Report(false, start.Add(time.Minute)); r.Status != "ok" {
+		t.Errorf("liveness of a new, disconnected source = %+v", r)
+	}
+	r = h.Report(false, start.Add(healthFrameMaxAge+time.Minute))
+	if c := healthComponent(t, r, "source:evekill"); r.Status != "degraded" || !strings.HasSuffix(c.Detail, ": dial failed") {
+		t.Errorf("a source that never connected = %+v", r)
+	}
+}
+
+func TestHealthMultipleSources(t *testing.T) {
+	start := time.Now()
+	now := start.Add(time.Hour)
+	evekill := &fixedSource{name: "evekill", state: SourceState{LastMessage: start}}
+	r2z2 := &fixedSource{name: "r2z2", state: SourceState{Connected: true, LastMessage: now}}
+	h := testHealth(start, evekill, r2z2)
+
+	// One source carries the feed through the other's outage.
+	for _, ready := range []bool{false, true} {
+		r := h.Report(ready, now)
+		if r.Status != "ok" || healthComponent(t, r, "source:evekill").OK || !healthComponent(t, r, "source:r2z2").OK {
+			t.Errorf("ready=%v with one source down = %+v", ready, r)
+		}
+	}
+
+	// Both fresh but disconnected: alive, as they are reconnecting, but not ready.
+	evekill.state = SourceState{LastMessage: now}
+	r2z2.state = SourceState{LastMessage: now}
+	if r := h.Report(false, now); r.Status != "ok" {
+		t.Errorf("liveness while both reconnect = %+v", r)
+	}
+	if r := h.Report(true, now); r.Status != "degraded" {
+		t.Errorf("readiness while both reconnect = %+v", r)
+	}
+
+	if r := testHealth(start).Report(false, start); r.Status != "degraded" {
+		t.Errorf("without sources = %+v", r)
+	}
+}
+
+func TestHealthMissingStaticCache(t *testing.T) {
+	start := time.Now()
+	h := testHealth(start, &fixedSource{name: "evekill", state: SourceState{Connected: true, LastMessage: start}})
+	h.SetStaticCache("ship_groups", false)
+
+	r := h.Report(true, start)
+	if c := healthComponent(t, r, "static_cache:ship_groups"); r.Status != "degraded" || c.OK || c.Detail != "not loaded" {
+		t.Errorf("readiness without ship groups = %+v", r)
+	}
+	if !healthComponent(t, r, "static_cache:systems").OK {
+		t.Errorf("systems = %+v", r)
+	}
+	// A restart won't bring a missing file back, so liveness doesn't look at the caches.
+	r = h.Report(false, start)
+	if r.Status != "ok" {
+		t.Errorf("liveness without ship groups = %+v", r)
+	}
+	for _, c := range r.Components {
+		if strings.HasPrefix(c.Name, "static_cache:") {
+			t.Errorf("liveness reports %s", c.Name)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.probeHandler(true).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"status":"degraded"`) {
+		t.Errorf("/readyz = %d %s", rec.Code, rec.Body)
+	}
+}
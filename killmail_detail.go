@@ -0,0 +1,222 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// topModulesShown is how many modules the detailed embed lists.
+const topModulesShown = 5
+
+// isFittedFlag reports whether an inventory flag is a fitting slot: low, mid and high slots,
+// rigs and subsystems. Cargo, drone bay and the other holds are not.
+func isFittedFlag(flag int) bool {
+	return (flag >= 11 && flag <= 34) || (flag >= 92 && flag <= 99) || (flag >= 125 && flag <= 132)
+}
+
+// ValueSplit returns how much of the kill dropped and how much was destroyed. zKillboard sends
+// the split; for eve-kill it is summed from the priced items. Both are zero when neither is known.
+func (k *Killmail) ValueSplit() (dropped, destroyed float64) {
+	if k.DroppedValue > 0 || k.DestroyedValue > 0 {
+		return k.DroppedValue, k.DestroyedValue
+	}
+	var sum func(items []KillmailItem)
+	sum = func(items []KillmailItem) {
+		for _, item := range items {
+			dropped += item.Value * float64(item.QtyDropped)
+			destroyed += item.Value * float64(item.QtyDestroyed)
+			sum(item.Items)
+		}
+	}
+	sum(k.Items)
+	return dropped, destroyed
+}
+
+// topDamageDealer returns the attacker who did the most damage, if any did.
+func topDamageDealer(attackers []KillmailAttacker) (KillmailAttacker, bool) {
+	var top KillmailAttacker
+	for _, a := range attackers {
+		if a.DamageDone > top.DamageDone {
+			top = a
+		}
+	}
+	return top, top.DamageDone > 0
+}
+
+// topModules returns the most valuable fitted modules, most valuable first. Only priced items
+// count, so kills from sources without item values have none.
+func topModules(items []KillmailItem, n int) []KillmailItem {
+	var fitted []KillmailItem
+	for _, item := range items {
+		if isFittedFlag(item.Flag) && item.Value > 0 {
+			fitted = append(fitted, item)
+		}
+	}
+	slices.SortStableFunc(fitted, func(a, b KillmailItem) int {
+		return cmp.Compare(b.Value*float64(b.QtyDropped+b.QtyDestroyed), a.Value*float64(a.QtyDropped+a.QtyDestroyed))
+	})
+	return fitted[:min(n, len(fitted))]
+}
+
+// mainAttackingAlliance returns the alliance with the most attackers on the kill.
+func mainAttackingAlliance(attackers []KillmailAttacker) (id int, name string, count int) {
+	counts := make(map[int]int)
+	for _, a := range attackers {
+		if a.AllianceID == 0 {
+			continue
+		}
+		counts[a.AllianceID]++
+		if counts[a.AllianceID] > count {
+			id, name, count = a.AllianceID, a.AllianceName, counts[a.AllianceID]
+		}
+	}
+	return id, name, count
+}
+
+// describeInvolved summarises who was on the kill, e.g. "Solo", "12 pilots" or "3 pilots + 2 NPCs".
+func describeInvolved(k *Killmail) string {
+	pilots, npcs := 0, 0
+	for _, a := range k.Attackers {
+		if a.CharacterID == 0 && a.CharacterName == "" {
+			npcs++
+		} else {
+			pilots++
+		}
+	}
+	if k.IsSolo && pilots == 1 {
+		return "Solo"
+	}
+	plural := func(n int, word string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", word)
+		}
+		return fmt.Sprintf("%d %ss", n, word)
+	}
+	switch {
+	case npcs == 0:
+		return plural(pilots, "pilot")
+	case pilots == 0:
+		return plural(npcs, "NPC")
+	default:
+		return plural(pilots, "pilot") + " + " + plural(npcs, "NPC")
+	}
+}
+
+// describeAttacker renders an attacker as name, ship and security status.
+func describeAttacker(a KillmailAttacker) string {
+	name := a.CharacterName
+	if name == "" {
+		name = "Unknown"
+	}
+	line := fmt.Sprintf("**%s** (%.1f)", name, a.SecurityStatus)
+	if a.ShipName.En != "" {
+		line += "\n" + a.ShipName.En
+	}
+	return line
+}
+
+func allianceLogoURL(id int) string {
+	return fmt.Sprintf("https://images.evetech.net/alliances/%d/logo?size=64", id)
+}
+
+func corporationLogoURL(id int) string {
+	return fmt.Sprintf("https://images.evetech.net/corporations/%d/logo?size=64", id)
+}
+
+// buildDetailedKillmailEmbed is the detailed style: the standard fields plus the victim's
+// alliance, the top damage dealer, who was involved, the dropped and destroyed value and the
+// most valuable modules. The victim's and the main attacking alliance's logos frame the embed.
+func buildDetailedKillmailEmbed(data *KillmailData, perspective string) *discordgo.MessageEmbed {
+	k := &data.Killmail
+	victim := k.Victim
+	title, color := killmailHeadline(data, perspective)
+
+	embed := &discordgo.MessageEmbed{
+		Title:     title,
+		URL:       fmt.Sprintf("https://eve-kill.com/kill/%d", k.KillmailID),
+		Color:     color,
+		Timestamp: k.KillmailTime.Format(time.RFC3339),
+		Thumbnail: &discordgo.MessageEmbedThumbnail{
+			URL: fmt.Sprintf("https://images.evetech.net/types/%d/render?size=128", victim.ShipID),
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: "Powered by Firehawk"},
+	}
+
+	// The author line shows who lost the ship, under their alliance or corporation logo.
+	switch {
+	case victim.AllianceID != 0:
+		embed.Author = &discordgo.MessageEmbedAuthor{Name: victim.AllianceName, IconURL: allianceLogoURL(victim.AllianceID)}
+	case victim.CorporationID != 0:
+		embed.Author = &discordgo.MessageEmbedAuthor{Name: victim.CorporationName, IconURL: corporationLogoURL(victim.CorporationID)}
+	}
+
+	pilot, alliance := victim.CharacterName, victim.AllianceName
+	if pilot == "" {
+		pilot = "Unknown"
+	}
+	if alliance == "" {
+		alliance = "None"
+	}
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Victim", Value: pilot, Inline: true},
+		{Name: "Corporation", Value: victim.CorporationName, Inline: true},
+		{Name: "Alliance", Value: alliance, Inline: true},
+	}
+
+	value := formatISKHuman(k.TotalValue)
+	if dropped, destroyed := k.ValueSplit(); dropped+destroyed > 0 {
+		value += fmt.Sprintf("\n🟢 %s dropped\n🔴 %s destroyed", formatISKHuman(dropped), formatISKHuman(destroyed))
+	}
+	embed.Fields = append(embed.Fields,
+		&discordgo.MessageEmbedField{Name: "Value", Value: value, Inline: true},
+		&discordgo.MessageEmbedField{Name: "System", Value: fmt.Sprintf("%s (%.1f)\n%s", k.SystemName, k.SystemSecurity, k.RegionName.En), Inline: true},
+		&discordgo.MessageEmbedField{Name: "Involved", Value: describeInvolved(k), Inline: true},
+	)
+
+	for _, a := range k.Attackers {
+		if a.FinalBlow {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Final Blow", Value: describeAttacker(a), Inline: true})
+			break
+		}
+	}
+	if top, ok := topDamageDealer(k.Attackers); ok {
+		detail := describeAttacker(top)
+		if victim.DamageTaken > 0 {
+			detail += fmt.Sprintf("\n%d damage (%.0f%%)", top.DamageDone, 100*float64(top.DamageDone)/float64(victim.DamageTaken))
+		} else {
+			detail += fmt.Sprintf("\n%d damage", top.DamageDone)
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Top Damage", Value: detail, Inline: true})
+	}
+
+	if modules := topModules(k.Items, topModulesShown); len(modules) > 0 {
+		var b strings.Builder
+		for _, item := range modules {
+			qty := item.QtyDropped + item.QtyDestroyed
+			marker := "🔴"
+			if item.QtyDropped > 0 {
+				marker = "🟢"
+			}
+			if qty > 1 {
+				b.WriteString(fmt.Sprintf("%s %s ×%d · %s\n", marker, item.TypeName.En, qty, formatISKHuman(item.Value*float64(qty))))
+			} else {
+				b.WriteString(fmt.Sprintf("%s %s · %s\n", marker, item.TypeName.En, formatISKHuman(item.Value)))
+			}
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Top Modules", Value: b.String()})
+	}
+
+	// The footer credits the alliance that brought the most pilots.
+	if id, name, count := mainAttackingAlliance(k.Attackers); id != 0 {
+		embed.Footer = &discordgo.MessageEmbedFooter{
+			Text:    fmt.Sprintf("%s (%d) · Powered by Firehawk", name, count),
+			IconURL: allianceLogoURL(id),
+		}
+	}
+	return embed
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Inventory flags used below: 11 is a low slot, 27 a high slot, 92 a rig and 5 the cargo hold.
+func detailedKillmail() *KillmailData {
+	return &KillmailData{Killmail: Killmail{
+		KillmailID:     123,
+		SystemName:     "Tama",
+		SystemSecurity: 0.3,
+		RegionName:     LocalizedName{En: "The Citadel"},
+		TotalValue:     250_000_000,
+		Victim: KillmailVictim{
+			CharacterName: "Victim Pilot", CorporationID: 98000001, CorporationName: "Victim Corp",
+			AllianceID: 99000001, AllianceName: "Victim Alliance",
+			ShipID: 24690, ShipName: LocalizedName{En: "Hurricane"}, DamageTaken: 10000,
+		},
+		Attackers: []KillmailAttacker{
+			{CharacterID: 1, CharacterName: "Closer", AllianceID: 99000002, AllianceName: "Goons", DamageDone: 1000, FinalBlow: true, ShipName: LocalizedName{En: "Rifter"}},
+			{CharacterID: 2, CharacterName: "Heavy Hitter", AllianceID: 99000002, AllianceName: "Goons", DamageDone: 6000, SecurityStatus: -2.5, ShipName: LocalizedName{En: "Tornado"}},
+			{CharacterID: 3, CharacterName: "Third", AllianceID: 99000003, AllianceName: "Others", DamageDone: 2000},
+			{ShipName: LocalizedName{En: "Guristas Pithum"}, DamageDone: 1000}, // An NPC.
+		},
+		Items: []KillmailItem{
+			{TypeName: LocalizedName{En: "Gyrostabilizer"}, Flag: 11, QtyDropped: 2, Value: 10_000_000},
+			{TypeName: LocalizedName{En: "Autocannon"}, Flag: 27, QtyDestroyed: 1, Value: 30_000_000},
+			{TypeName: LocalizedName{En: "Rig"}, Flag: 92, QtyDestroyed: 1, Value: 5_000_000},
+			{TypeName: LocalizedName{En: "Unpriced"}, Flag: 12, QtyDestroyed: 1},
+			// A container in the cargo: not a module, but its contents count towards the value.
+			{TypeName: LocalizedName{En: "Container"}, Flag: 5, QtyDropped: 1, Value: 1_000_000, Items: []KillmailItem{
+				{TypeName: LocalizedName{En: "Loot"}, QtyDropped: 3, Value: 2_000_000},
+				{TypeName: LocalizedName{En: "Ammo"}, QtyDestroyed: 100, Value: 100_000},
+			}},
+		},
+	}}
+}
+
+func TestValueSplit(t *testing.T) {
+	k := detailedKillmail().Killmail
+	dropped, destroyed := k.ValueSplit()
+	// Dropped: 2 gyros, the container and 3 loot. Destroyed: autocannon, rig, unpriced and ammo.
+	if dropped != 27_000_000 || destroyed != 45_000_000 {
+		t.Errorf("split = %.0f dropped, %.0f destroyed", dropped, destroyed)
+	}
+
+	// A split sent by the source wins over the items.
+	k.DroppedValue, k.DestroyedValue = 1, 2
+	if dropped, destroyed := k.ValueSplit(); dropped != 1 || destroyed != 2 {
+		t.Errorf("split = %v, %v, want the source's", dropped, destroyed)
+	}
+
+	// Without either it is unknown.
+	if dropped, destroyed := (&Killmail{}).ValueSplit(); dropped != 0 || destroyed != 0 {
+		t.Errorf("empty split = %v, %v", dropped, destroyed)
+	}
+}
+
+func TestTopModules(t *testing.T) {
+	items := detailedKillmail().Killmail.Items
+	var names []string
+	for _, item := range topModules(items, 5) {
+		names = append(names, item.TypeName.En)
+	}
+	// Fitted and priced only, by the value of the whole stack.
+	if got := strings.Join(names, ", "); got != "Autocannon, Gyrostabilizer, Rig" {
+		t.Errorf("top modules = %s", got)
+	}
+	if got := topModules(items, 1); len(got) != 1 || got[0].TypeName.En != "Autocannon" {
+		t.Errorf("top module = %+v", got)
+	}
+	if got := topModules(nil, 5); len(got) != 0 {
+		t.Errorf("top modules of nothing = %+v", got)
+	}
+}
+
+func TestDescribeInvolved(t *testing.T) {
+	pilot := KillmailAttacker{CharacterID: 1, CharacterName: "Pilot"}
+	npc := KillmailAttacker{ShipName: LocalizedName{En: "Guristas Pithum"}}
+	for _, tc := range []struct {
+		k    Killmail
+		want string
+	}{
+		{Killmail{IsSolo: true, Attackers: []KillmailAttacker{pilot}}, "Solo"},
+		{Killmail{Attackers: []KillmailAttacker{pilot}}, "1 pilot"},
+		{Killmail{Attackers: []KillmailAttacker{pilot, pilot, pilot}}, "3 pilots"},
+		{Killmail{Attackers: []KillmailAttacker{npc}}, "1 NPC"},
+		{Killmail{Attackers: []KillmailAttacker{pilot, npc, npc}}, "1 pilot + 2 NPCs"},
+		// zKillboard calls a kill solo when one pilot did it, NPCs or not.
+		{Killmail{IsSolo: true, Attackers: []KillmailAttacker{pilot, npc, npc}}, "Solo"},
+		// A character whose name could not be resolved is still a pilot.
+		{Killmail{Attackers: []KillmailAttacker{{CharacterID: 5}, npc}}, "1 pilot + 1 NPC"},
+	} {
+		if got := describeInvolved(&tc.k); got != tc.want {
+			t.Errorf("describeInvolved(%+v) = %q, want %q", tc.k.Attackers, got, tc.want)
+		}
+	}
+}
+
+func TestBuildDetailedKillmailEmbed(t *testing.T) {
+	embed := buildDetailedKillmailEmbed(detailedKillmail(), perspectiveLoss)
+
+	if embed.Title != "We lost a Hurricane in Tama" || embed.Color != colorLoss {
+		t.Errorf("title = %q, color = %x", embed.Title, embed.Color)
+	}
+	if embed.Author == nil || embed.Author.Name != "Victim Alliance" || embed.Author.IconURL != allianceLogoURL(99000001) {
+		t.Errorf("author = %+v", embed.Author)
+	}
+	// Goons brought the most pilots.
+	if embed.Footer == nil || embed.Footer.Text != "Goons (2) · Powered by Firehawk" || embed.Footer.IconURL != allianceLogoURL(99000002) {
+		t.Errorf("footer = %+v", embed.Footer)
+	}
+
+	fields := make(map[string]string)
+	for _, f := range embed.Fields {
+		fields[f.Name] = f.Value
+	}
+	for name, want := range map[string]string{
+		"Victim":      "Victim Pilot",
+		"Alliance":    "Victim Alliance",
+		"Value":       formatISKHuman(250_000_000) + "\n🟢 " + formatISKHuman(27_000_000) + " dropped\n🔴 " + formatISKHuman(45_000_000) + " destroyed",
+		"System":      "Tama (0.3)\nThe Citadel",
+		"Involved":    "3 pilots + 1 NPC",
+		"Final Blow":  "**Closer** (0.0)\nRifter",
+		"Top Damage":  "**Heavy Hitter** (-2.5)\nTornado\n6000 damage (60%)",
+		"Top Modules": "🔴 Autocannon · " + formatISKHuman(30_000_000) + "\n🟢 Gyrostabilizer ×2 · " + formatISKHuman(20_000_000) + "\n🔴 Rig · " + formatISKHuman(5_000_000) + "\n",
+	} {
+		if fields[name] != want {
+			t.Errorf("%s = %q, want %q", name, fields[name], want)
+		}
+	}
+}
+
+func TestBuildDetailedKillmailEmbedWithoutDetails(t *testing.T) {
+	// A zKillboard kill: no item values, no damage, no alliances.
+	data := &KillmailData{Killmail: Killmail{
+		SystemName: "Jita",
+		Victim:     KillmailVictim{CorporationID: 98000001, CorporationName: "Victim Corp", ShipName: LocalizedName{En: "Rifter"}},
+		Attackers:  []KillmailAttacker{{CharacterID: 1, CharacterName: "Pilot", FinalBlow: true}},
+		Items:      []KillmailItem{{TypeName: LocalizedName{En: "Autocannon"}, Flag: 27, QtyDestroyed: 1}},
+	}}
+	embed := buildDetailedKillmailEmbed(data, perspectiveNone)
+	if embed.Author == nil || embed.Author.IconURL != corporationLogoURL(98000001) {
+		t.Errorf("author = %+v", embed.Author)
+	}
+	if embed.Footer.Text != "Powered by Firehawk" {
+		t.Errorf("footer = %q", embed.Footer.Text)
+	}
+	for _, f := range embed.Fields {
+		switch f.Name {
+		case "Top Damage", "Top Modules":
+			t.Errorf("unexpected %s field: %q", f.Name, f.Value)
+		case "Victim", "Alliance":
+			if f.Value != "Unknown" && f.Value != "None" {
+				t.Errorf("%s = %q", f.Name, f.Value)
+			}
+		case "Value":
+			if strings.Contains(f.Value, "dropped") {
+				t.Errorf("value = %q without a split", f.Value)
+			}
+		}
+	}
+}
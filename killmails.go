@@ -1,85 +1,213 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-// HandleKillmailMessage serves as the main entry point for processing raw messages from the WebSocket.
-// It determines the message type and directs the data to the appropriate handler.
-func HandleKillmailMessage(s *discordgo.Session, message []byte) {
-	// First, unmarshal the message into our generic SocketMessage to read its type.
-	var msg SocketMessage
-	if err := json.Unmarshal(message, &msg); err != nil {
-		log.Printf("Error unmarshaling socket envelope: %s", string(message))
+// processAndSendKillmail takes parsed killmail data, finds all subscribed channels that
+// match the killmail's topics, and queues a formatted embed for each of them.
+func processAndSendKillmail(q *DeliveryQueue, data *KillmailData) {
+	// Replays after a reconnect and kills from a second source have been handled already.
+	if killmailLedger != nil && !killmailLedger.MarkSeen(data.Killmail.KillmailID) {
+		log.Printf("Skipping already processed killmail: ID %d", data.Killmail.KillmailID)
 		return
 	}
+	log.Printf("Processing new killmail: ID %d | Value: %.2f ISK", data.Killmail.KillmailID, data.Killmail.TotalValue)
+	deliverKillmail(q, data, deliveryOptions{})
+}
 
-	// Use a switch statement to handle different kinds of server messages.
-	switch msg.Type {
-	case "killmail":
-		// If it's a killmail, unmarshal its specific data payload.
-		var killmailData KillmailData
-		if err := json.Unmarshal(msg.Data, &killmailData); err != nil {
-			log.Printf("Error unmarshaling killmail payload: %v", err)
-			return
+// deliveryOptions adjusts deliverKillmail for callers other than the live feed.
+type deliveryOptions struct {
+	Channels   map[string]bool // When set, only these channels can receive the kill.
+	Backfilled bool            // Marks the embeds as backfilled, see backfilledEmbed.
+}
+
+// deliverKillmail queues the killmail for every matching channel it has not been posted to
+// yet, and returns how many channels that was.
+func deliverKillmail(q *DeliveryQueue, data *KillmailData, opts deliveryOptions) int {
+	// Step 1: Generate a list of topics (or "tags") for this specific killmail
+	// by calling the helper function from another file.
+	killmailTopics := generateKillmailTopics(data)
+	if !opts.Backfilled {
+		// Backfills go over kills that already happened, so only the live feed counts as received.
+		for _, topic := range killmailTopics {
+			killmailsReceived.WithLabelValues(topic).Inc()
 		}
-		// Pass the fully parsed killmail to the main processing function.
-		processAndSendKillmail(s, &killmailData)
+	}
 
-	case "info", "subscribed", "ping":
-		// Handle standard server status messages by logging them.
-		log.Printf("Received server message: type=%s", msg.Type)
+	// Step 2: Build the Discord embed for the killmail lazily, once per style and perspective,
+	// to avoid repeat work. Guilds with standings see the same kill framed from their side.
+	embeds := make(map[deliveryTarget]*discordgo.MessageEmbed)
 
-	default:
-		// Log any message types we don't currently handle, for debugging purposes.
-		log.Printf("Received unhandled type: '%s'", msg.Type)
+	// Step 3: Efficiently find matching channels. The lock is only held while matching;
+	// sending happens on the delivery queue so a slow channel can't stall the stream.
+	targets := matchKillmailChannels(data, killmailTopics)
+
+	// Step 4: Never post the same killmail to a channel twice.
+	channelIDs := make([]string, 0, len(targets))
+	for channelID := range targets {
+		if opts.Channels == nil || opts.Channels[channelID] {
+			channelIDs = append(channelIDs, channelID)
+		}
+	}
+	if killmailLedger != nil {
+		channelIDs = killmailLedger.ClaimChannels(data.Killmail.KillmailID, channelIDs)
 	}
-}
 
-// processAndSendKillmail takes parsed killmail data, finds all subscribed channels that
-// match the killmail's topics, and sends a formatted embed to them.
-func processAndSendKillmail(s *discordgo.Session, data *KillmailData) {
-	log.Printf("Processing new killmail: ID %d | Value: %.2f ISK", data.Killmail.KillmailID, data.Killmail.TotalValue)
+	for _, channelID := range channelIDs {
+		target := targets[channelID]
+		key := deliveryTarget{Style: target.Style, Perspective: target.Perspective}
+		embed, ok := embeds[key]
+		if !ok {
+			embed = buildKillmailEmbed(data, target.Style, target.Perspective)
+			if opts.Backfilled {
+				embed = backfilledEmbed(embed)
+			}
+			embeds[key] = embed
+		}
+		if target.DigestWindow > 0 && digester != nil {
+			digester.Add(channelID, target.DigestWindow, data, embed, killmailTopics)
+			continue
+		}
+		job := &deliveryJob{
+			ChannelID:  channelID,
+			KillmailID: data.Killmail.KillmailID,
+			Topics:     killmailTopics,
+			Message:    &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}},
+		}
+		if target.PodMode == podModeMerge {
+			postedLosses.Prepare(job, data, time.Now())
+			if target.MergeOnly {
+				if job.Amend == nil {
+					continue // Another pod kill of the pilot claimed the loss in the meantime.
+				}
+				job.Message = nil
+			}
+		}
+		q.Enqueue(job)
+	}
+	return len(channelIDs)
+}
 
-	// Step 1: Generate a list of topics (or "tags") for this specific killmail
-	// by calling the helper function from another file.
-	killmailTopics := generateKillmailTopics(data)
+// deliveryTarget is how a matched channel wants the killmail delivered.
+type deliveryTarget struct {
+	Style        string
+	Perspective  string // How the channel's guild sees the kill; see killPerspective.
+	DigestWindow time.Duration
+	PodMode      string
+	MergeOnly    bool // A pod kill the channel only gets to merge into the pilot's ship loss.
+}
 
-	// Step 2: Build the rich Discord embed for the killmail. This is done once to avoid repeat work.
-	embed := buildKillmailEmbed(data)
+// matchKillmailChannels returns every channel that should receive the killmail, with the
+// embed style it or its guild wants, its guild's perspective on the kill and its digest window.
+// Channels that hide pod kills are left out for capsule victims.
+func matchKillmailChannels(data *KillmailData, killmailTopics []string) map[string]deliveryTarget {
+	podKill := isPodKill(data)
 
-	// Step 3: Efficiently find matching channels and send the embed.
 	// A read-lock allows multiple killmails to be processed at the same time without data corruption.
 	mu.RLock()
 	defer mu.RUnlock()
 
-	// Iterate over each channel that has at least one subscription.
-	for channelID, subscribedTopics := range subscriptions {
-		// For each channel, check if any of its subscribed topics match the topics of this killmail.
-		for _, kmTopic := range killmailTopics {
-			// This is an efficient check to see if the key 'kmTopic' exists in the 'subscribedTopics' map.
-			if _, isSubscribed := subscribedTopics[kmTopic]; isSubscribed {
-				// A match is found! The channel is subscribed to a topic this killmail has.
-				_, err := s.ChannelMessageSendEmbed(channelID, embed)
-				if err != nil {
-					log.Printf("Failed to send killmail embed to channel %s: %v", channelID, err)
-				}
+	// A channel can match through its topics, filter, watchlist or locations, but should only get the kill once.
+	matchedChannels := make(map[string]bool)
+	checked := make(map[string]bool)
+	match := func(channelID string) {
+		if !checked[channelID] {
+			checked[channelID] = true
+			if channelFeedsMatchLocked(channelID, data, killmailTopics) {
+				matchedChannels[channelID] = true
+			}
+		}
+	}
+	for channelID := range subscriptions {
+		match(channelID)
+	}
+	for channelID := range channelFilters {
+		match(channelID)
+	}
+	for channelID := range watchlists {
+		match(channelID)
+	}
+	for channelID := range locationSubscriptions {
+		match(channelID)
+	}
+
+	// A merge-mode channel takes the pod kill of a pilot whose loss it just posted, whether or
+	// not the pod matches its feeds, but only to merge it into that loss.
+	mergeOnly := make(map[string]bool)
+	if podKill {
+		for _, channelID := range postedLosses.Channels(data.Killmail.Victim.CharacterID, time.Now()) {
+			if cfg, ok := channelConfigs[channelID]; ok && cfg.PodMode == podModeMerge && !matchedChannels[channelID] {
+				matchedChannels[channelID] = true
+				mergeOnly[channelID] = true
+			}
+		}
+	}
 
-				// Since we've found a match and sent the message, we can stop checking topics for this channel
-				// and move on to the next one. This 'break' makes the process much more efficient.
-				break
+	targets := make(map[string]deliveryTarget, len(matchedChannels))
+	perspectives := make(map[string]string) // guild ID -> perspective, worked out once per guild.
+	for channelID := range matchedChannels {
+		// Guild settings decide whether the kill is worth posting and how it looks.
+		guildID := channelGuilds[channelID]
+		cfg := defaultGuildConfig()
+		if guildCfg, ok := guildConfigs[guildID]; ok {
+			cfg = guildCfg
+		}
+		if data.Killmail.TotalValue < cfg.MinValue && !mergeOnly[channelID] {
+			continue
+		}
+		perspective, ok := perspectives[guildID]
+		if !ok {
+			perspective = killPerspective(guildStandings[guildID], data)
+			perspectives[guildID] = perspective
+		}
+		target := deliveryTarget{Style: cfg.EmbedStyle, Perspective: perspective, MergeOnly: mergeOnly[channelID]}
+		if channelCfg, ok := channelConfigs[channelID]; ok {
+			if channelCfg.SuspendedReason != "" || (podKill && channelCfg.PodMode == podModeHide) {
+				continue
+			}
+			target.DigestWindow = channelCfg.DigestWindow
+			target.PodMode = channelCfg.PodMode
+			if channelCfg.EmbedStyle != "" {
+				target.Style = channelCfg.EmbedStyle
 			}
 		}
+		targets[channelID] = target
 	}
+	return targets
+}
+
+// channelFeedsMatchLocked reports whether any of the channel's topics, its filter, its watchlist
+// or its locations pick up the killmail. Guild and channel settings, such as the minimum value,
+// are left to the caller. Callers must hold mu.
+func channelFeedsMatchLocked(channelID string, data *KillmailData, killmailTopics []string) bool {
+	// Check if any of the channel's subscribed topics match the topics of this killmail.
+	if slices.ContainsFunc(killmailTopics, func(topic string) bool { return subscriptions[channelID][topic] }) {
+		return true
+	}
+	// A custom filter expression matches when it evaluates to true.
+	if filter := channelFilters[channelID]; filter != nil && filter.Match(data, killmailTopics) {
+		return true
+	}
+	// Watchlists match when a watched character, corporation or alliance is on the right side of
+	// the kill; locations on region, constellation or jump distance from a system.
+	return watchlistMatches(watchlists[channelID], data) || locationsMatch(locationSubscriptions[channelID], data)
 }
 
 // buildKillmailEmbed is a factory function that constructs a rich Discord embed from killmail data.
-func buildKillmailEmbed(data *KillmailData) *discordgo.MessageEmbed {
+// The compact style trades the field grid for a single line, for busy channels; the detailed
+// style is built by buildDetailedKillmailEmbed. The perspective sets the title and colour.
+func buildKillmailEmbed(data *KillmailData, style, perspective string) *discordgo.MessageEmbed {
+	if style == embedStyleDetailed {
+		return buildDetailedKillmailEmbed(data, perspective)
+	}
+	title, color := killmailHeadline(data, perspective)
+
 	// Extract key figures for clarity.
 	victim := data.Killmail.Victim
 	var finalBlowAttacker struct {
@@ -103,11 +231,21 @@ func buildKillmailEmbed(data *KillmailData) *discordgo.MessageEmbed {
 		finalBlowAttacker.CorporationName = "Unknown"
 	}
 
+	if style == embedStyleCompact {
+		return &discordgo.MessageEmbed{
+			Title:       title,
+			URL:         fmt.Sprintf("https://eve-kill.com/kill/%d", data.Killmail.KillmailID),
+			Color:       color,
+			Description: fmt.Sprintf("**%s** (%s) · %s · final blow by %s", victim.CharacterName, victim.CorporationName, formatISKHuman(data.Killmail.TotalValue), finalBlowAttacker.CharacterName),
+			Timestamp:   data.Killmail.KillmailTime.Format(time.RFC3339),
+		}
+	}
+
 	// Assemble and return the complete embed structure.
 	return &discordgo.MessageEmbed{
-		Title:     fmt.Sprintf("%s destroyed in %s", victim.ShipName.En, data.Killmail.SystemName),
+		Title:     title,
 		URL:       fmt.Sprintf("https://eve-kill.com/kill/%d", data.Killmail.KillmailID),
-		Color:     0xBF2A2A, // A deep red color
+		Color:     color,
 		Timestamp: data.Killmail.KillmailTime.Format(time.RFC3339),
 		Thumbnail: &discordgo.MessageEmbedThumbnail{
 			URL: fmt.Sprintf("https://images.evetech.net/types/%d/render?size=128", victim.ShipID),
@@ -0,0 +1,68 @@
+package main
+
+import "fmt"
+
+// maxJumpRadius keeps radius subscriptions to something that is still "local".
+const maxJumpRadius = 10
+
+// maxLocationsPerChannel stops a single channel from growing an unbounded list of locations.
+const maxLocationsPerChannel = 25
+
+// LocationSubscription is a region, constellation or system a channel wants kills from.
+// Radius only applies to systems and widens the match to everything within that many jumps.
+type LocationSubscription struct {
+	Kind   string `json:"kind"` // "region", "constellation" or "system"
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Radius int    `json:"radius,omitempty"`
+}
+
+// locationSubscriptions maps a channel ID to its location subscriptions. Guarded by mu, like subscriptions.
+var locationSubscriptions = make(map[string][]LocationSubscription)
+
+var locationKindLabels = map[string]string{
+	"region":        "Region",
+	"constellation": "Constellation",
+	"system":        "System",
+}
+
+// Matches reports whether the killmail happened inside the subscribed location.
+func (l LocationSubscription) Matches(data *KillmailData) bool {
+	systemID := data.Killmail.SystemID
+	switch l.Kind {
+	case "region":
+		if data.Killmail.RegionID == l.ID {
+			return true
+		}
+		// Fall back to the static data in case the feed didn't include a region.
+		sys, err := esiClient.GetSystemDetails(systemID)
+		return err == nil && sys.RegionID == l.ID
+	case "constellation":
+		sys, err := esiClient.GetSystemDetails(systemID)
+		return err == nil && sys.ConstellationID == l.ID
+	case "system":
+		if l.Radius == 0 {
+			return systemID == l.ID
+		}
+		return esiClient.SystemsWithinJumps(l.ID, l.Radius)[systemID]
+	}
+	return false
+}
+
+// locationsMatch reports whether any of a channel's location subscriptions match the killmail.
+func locationsMatch(locations []LocationSubscription, data *KillmailData) bool {
+	for _, l := range locations {
+		if l.Matches(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeLocation renders a location subscription for /location list and confirmation messages.
+func describeLocation(l LocationSubscription) string {
+	if l.Kind == "system" && l.Radius > 0 {
+		return fmt.Sprintf("%s **%s** (`%d`) — within %d jumps", locationKindLabels[l.Kind], l.Name, l.ID, l.Radius)
+	}
+	return fmt.Sprintf("%s **%s** (`%d`)", locationKindLabels[l.Kind], l.Name, l.ID)
+}
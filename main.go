@@ -1,8 +1,8 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"os"
 	"os/signal"
@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
 )
 
@@ -21,11 +20,26 @@ var esiClient *ESIClient
 const (
 	cacheFilePath        = "esi_cache.json"
 	systemCachePath      = "systems.json"
+	shipGroupsPath       = "shipgroups.json"
+	defaultDatabasePath  = "firehawk.db"
 	killmailWebSocketURL = "wss://ws.eve-kill.com/killmails" // Correct WebSocket URL
 
 )
 
 func main() {
+	// Offline tooling runs before any bot configuration is required.
+	if len(os.Args) > 1 && os.Args[1] == "gen-sde" {
+		runGenSDE(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplay(os.Args[2:])
+		return
+	}
+
+	// The backfill mode sets up state and delivery like the bot, then exits once it is done.
+	backfillMode := len(os.Args) > 1 && os.Args[1] == "backfill"
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatalf("Error loading .env file: %v", err)
@@ -38,9 +52,16 @@ func main() {
 
 	log.Println("Bot token loaded successfully")
 	esiClient = NewESIClient("themadlyscientific@gmail.com")
-	if err := esiClient.LoadSystemCache(systemCachePath); err != nil {
+	err = esiClient.LoadSystemCache(systemCachePath)
+	if err != nil {
 		log.Printf("WARNING: could not load static system cache: %v", err)
 	}
+	health.SetStaticCache("systems", err == nil)
+	err = loadShipGroups(shipGroupsPath)
+	if err != nil {
+		log.Printf("WARNING: could not load ship groups, kills will have no ship topics: %v", err)
+	}
+	health.SetStaticCache("ship_groups", err == nil)
 	if err := esiClient.LoadCacheFromFile(cacheFilePath); err != nil {
 		log.Printf("Warning: could not load dynamic ESI cache: %v", err)
 	}
@@ -50,10 +71,58 @@ func main() {
 		log.Fatalf("Error creating Discord session: %v", err)
 	}
 
-	// In your main() function or a separate initialization function
-	loadSubscriptions()
+	dbPath := os.Getenv("FIREHAWK_DB")
+	if dbPath == "" {
+		dbPath = defaultDatabasePath
+	}
+	unlockDatabase, err := lockDatabase(dbPath)
+	if errors.Is(err, errDatabaseInUse) && backfillMode {
+		log.Fatalf("%v. Stop the bot before running a backfill, or use /backfill from Discord.", err)
+	} else if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer unlockDatabase()
+	sqlStore, err := OpenSQLiteStore(dbPath)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	store = sqlStore
+	defer store.Close()
 
+	importLegacyFiles(store)
+	if err := loadStateFromStore(store); err != nil {
+		log.Fatalf("Error loading subscriptions: %v", err)
+	}
+	if err := loadGuildsFromStore(store); err != nil {
+		log.Fatalf("Error loading guild configuration: %v", err)
+	}
+	if err := loadChannelConfigsFromStore(store); err != nil {
+		log.Fatalf("Error loading channel configuration: %v", err)
+	}
+	killmailLedger, err = NewKillmailLedger(store)
+	if err != nil {
+		log.Fatalf("Error loading seen killmails: %v", err)
+	}
+
+	janitor := newChannelJanitor(dg)
 	dg.AddHandler(interactionCreate)
+	dg.AddHandler(janitor.onChannelDelete)
+	dg.AddHandler(janitor.onGuildDelete)
+	dg.AddHandler(health.onConnect)
+	dg.AddHandler(health.onDisconnect)
+
+	deliveries = NewDeliveryQueue(dg)
+	deliveries.OnDelivered = janitor.delivered
+	deliveries.OnPermanentFailure = janitor.permanentFailure
+	publishDeliveryStats(deliveries)
+	digester = NewDigester(deliveries)
+
+	if backfillMode {
+		runBackfillCLI(os.Args[2:], deliveries)
+		digester.FlushAll()
+		deliveries.Close(2 * time.Minute)
+		return
+	}
 
 	err = dg.Open()
 	if err != nil {
@@ -62,8 +131,21 @@ func main() {
 	defer dg.Close()
 
 	// Start background services
-	go startHealthCheckServer()
-	go killmailStreamer(dg, esiClient) // Correctly start the streamer with dependencies
+	sources, err := sourcesFromEnv(esiClient)
+	if err != nil {
+		log.Fatalf("Error configuring killmail sources: %v", err)
+	}
+	publishSourceStates(sources)
+	publishSourceMetrics(sources)
+	health.SetSources(sources)
+	go startHealthCheckServer(dg, sources)
+	ctx, stopSources := context.WithCancel(context.Background())
+	defer stopSources()
+	go killmailLedger.RunPruner(ctx.Done())
+	go runKillmailSources(ctx, sources, func(data *KillmailData) {
+		processAndSendKillmail(deliveries, data)
+	})
+	go backfillChannelGuilds(dg)
 
 	// Register commands after the bot is running
 	log.Println("Registering Commands")
@@ -79,80 +161,38 @@ func main() {
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	<-sc
 
-	log.Println("Shutting down bot. Saving cache...")
+	log.Println("Shutting down bot. Flushing queued messages...")
+	stopSources()
+	digester.FlushAll()
+	deliveries.Close(10 * time.Second)
+
+	log.Println("Saving cache...")
 	if err := esiClient.SaveCacheToFile(cacheFilePath); err != nil {
 		log.Printf("Error saving ESI cache: %v", err)
 	}
 }
 
-func killmailStreamer(s *discordgo.Session, esi *ESIClient) {
-	log.Println("Kicking off web socket connection")
-
-	for { // Main reconnection loop
-		conn, _, err := websocket.DefaultDialer.Dial(killmailWebSocketURL, nil)
-		if err != nil {
-			log.Printf("Error connecting to WebSocket: %v", err)
-			time.Sleep(10 * time.Second)
-			continue
-		}
-		log.Println("Web socket connected - streaming messages.")
-
-		// Handles low-level protocol pings to keep the connection alive.
-		pongWait := 60 * time.Second
-		conn.SetReadDeadline(time.Now().Add(pongWait))
-		conn.SetPongHandler(func(string) error {
-			conn.SetReadDeadline(time.Now().Add(pongWait))
-			return nil
-		})
-
-		if err := conn.WriteMessage(websocket.TextMessage, []byte("all")); err != nil {
-			log.Printf("Error subscribing to killmail feed: %v", err)
-			conn.Close()
-			continue
-		}
-		log.Println("Subscribed to 'all' killmails topic, filters will apply accordingly.")
-
-		for { // Message reading loop
-			_, message, err := conn.ReadMessage()
-			if err != nil {
-				log.Println("Read error, disconnecting:", err)
-				break
-			}
-
-			conn.SetReadDeadline(time.Now().Add(pongWait))
-
-			// Handles application-level pings by echoing the timestamp in a JSON reply.
-			var msg SocketMessage
-			if err := json.Unmarshal(message, &msg); err == nil && msg.Type == "ping" {
-				var pingMsg PingMessage
-				if err := json.Unmarshal(message, &pingMsg); err == nil {
-					log.Println("Recieved Ping, responding with Pong")
-
-					pongReply := fmt.Sprintf(`{"type":"pong","timestamp":"%s"}`, pingMsg.Timestamp)
-
-					if err := conn.WriteMessage(websocket.TextMessage, []byte(pongReply)); err != nil {
-						log.Printf("Error sending application pong: %v", err)
-					}
-				}
-				continue // Don't process this ping message any further.
-			}
-
-			// If it's not a ping, pass it to the killmail handler.
-			msgCopy := make([]byte, len(message))
-			copy(msgCopy, message)
-			go HandleKillmailMessage(s, msgCopy)
-		}
-
-		conn.Close()
-		log.Println("Disconnected. Attempting to reconnect...")
-	}
-}
-
 // interactionCreate is the handler for all slash command interactions.
 func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	if i.Type == discordgo.InteractionApplicationCommand {
-		if handler, ok := commandHandlers[i.ApplicationCommandData().Name]; ok {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		name := i.ApplicationCommandData().Name
+		if handler, ok := commandHandlers[name]; ok {
+			commandInvocations.WithLabelValues(name).Inc()
+			if !checkCommandPermission(i, name) {
+				denyCommand(s, i, name)
+				return
+			}
 			handler(s, i)
+			if commandPermissionLevels[name] == permissionFeedManager {
+				signalTopicsChanged() // The command may have changed which upstream topics feeds need.
+			}
+		}
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		// Only the topic options autocomplete. Suggestions reveal nothing, so no permission check.
+		switch i.ApplicationCommandData().Name {
+		case "subscribe", "unsubscribe":
+			autocompleteTopic(s, i)
 		}
 	}
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics, served at /metrics on the health-check port. /debug/vars keeps the
+// expvar snapshots for quick looks; these are for dashboards.
+var (
+	killmailsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "firehawk_killmails_received_total",
+		Help: "New killmails processed, by killmail topic. A kill counts once for each of its topics.",
+	}, []string{"topic"})
+
+	killmailsDelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "firehawk_killmails_delivered_total",
+		Help: "Killmail messages posted to Discord channels, by killmail topic.",
+	}, []string{"topic"})
+
+	esiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "firehawk_esi_requests_total",
+		Help: "ESI requests, by endpoint and HTTP status (\"error\" when there was no response).",
+	}, []string{"endpoint", "status"})
+
+	esiRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "firehawk_esi_request_duration_seconds",
+		Help:    "ESI request latency, by endpoint.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 8), // 50ms to 6.4s.
+	}, []string{"endpoint"})
+
+	esiCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "firehawk_esi_cache_lookups_total",
+		Help: "ESIClient cache lookups, by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	esiErrorLimitRemain = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "firehawk_esi_error_limit_remain",
+		Help: "Errors ESI will still accept in the current window before banning the IP, from X-ESI-Error-Limit-Remain.",
+	})
+
+	discordSendFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "firehawk_discord_send_failures_total",
+		Help: "Failed Discord posts and edits, by Discord error code, HTTP status, \"rate_limited\" or \"network\".",
+	}, []string{"code"})
+
+	commandInvocations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "firehawk_command_invocations_total",
+		Help: "Slash command invocations, by command name.",
+	}, []string{"command"})
+)
+
+// publishSourceMetrics exposes each source's reconnect count, read from its state on scrape.
+func publishSourceMetrics(sources []KillmailSource) {
+	for _, src := range sources {
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "firehawk_source_reconnects_total",
+			Help:        "Reconnects of a killmail source's upstream connection.",
+			ConstLabels: prometheus.Labels{"source": src.Name()},
+		}, func() float64 { return float64(src.State().Reconnects) })
+	}
+}
+
+// countCacheLookup records a hit or miss on one of the ESIClient caches.
+func countCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	esiCacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// esiIDSegment matches the IDs in ESI paths, so every type or character shares one endpoint label.
+var esiIDSegment = regexp.MustCompile(`/\d+(/|$)`)
+
+// esiEndpoint turns a request URL into a low-cardinality label, e.g. "/universe/types/{id}/".
+func esiEndpoint(baseURL, url string) string {
+	path, _, _ := strings.Cut(strings.TrimPrefix(url, baseURL), "?")
+	for esiIDSegment.MatchString(path) {
+		path = esiIDSegment.ReplaceAllString(path, "/{id}$1")
+	}
+	return path
+}
+
+// observeESIRequest records one ESI request. resp is nil when the request failed outright.
+func observeESIRequest(endpoint string, resp *http.Response, started time.Time) {
+	status := "error"
+	if resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	esiRequests.WithLabelValues(endpoint, status).Inc()
+	esiRequestDuration.WithLabelValues(endpoint).Observe(time.Since(started).Seconds())
+}
+
+// countDiscordFailure records a failed Discord send under the most specific code available.
+func countDiscordFailure(err error) {
+	discordSendFailures.WithLabelValues(discordFailureCode(err)).Inc()
+}
+
+// discordFailureCode labels a failed Discord send: its Discord error code, else its HTTP status,
+// else "rate_limited" or "network".
+func discordFailureCode(err error) string {
+	var rateLimited *discordgo.RateLimitError
+	var restErr *discordgo.RESTError
+	switch {
+	case errors.As(err, &rateLimited):
+		return "rate_limited"
+	case discordErrorCode(err) != 0:
+		return strconv.Itoa(discordErrorCode(err))
+	case errors.As(err, &restErr) && restErr.Response != nil:
+		return strconv.Itoa(restErr.Response.StatusCode)
+	}
+	return "network"
+}
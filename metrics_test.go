@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestESIEndpoint(t *testing.T) {
+	const base = "https://esi.evetech.net/latest"
+	for _, tc := range []struct {
+		url, want string
+	}{
+		{base + "/universe/types/587/", "/universe/types/{id}/"},
+		{base + "/characters/90000001/", "/characters/{id}/"},
+		{base + "/universe/names/", "/universe/names/"},
+		{base + "/killmails/123/abcdef/", "/killmails/{id}/abcdef/"},
+		{base + "/characters/1/2/3/", "/characters/{id}/{id}/{id}/"},    // Consecutive IDs.
+		{base + "/universe/systems/30000142", "/universe/systems/{id}"}, // A trailing ID.
+		{base + "/status/?datasource=tranquility&vip", "/status/"},
+		{base + "/universe/types/587/?language=en", "/universe/types/{id}/"},
+		{base + "/universe/v2587/", "/universe/v2587/"}, // Only whole segments are IDs.
+		{"/characters/5/", "/characters/{id}/"},         // Already relative.
+	} {
+		if got := esiEndpoint(base, tc.url); got != tc.want {
+			t.Errorf("esiEndpoint(%q) = %q, want %q", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestDiscordFailureCode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"rate limited", &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{}}, "rate_limited"},
+		{"Discord code", restError(http.StatusNotFound, discordgo.ErrCodeUnknownChannel), "10003"},
+		{"wrapped Discord code", fmt.Errorf("send: %w", restError(http.StatusForbidden, discordgo.ErrCodeMissingAccess)), "50001"},
+		{"HTTP status", restError(http.StatusBadGateway, 0), "502"},
+		{"no response", &discordgo.RESTError{}, "network"},
+		{"network", &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}, "network"},
+	} {
+		if got := discordFailureCode(tc.err); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
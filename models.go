@@ -16,45 +16,148 @@ type PingMessage struct {
 	Timestamp string `json:"timestamp"`
 }
 
+// KillmailData is the normalized killmail every KillmailSource emits. Its JSON shape is
+// eve-kill's, so that feed decodes straight into it; other sources convert into it.
 type KillmailData struct {
-	// This outer 'killmail' object was the missing layer in your previous struct.
-	Killmail struct {
-		KillmailID     int       `json:"killmail_id"`
-		KillmailTime   time.Time `json:"kill_time"`
-		SystemID       int       `json:"system_id"`
-		SystemName     string    `json:"system_name"`
-		SystemSecurity float64   `json:"system_security"` // <-- Needed for high/low/null
-		RegionID       int       `json:"region_id"`       // <-- NEW: For w-space/abyssal
-		TotalValue     float64   `json:"total_value"`
-		IsNpc          bool      `json:"is_npc"`
-		IsSolo         bool      `json:"is_solo"`
-		RegionName     struct {
-			En string `json:"en"`
-		} `json:"region_name"`
-		Victim struct {
-			CharacterID     int    `json:"character_id"`
-			CharacterName   string `json:"character_name"`
-			CorporationID   int    `json:"corporation_id"`
-			CorporationName string `json:"corporation_name"`
-			ShipID          int    `json:"ship_id"`
-			ShipGroupID     int    `json:"ship_group_id"` // <-- NEW: For ship classes
-			ShipName        struct {
-				En string `json:"en"`
-			} `json:"ship_name"`
-		} `json:"victim"`
-		Attackers []struct {
-			CharacterID     int    `json:"character_id"`
-			CharacterName   string `json:"character_name"`
-			CorporationID   int    `json:"corporation_id"`
-			CorporationName string `json:"corporation_name"`
-			ShipID          int    `json:"ship_id"`
-			ShipName        struct {
-				En string `json:"en"`
-			} `json:"ship_name"`
-			FinalBlow bool `json:"final_blow"`
-		} `json:"attackers"`
-	} `json:"killmail"` // This is the key for the nested object.
-
-	// These fields are at the top level, outside the 'killmail' object.
+	Killmail Killmail `json:"killmail"`
+}
+
+type Killmail struct {
+	KillmailID     int                `json:"killmail_id"`
+	KillmailTime   time.Time          `json:"kill_time"`
+	SystemID       int                `json:"system_id"`
+	SystemName     string             `json:"system_name"`
+	SystemSecurity float64            `json:"system_security"` // <-- Needed for high/low/null
+	RegionID       int                `json:"region_id"`       // <-- NEW: For w-space/abyssal
+	TotalValue     float64            `json:"total_value"`
+	IsNpc          bool               `json:"is_npc"`
+	IsSolo         bool               `json:"is_solo"`
+	RegionName     LocalizedName      `json:"region_name"`
+	DroppedValue   float64            `json:"dropped_value"`   // Zero when the source doesn't split the value.
+	DestroyedValue float64            `json:"destroyed_value"` // See Killmail.ValueSplit.
+	Victim         KillmailVictim     `json:"victim"`
+	Attackers      []KillmailAttacker `json:"attackers"`
+	Items          []KillmailItem     `json:"items"`
+}
+
+type LocalizedName struct {
+	En string `json:"en"`
+}
+
+type KillmailVictim struct {
+	CharacterID     int           `json:"character_id"`
+	CharacterName   string        `json:"character_name"`
+	CorporationID   int           `json:"corporation_id"`
+	CorporationName string        `json:"corporation_name"`
+	AllianceID      int           `json:"alliance_id"`
+	AllianceName    string        `json:"alliance_name"`
+	ShipID          int           `json:"ship_id"`
+	ShipGroupID     int           `json:"ship_group_id"` // <-- NEW: For ship classes
+	ShipName        LocalizedName `json:"ship_name"`
+	DamageTaken     int           `json:"damage_taken"`
+}
+
+type KillmailAttacker struct {
+	CharacterID     int           `json:"character_id"`
+	CharacterName   string        `json:"character_name"`
+	CorporationID   int           `json:"corporation_id"`
+	CorporationName string        `json:"corporation_name"`
+	AllianceID      int           `json:"alliance_id"`
+	AllianceName    string        `json:"alliance_name"`
+	ShipID          int           `json:"ship_id"`
+	ShipName        LocalizedName `json:"ship_name"`
+	ShipGroupID     int           `json:"ship_group_id"`
+	WeaponTypeID    int           `json:"weapon_type_id"`
+	WeaponTypeName  LocalizedName `json:"weapon_type_name"`
+	SecurityStatus  float64       `json:"security_status"`
+	DamageDone      int           `json:"damage_done"`
+	FinalBlow       bool          `json:"final_blow"`
+}
+
+// KillmailItem is one stack of items on the victim's ship. Flag is the inventory slot it was
+// in; containers carry their contents in Items. Value is per unit and is only known when the
+// source prices items, which eve-kill does and zKillboard does not.
+type KillmailItem struct {
+	TypeID       int            `json:"type_id"`
+	TypeName     LocalizedName  `json:"name"`
+	GroupID      int            `json:"group_id"`
+	Flag         int            `json:"flag"`
+	QtyDropped   int            `json:"qty_dropped"`
+	QtyDestroyed int            `json:"qty_destroyed"`
+	Singleton    int            `json:"singleton"`
+	Value        float64        `json:"value"`
+	Items        []KillmailItem `json:"items"`
+}
+
+// --- zKillboard ---
+
+// ESIKillmail is a killmail as ESI (and therefore zKillboard) returns it: IDs only, no names.
+type ESIKillmail struct {
+	KillmailID    int       `json:"killmail_id"`
+	KillmailTime  time.Time `json:"killmail_time"`
+	SolarSystemID int       `json:"solar_system_id"`
+	Victim        struct {
+		CharacterID   int               `json:"character_id"`
+		CorporationID int               `json:"corporation_id"`
+		AllianceID    int               `json:"alliance_id"`
+		ShipTypeID    int               `json:"ship_type_id"`
+		DamageTaken   int               `json:"damage_taken"`
+		Items         []ESIKillmailItem `json:"items"`
+	} `json:"victim"`
+	Attackers []struct {
+		CharacterID    int     `json:"character_id"`
+		CorporationID  int     `json:"corporation_id"`
+		AllianceID     int     `json:"alliance_id"`
+		ShipTypeID     int     `json:"ship_type_id"`
+		WeaponTypeID   int     `json:"weapon_type_id"`
+		SecurityStatus float64 `json:"security_status"`
+		DamageDone     int     `json:"damage_done"`
+		FinalBlow      bool    `json:"final_blow"`
+	} `json:"attackers"`
+}
+
+// ESIKillmailItem is an item on an ESI killmail. Containers nest their contents.
+type ESIKillmailItem struct {
+	ItemTypeID        int               `json:"item_type_id"`
+	Flag              int               `json:"flag"`
+	QuantityDropped   int               `json:"quantity_dropped"`
+	QuantityDestroyed int               `json:"quantity_destroyed"`
+	Singleton         int               `json:"singleton"`
+	Items             []ESIKillmailItem `json:"items"`
+}
+
+// ZKBMeta is zKillboard's own data about a kill.
+type ZKBMeta struct {
+	LocationID     int     `json:"locationID"`
+	Hash           string  `json:"hash"`
+	TotalValue     float64 `json:"totalValue"`
+	FittedValue    float64 `json:"fittedValue"`
+	DroppedValue   float64 `json:"droppedValue"`
+	DestroyedValue float64 `json:"destroyedValue"`
+	NPC            bool    `json:"npc"`
+	Solo           bool    `json:"solo"`
+}
+
+// RedisQResponse is a reply from zKillboard's RedisQ listen endpoint. Package is null when no
+// kill arrived before the wait time ran out.
+type RedisQResponse struct {
+	Package *struct {
+		KillID   int         `json:"killID"`
+		Killmail ESIKillmail `json:"killmail"`
+		ZKB      ZKBMeta     `json:"zkb"`
+	} `json:"package"`
+}
+
+// R2Z2Killmail is one numbered file from zKillboard's R2Z2 feed.
+type R2Z2Killmail struct {
+	KillmailID int         `json:"killmail_id"`
+	Hash       string      `json:"hash"`
+	ESI        ESIKillmail `json:"esi"`
+	ZKB        ZKBMeta     `json:"zkb"`
+	SequenceID int64       `json:"sequence_id"`
+}
 
+// R2Z2Sequence is R2Z2's pointer to the newest numbered file.
+type R2Z2Sequence struct {
+	Sequence int64 `json:"sequence"`
 }
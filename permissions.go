@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// permissionLevel is how much trust a slash command needs.
+type permissionLevel int
+
+const (
+	permissionEveryone      permissionLevel = iota
+	permissionFeedManager                   // Manage Channels, or one of the guild's manager roles.
+	permissionServerManager                 // Manage Server or Administrator.
+)
+
+// commandPermissionLevels lists the commands that change state. Anything not listed is open to everyone.
+var commandPermissionLevels = map[string]permissionLevel{
+	"subscribe":   permissionFeedManager,
+	"unsubscribe": permissionFeedManager,
+	"filter":      permissionFeedManager,
+	"watch":       permissionFeedManager,
+	"location":    permissionFeedManager,
+	"feed":        permissionFeedManager,
+	"config":      permissionServerManager,
+	"standings":   permissionServerManager,
+	"backfill":    permissionServerManager,
+}
+
+// AuditEntry is a single recorded change to a guild's feeds or settings.
+type AuditEntry struct {
+	Time      time.Time
+	GuildID   string
+	ChannelID string
+	UserID    string
+	UserName  string
+	Action    string
+	Detail    string
+}
+
+// checkCommandPermission reports whether the invoking member may run the command.
+// Discord already hides commands via DefaultMemberPermissions, but server admins can
+// override that in their integration settings, so we always check again here.
+func checkCommandPermission(i *discordgo.InteractionCreate, command string) bool {
+	level := commandPermissionLevels[command]
+	if level == permissionEveryone {
+		return true
+	}
+	if i.Member == nil {
+		return false // Managed commands only make sense inside a server.
+	}
+
+	// Member.Permissions is computed by Discord for the channel the command was used in. A
+	// command aimed at another channel is checked again there by resolveFeedChannel.
+	perms := i.Member.Permissions
+	if perms&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) != 0 {
+		return true
+	}
+	if level == permissionServerManager {
+		return false
+	}
+	if perms&discordgo.PermissionManageChannels != 0 {
+		return true
+	}
+
+	return hasManagerRole(i.GuildID, i.Member.Roles)
+}
+
+// hasManagerRole reports whether any of the roles is one of the guild's manager roles.
+func hasManagerRole(guildID string, roles []string) bool {
+	cfg := getGuildConfig(guildID)
+	for _, roleID := range roles {
+		if slices.Contains(cfg.ManagerRoles, roleID) {
+			return true
+		}
+	}
+	return false
+}
+
+// canManageFeedChannel reports whether the invoking member may manage the feed in channel. A
+// command's channel option can point anywhere in the guild, while checkCommandPermission only
+// saw Manage Channels in the channel the command was used in, so for any other channel it is
+// worked out again from the state. Manage Server, Administrator and manager roles cover every
+// channel.
+func canManageFeedChannel(state *discordgo.State, i *discordgo.InteractionCreate, channel *discordgo.Channel) bool {
+	if i.Member == nil || i.Member.User == nil {
+		return false
+	}
+	perms := i.Member.Permissions
+	if perms&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) != 0 || hasManagerRole(i.GuildID, i.Member.Roles) {
+		return true
+	}
+	if channel.ID != i.ChannelID {
+		// Firehawk doesn't request the members intent, so the interaction's copy of the member
+		// is put in the state for the permission calculation.
+		member := *i.Member
+		member.GuildID = i.GuildID
+		var err error
+		if err = state.MemberAdd(&member); err == nil {
+			perms, err = state.UserChannelPermissions(member.User.ID, channel.ID)
+		}
+		if err != nil {
+			log.Printf("Could not work out %s's permissions in channel %s: %v", member.User.ID, channel.ID, err)
+			return false
+		}
+	}
+	return perms&discordgo.PermissionManageChannels != 0
+}
+
+// denyCommand tells the member they can't run the command, only visible to them.
+func denyCommand(s *discordgo.Session, i *discordgo.InteractionCreate, command string) {
+	var content string
+	if commandPermissionLevels[command] == permissionServerManager {
+		content = "⛔ You need the **Manage Server** permission to use this command."
+	} else {
+		content = "⛔ You need the **Manage Channels** permission or a Firehawk manager role to use this command. Ask a server admin to add your role with `/config add-role`."
+	}
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: content, Flags: discordgo.MessageFlagsEphemeral},
+	})
+	recordAudit(i, "", "denied", fmt.Sprintf("/%s", command))
+}
+
+// interactionUser returns whoever triggered an interaction, in a guild or a DM.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	if i.User != nil {
+		return i.User
+	}
+	return &discordgo.User{}
+}
+
+// recordAudit writes a change to the audit log in the store and to the process log.
+func recordAudit(i *discordgo.InteractionCreate, channelID, action, detail string) {
+	user := interactionUser(i)
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		GuildID:   i.GuildID,
+		ChannelID: channelID,
+		UserID:    user.ID,
+		UserName:  user.Username,
+		Action:    action,
+		Detail:    detail,
+	}
+	log.Printf("AUDIT: guild=%s channel=%s user=%s (%s) action=%s %s", entry.GuildID, entry.ChannelID, entry.UserName, entry.UserID, entry.Action, entry.Detail)
+	if err := store.AppendAudit(entry); err != nil {
+		log.Printf("Failed to write audit log entry: %v", err)
+	}
+}
+
+// recordSystemAudit writes a change Firehawk made on its own, such as cleaning up a dead channel.
+func recordSystemAudit(guildID, channelID, action, detail string) {
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		GuildID:   guildID,
+		ChannelID: channelID,
+		UserName:  "Firehawk",
+		Action:    action,
+		Detail:    detail,
+	}
+	log.Printf("AUDIT: guild=%s channel=%s user=Firehawk action=%s %s", entry.GuildID, entry.ChannelID, entry.Action, entry.Detail)
+	if err := store.AppendAudit(entry); err != nil {
+		log.Printf("Failed to write audit log entry: %v", err)
+	}
+}
+
+// describeAuditLog renders recent entries for /config audit.
+func describeAuditLog(entries []AuditEntry) string {
+	if len(entries) == 0 {
+		return "📜 No changes have been recorded for this server yet."
+	}
+	var b strings.Builder
+	b.WriteString("📜 **Recent changes**\n")
+	for _, e := range entries {
+		who := fmt.Sprintf("<@%s>", e.UserID)
+		if e.UserID == "" {
+			who = "**" + e.UserName + "**"
+		}
+		line := fmt.Sprintf("• <t:%d:R> %s `%s` %s", e.Time.Unix(), who, e.Action, e.Detail)
+		if e.ChannelID != "" {
+			line += fmt.Sprintf(" in <#%s>", e.ChannelID)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// permissionTestInteraction is a command run in channel c1 of guild g1, or in a DM when perms
+// is negative.
+func permissionTestInteraction(command string, perms int64, roles ...string) *discordgo.InteractionCreate {
+	i := &discordgo.Interaction{
+		Type:      discordgo.InteractionApplicationCommand,
+		GuildID:   "g1",
+		ChannelID: "c1",
+		Data:      discordgo.ApplicationCommandInteractionData{Name: command},
+	}
+	if perms < 0 {
+		i.GuildID = ""
+		i.User = &discordgo.User{ID: "u1"}
+	} else {
+		i.Member = &discordgo.Member{User: &discordgo.User{ID: "u1"}, Roles: roles, Permissions: perms}
+	}
+	return &discordgo.InteractionCreate{Interaction: i}
+}
+
+func TestCheckCommandPermission(t *testing.T) {
+	useAdminState(t)
+	guildConfigs["g1"] = &GuildConfig{ManagerRoles: []string{"firehawk-managers"}}
+
+	for _, tc := range []struct {
+		name    string
+		command string
+		perms   int64
+		roles   []string
+		want    bool
+	}{
+		{"everyone, no permissions", "help", 0, nil, true},
+		{"everyone, in a DM", "help", -1, nil, true},
+		{"feed, no permissions", "subscribe", discordgo.PermissionSendMessages, nil, false},
+		{"feed, Manage Channels", "subscribe", discordgo.PermissionManageChannels, nil, true},
+		{"feed, manager role", "watch", 0, []string{"other", "firehawk-managers"}, true},
+		{"feed, another role", "watch", 0, []string{"other"}, false},
+		{"feed, Manage Server", "filter", discordgo.PermissionManageGuild, nil, true},
+		{"feed, Administrator", "unsubscribe", discordgo.PermissionAdministrator, nil, true},
+		{"feed, in a DM", "subscribe", -1, nil, false},
+		{"server, Manage Channels", "config", discordgo.PermissionManageChannels, nil, false},
+		{"server, manager role", "standings", 0, []string{"firehawk-managers"}, false},
+		{"server, Manage Server", "config", discordgo.PermissionManageGuild, nil, true},
+		{"server, Administrator", "backfill", discordgo.PermissionAdministrator, nil, true},
+		{"server, in a DM", "config", -1, nil, false},
+	} {
+		i := permissionTestInteraction(tc.command, tc.perms, tc.roles...)
+		if got := checkCommandPermission(i, tc.command); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// The channel option can name any channel in the guild, so Manage Channels has to hold there,
+// not just where the command was typed.
+func TestCanManageFeedChannel(t *testing.T) {
+	useAdminState(t)
+	guildConfigs["g1"] = &GuildConfig{ManagerRoles: []string{"firehawk-managers"}}
+
+	state := discordgo.NewState()
+	state.GuildAdd(&discordgo.Guild{ID: "g1", OwnerID: "owner", Roles: []*discordgo.Role{
+		{ID: "g1", Permissions: discordgo.PermissionViewChannel},
+		{ID: "mods", Permissions: discordgo.PermissionManageChannels},
+		{ID: "firehawk-managers"},
+	}})
+	c1 := &discordgo.Channel{ID: "c1", GuildID: "g1", Type: discordgo.ChannelTypeGuildText}
+	open := &discordgo.Channel{ID: "open", GuildID: "g1", Type: discordgo.ChannelTypeGuildText}
+	locked := &discordgo.Channel{ID: "locked", GuildID: "g1", Type: discordgo.ChannelTypeGuildText, PermissionOverwrites: []*discordgo.PermissionOverwrite{
+		{ID: "mods", Type: discordgo.PermissionOverwriteTypeRole, Deny: discordgo.PermissionManageChannels},
+	}}
+	for _, c := range []*discordgo.Channel{c1, open, locked} {
+		state.ChannelAdd(c)
+	}
+	// The channel Firehawk's state doesn't know about can't be checked.
+	unknown := &discordgo.Channel{ID: "unknown", GuildID: "g1", Type: discordgo.ChannelTypeGuildText}
+
+	for _, tc := range []struct {
+		name    string
+		perms   int64
+		roles   []string
+		channel *discordgo.Channel
+		want    bool
+	}{
+		{"Manage Channels where the command was used", discordgo.PermissionManageChannels, nil, c1, true},
+		{"no Manage Channels where the command was used", 0, []string{"mods"}, c1, false},
+		{"a mod in another channel", discordgo.PermissionManageChannels, []string{"mods"}, open, true},
+		{"a mod in a channel they are denied", discordgo.PermissionManageChannels, []string{"mods"}, locked, false},
+		{"a channel override without the role", discordgo.PermissionManageChannels, nil, open, false},
+		{"a channel missing from the state", discordgo.PermissionManageChannels, []string{"mods"}, unknown, false},
+		{"manager role", 0, []string{"firehawk-managers"}, locked, true},
+		{"Manage Server", discordgo.PermissionManageGuild, nil, locked, true},
+		{"Administrator", discordgo.PermissionAdministrator, nil, unknown, true},
+		{"in a DM", -1, nil, open, false},
+	} {
+		i := permissionTestInteraction("subscribe", tc.perms, tc.roles...)
+		if got := canManageFeedChannel(state, i, tc.channel); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// podMergeWindow is how long after a ship loss a pod kill of the same pilot is merged into it.
+// Pods usually die within seconds of their ship; a few minutes covers a warp-off and a chase.
+const podMergeWindow = 5 * time.Minute
+
+// Pod modes, set per channel with /feed pods. The empty default posts pod kills like any other.
+const (
+	podModeShow  = ""
+	podModeHide  = "hide"  // Pod kills are not posted.
+	podModeMerge = "merge" // Pod kills edit the pilot's recent ship loss instead of being posted.
+)
+
+var podModeChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Show", Value: "show"}, {Name: "Hide", Value: podModeHide}, {Name: "Merge into the ship loss", Value: podModeMerge},
+}
+
+// podModeDescriptions renders each mode for /feed view and confirmation messages.
+var podModeDescriptions = map[string]string{
+	podModeShow:  "*posted*",
+	podModeHide:  "*hidden*",
+	podModeMerge: "*merged into the pilot's ship loss*",
+}
+
+// isPodKill reports whether the victim was in a capsule.
+func isPodKill(data *KillmailData) bool {
+	group, ok := shipGroups[data.Killmail.Victim.ShipGroupID]
+	return ok && group.Class == "pods"
+}
+
+// postedLoss is a ship loss posted to a merge-mode channel that a pod kill may still attach to.
+type postedLoss struct {
+	characterID int
+	embed       *discordgo.MessageEmbed
+	messageID   string // Empty until the delivery queue has posted it.
+	podded      bool
+	postedAt    time.Time
+}
+
+// PostedLosses remembers recent ship losses per channel, with the Discord message each became,
+// so a pod kill can be merged into the right message. Entries older than the window are pruned
+// as new losses come in.
+type PostedLosses struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	byChannel map[string][]*postedLoss // Oldest first.
+}
+
+// postedLosses is the process-wide tracker; merge-mode channels are the only ones recorded.
+var postedLosses = NewPostedLosses(podMergeWindow)
+
+// NewPostedLosses creates an empty tracker.
+func NewPostedLosses(window time.Duration) *PostedLosses {
+	return &PostedLosses{window: window, byChannel: make(map[string][]*postedLoss)}
+}
+
+// Prepare wires a delivery job for a merge-mode channel. Ship losses are recorded, and learn
+// their message ID once posted. A pod kill of a pilot whose loss is recorded becomes an edit of
+// that message; if the loss never made it out, the pod kill is posted on its own after all.
+func (p *PostedLosses) Prepare(job *deliveryJob, data *KillmailData, now time.Time) {
+	victim := data.Killmail.Victim
+	if victim.CharacterID == 0 {
+		return
+	}
+	if !isPodKill(data) {
+		loss := p.record(job.ChannelID, victim.CharacterID, job.Message.Embeds[0], now)
+		job.OnSent = func(messageID string) { p.setMessageID(loss, messageID) }
+		return
+	}
+	loss := p.claim(job.ChannelID, victim.CharacterID, now)
+	if loss == nil {
+		return
+	}
+	job.Amend = func() (string, []*discordgo.MessageEmbed, bool) {
+		p.mu.Lock()
+		messageID, embed := loss.messageID, loss.embed
+		p.mu.Unlock()
+		if messageID == "" {
+			return "", nil, false
+		}
+		return messageID, []*discordgo.MessageEmbed{poddedEmbed(embed, data)}, true
+	}
+}
+
+// Channels returns the channels holding an unpodded loss of the pilot within the window. A pod
+// kill merges into those even when it matches none of the channel's feeds.
+func (p *PostedLosses) Channels(characterID int, now time.Time) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var channels []string
+	for channelID, losses := range p.byChannel {
+		for _, loss := range losses {
+			if loss.characterID == characterID && !loss.podded && now.Sub(loss.postedAt) <= p.window {
+				channels = append(channels, channelID)
+				break
+			}
+		}
+	}
+	return channels
+}
+
+// record adds a posted ship loss for the channel.
+func (p *PostedLosses) record(channelID string, characterID int, embed *discordgo.MessageEmbed, now time.Time) *postedLoss {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Sweep every channel, so ones that went quiet or lost their feed don't hold on to entries.
+	for id := range p.byChannel {
+		p.prune(id, now)
+	}
+	loss := &postedLoss{characterID: characterID, embed: embed, postedAt: now}
+	p.byChannel[channelID] = append(p.byChannel[channelID], loss)
+	return loss
+}
+
+func (p *PostedLosses) setMessageID(loss *postedLoss, messageID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	loss.messageID = messageID
+}
+
+// claim returns the pilot's most recent unpodded loss in the channel and marks it podded, so a
+// second pod kill (a clone jump and another death) is posted on its own.
+func (p *PostedLosses) claim(channelID string, characterID int, now time.Time) *postedLoss {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	losses := p.prune(channelID, now)
+	for i := len(losses) - 1; i >= 0; i-- {
+		if losses[i].characterID == characterID && !losses[i].podded {
+			losses[i].podded = true
+			return losses[i]
+		}
+	}
+	return nil
+}
+
+// prune drops the channel's losses that are past the window and returns what is left.
+// The caller must hold p.mu.
+func (p *PostedLosses) prune(channelID string, now time.Time) []*postedLoss {
+	losses := p.byChannel[channelID]
+	i := 0
+	for i < len(losses) && now.Sub(losses[i].postedAt) > p.window {
+		i++
+	}
+	losses = losses[i:]
+	if len(losses) == 0 {
+		delete(p.byChannel, channelID)
+		return nil
+	}
+	p.byChannel[channelID] = losses
+	return losses
+}
+
+// poddedEmbed returns a copy of a ship loss embed with the pod kill added to it.
+func poddedEmbed(loss *discordgo.MessageEmbed, pod *KillmailData) *discordgo.MessageEmbed {
+	embed := *loss
+	embed.Title += " — and podded"
+	podURL := fmt.Sprintf("https://eve-kill.com/kill/%d", pod.Killmail.KillmailID)
+	if embed.Description != "" {
+		// The compact style has no fields, so the pod goes on its one line.
+		embed.Description += fmt.Sprintf(" · [podded](%s)", podURL)
+		return &embed
+	}
+	embed.Fields = append(append([]*discordgo.MessageEmbedField(nil), loss.Fields...), &discordgo.MessageEmbedField{
+		Name:   "Podded",
+		Value:  fmt.Sprintf("[%s](%s) · %s", pod.Killmail.Victim.ShipName.En, podURL, formatISKHuman(pod.Killmail.TotalValue)),
+		Inline: true,
+	})
+	return &embed
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Ship group 25 is Frigate, 29 Capsule.
+func podTestKill(killmailID, characterID, groupID int) *KillmailData {
+	data := &KillmailData{}
+	data.Killmail.KillmailID = killmailID
+	data.Killmail.Victim.CharacterID = characterID
+	data.Killmail.Victim.ShipGroupID = groupID
+	data.Killmail.Victim.ShipName.En = "Ship " + strconv.Itoa(killmailID)
+	return data
+}
+
+func podTestJob(channelID string, data *KillmailData) *deliveryJob {
+	embed := &discordgo.MessageEmbed{Title: "Kill " + strconv.Itoa(data.Killmail.KillmailID), Fields: []*discordgo.MessageEmbedField{{Name: "Victim"}}}
+	return &deliveryJob{ChannelID: channelID, KillmailID: data.Killmail.KillmailID, Message: &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}}
+}
+
+func TestPostedLossesMergesPodKill(t *testing.T) {
+	useFeedState(t)
+	p := NewPostedLosses(time.Minute)
+	now := time.Now()
+
+	loss := podTestJob("c1", podTestKill(1, 7, 25))
+	p.Prepare(loss, podTestKill(1, 7, 25), now)
+	pod := podTestJob("c1", podTestKill(2, 7, 29))
+	p.Prepare(pod, podTestKill(2, 7, 29), now)
+	if loss.OnSent == nil || pod.Amend == nil {
+		t.Fatal("the loss and its pod kill were not wired together")
+	}
+
+	// Until the loss is posted there is nothing to edit.
+	if _, _, ok := pod.Amend(); ok {
+		t.Error("Amend before the loss was posted = ok")
+	}
+	loss.OnSent("m1")
+	messageID, embeds, ok := pod.Amend()
+	if !ok || messageID != "m1" || len(embeds) != 1 || embeds[0].Title != "Kill 1 — and podded" || len(embeds[0].Fields) != 2 {
+		t.Errorf("Amend = %q, %+v, %v", messageID, embeds, ok)
+	}
+	// The recorded embed is left alone, so a failed edit can't leave it half podded.
+	if title := loss.Message.Embeds[0].Title; title != "Kill 1" || len(loss.Message.Embeds[0].Fields) != 1 {
+		t.Errorf("the loss embed was changed: %q", title)
+	}
+
+	// Another pilot's pod, and losses in other channels, are not merged.
+	other := podTestJob("c1", podTestKill(3, 8, 29))
+	p.Prepare(other, podTestKill(3, 8, 29), now)
+	elsewhere := podTestJob("c2", podTestKill(4, 7, 29))
+	p.Prepare(elsewhere, podTestKill(4, 7, 29), now)
+	if other.Amend != nil || elsewhere.Amend != nil {
+		t.Error("a pod kill was merged into the wrong loss")
+	}
+}
+
+func TestPostedLossesSecondPodKill(t *testing.T) {
+	useFeedState(t)
+	p := NewPostedLosses(time.Minute)
+	now := time.Now()
+	p.Prepare(podTestJob("c1", podTestKill(1, 7, 25)), podTestKill(1, 7, 25), now)
+
+	first := podTestJob("c1", podTestKill(2, 7, 29))
+	p.Prepare(first, podTestKill(2, 7, 29), now)
+	if first.Amend == nil {
+		t.Fatal("the first pod kill was not merged")
+	}
+	if got := p.Channels(7, now); len(got) != 0 {
+		t.Errorf("a podded loss still takes pod kills in %v", got)
+	}
+	// A clone jump and another death: the second pod is posted on its own.
+	second := podTestJob("c1", podTestKill(3, 7, 29))
+	p.Prepare(second, podTestKill(3, 7, 29), now)
+	if second.Amend != nil {
+		t.Error("the second pod kill was merged into the same loss")
+	}
+}
+
+func TestPostedLossesWindow(t *testing.T) {
+	useFeedState(t)
+	p := NewPostedLosses(time.Minute)
+	now := time.Now()
+	p.Prepare(podTestJob("c1", podTestKill(1, 7, 25)), podTestKill(1, 7, 25), now)
+	if got := p.Channels(7, now.Add(time.Minute)); len(got) != 1 || got[0] != "c1" {
+		t.Errorf("Channels at the end of the window = %v", got)
+	}
+
+	late := now.Add(time.Minute + time.Second)
+	if got := p.Channels(7, late); len(got) != 0 {
+		t.Errorf("Channels after the window = %v", got)
+	}
+	pod := podTestJob("c1", podTestKill(2, 7, 29))
+	p.Prepare(pod, podTestKill(2, 7, 29), late)
+	if pod.Amend != nil {
+		t.Error("a pod kill after the window was merged")
+	}
+
+	// Recording a loss anywhere sweeps expired ones from every channel.
+	p.Prepare(podTestJob("c2", podTestKill(3, 8, 25)), podTestKill(3, 8, 25), now)
+	p.Prepare(podTestJob("c3", podTestKill(4, 9, 25)), podTestKill(4, 9, 25), late)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.byChannel) != 1 || len(p.byChannel["c3"]) != 1 {
+		t.Errorf("left after the sweep: %v", p.byChannel)
+	}
+}
+
+func TestPostedLossesDeletedMessage(t *testing.T) {
+	useFeedState(t)
+	sender := newScriptedSender(nil)
+	sender.editFail = func(*discordgo.MessageEdit) error {
+		return restError(404, discordgo.ErrCodeUnknownMessage)
+	}
+	q, _ := testDeliveryQueue(sender)
+	p := NewPostedLosses(time.Minute)
+	now := time.Now()
+
+	for _, channelID := range []string{"c1", "c2"} {
+		loss := podTestJob(channelID, podTestKill(1, 7, 25))
+		loss.Message.Content = "1"
+		p.Prepare(loss, podTestKill(1, 7, 25), now)
+		q.Enqueue(loss)
+	}
+	waitFor(t, func() bool { return len(sender.sent("c1")) == 1 && len(sender.sent("c2")) == 1 })
+
+	// The loss was deleted before its pod kill came in. A pod kill the channel matched on its
+	// own is posted instead; one it only took for the merge is dropped.
+	pod := podTestJob("c1", podTestKill(2, 7, 29))
+	pod.Message.Content = "2"
+	p.Prepare(pod, podTestKill(2, 7, 29), now)
+	mergeOnly := podTestJob("c2", podTestKill(2, 7, 29))
+	p.Prepare(mergeOnly, podTestKill(2, 7, 29), now)
+	mergeOnly.Message = nil
+	q.Enqueue(pod)
+	q.Enqueue(mergeOnly)
+	q.Close(5 * time.Second)
+
+	if got := sender.sent("c1"); len(got) != 2 || got[1] != 2 {
+		t.Errorf("posted to c1: %v", got)
+	}
+	if got := sender.sent("c2"); len(got) != 1 {
+		t.Errorf("posted to c2: %v", got)
+	}
+	if dead := q.DeadLetters(); len(dead) != 0 {
+		t.Errorf("dead letters: %+v", dead)
+	}
+}
+
+// A merge-mode channel takes the pod kill of a pilot whose loss it posted, even when the pod
+// matches none of its topics or its minimum value, and merges it into that loss.
+func TestMergeModeFollowsPodKills(t *testing.T) {
+	useAdminState(t)
+	oldLosses := postedLosses
+	t.Cleanup(func() { postedLosses = oldLosses })
+	postedLosses = NewPostedLosses(time.Minute)
+
+	subscriptions["merge"] = map[string]bool{"frigates": true}
+	subscriptions["show"] = map[string]bool{"frigates": true}
+	channelConfigs["merge"] = &ChannelConfig{PodMode: podModeMerge}
+	channelGuilds["merge"] = "g1"
+	guildConfigs["g1"] = &GuildConfig{EmbedStyle: embedStyleStandard, MinValue: 1e6}
+
+	sender := newScriptedSender(nil)
+	sender.editFail = func(*discordgo.MessageEdit) error { return nil }
+	q, _ := testDeliveryQueue(sender)
+
+	loss := podTestKill(1, 7, 25)
+	loss.Killmail.TotalValue = 5e6
+	if n := deliverKillmail(q, loss, deliveryOptions{}); n != 2 {
+		t.Fatalf("the loss went to %d channels", n)
+	}
+	waitFor(t, func() bool { return len(sender.sent("merge")) == 1 })
+
+	if n := deliverKillmail(q, podTestKill(2, 7, 29), deliveryOptions{}); n != 1 {
+		t.Errorf("the pod kill went to %d channels, want only the merge channel", n)
+	}
+	if n := deliverKillmail(q, podTestKill(3, 8, 29), deliveryOptions{}); n != 0 {
+		t.Errorf("an unrelated pod kill went to %d channels", n)
+	}
+	q.Close(5 * time.Second)
+
+	edits := sender.edited("merge")
+	if len(edits) != 1 || edits[0].ID != "m0" || !strings.HasSuffix((*edits[0].Embeds)[0].Title, " — and podded") {
+		t.Errorf("edits = %+v", edits)
+	}
+	if got := sender.sent("merge"); len(got) != 1 {
+		t.Errorf("posted to the merge channel: %v", got)
+	}
+}
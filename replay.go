@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// recordedFrame is one line of a frame recording: a raw eve-kill WebSocket frame and when it
+// arrived. The frame is kept as a string so replays send exactly the bytes that were received.
+type recordedFrame struct {
+	At    time.Time `json:"at"`
+	Frame string    `json:"frame"`
+}
+
+// FrameRecorder appends every frame the eve-kill source receives to a JSONL file, for replaying
+// later. Set EVEKILL_RECORD to a path to turn it on.
+type FrameRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder // Writes straight to the file, so a crash loses nothing.
+}
+
+// NewFrameRecorder opens path for appending, so several runs can be recorded into one file.
+func NewFrameRecorder(path string) (*FrameRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FrameRecorder{enc: json.NewEncoder(f)}, nil
+}
+
+// Record writes one frame. Errors are logged rather than returned; a recording must never stop
+// the live feed.
+func (r *FrameRecorder) Record(frame []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(recordedFrame{At: time.Now().UTC(), Frame: string(frame)}); err != nil {
+		log.Printf("Failed to record eve-kill frame: %v", err)
+	}
+}
+
+// loadRecordedFrames reads a recording written by FrameRecorder.
+func loadRecordedFrames(path string) ([]recordedFrame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var frames []recordedFrame
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // Big fights make big killmails.
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var frame recordedFrame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, scanner.Err()
+}
+
+// ReplayServer plays a recording back as an eve-kill WebSocket feed. Each client gets the whole
+// recording from the start. Speed 1 keeps the original gaps between frames, 10 plays ten times
+// faster, and 0 sends everything at once. The connection stays open afterwards, like a quiet
+// feed, so the client doesn't reconnect and get it all again.
+type ReplayServer struct {
+	Frames []recordedFrame
+	Speed  float64
+}
+
+func (s *ReplayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Subscriptions and pongs are read and ignored; a read error means the client has gone.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for i, frame := range s.Frames {
+		if i > 0 && s.Speed > 0 {
+			gap := time.Duration(float64(frame.At.Sub(s.Frames[i-1].At)) / s.Speed)
+			select {
+			case <-time.After(gap):
+			case <-gone:
+				return
+			}
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(frame.Frame)); err != nil {
+			return
+		}
+	}
+	<-gone
+}
+
+// runReplay is the `firehawk replay` mode. Point a bot at it with EVEKILL_WS_URL.
+func runReplay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	path := flags.String("file", "", "frame recording written with EVEKILL_RECORD")
+	addr := flags.String("addr", "127.0.0.1:8765", "address to serve the feed on")
+	speed := flags.Float64("speed", 1, "playback speed: 1 is real time, 0 sends everything at once")
+	flags.Parse(args)
+
+	if *path == "" || *speed < 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	frames, err := loadRecordedFrames(*path)
+	if err != nil {
+		log.Fatalf("Error reading recording: %v", err)
+	}
+	log.Printf("Replaying %d frames from %s on ws://%s/ at %gx", len(frames), *path, *addr, *speed)
+	if err := http.ListenAndServe(*addr, &ReplayServer{Frames: frames, Speed: *speed}); err != nil {
+		log.Fatalf("Replay server failed: %v", err)
+	}
+}
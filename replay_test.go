@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const replayFixture = "testdata/replay/evekill-frames.jsonl"
+
+// fakeDiscord is a messageSender that keeps every post and edit in memory.
+type fakeDiscord struct {
+	mu       sync.Mutex
+	messages map[string]*discordgo.MessageEmbed // Message ID -> its current embed.
+	channels map[string][]string                // Channel ID -> message IDs in posting order.
+	edits    int
+}
+
+func newFakeDiscord() *fakeDiscord {
+	return &fakeDiscord{messages: make(map[string]*discordgo.MessageEmbed), channels: make(map[string][]string)}
+}
+
+func (f *fakeDiscord) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := fmt.Sprintf("m%d", len(f.messages)+1)
+	f.messages[id] = data.Embeds[0]
+	f.channels[channelID] = append(f.channels[channelID], id)
+	return &discordgo.Message{ID: id, ChannelID: channelID}, nil
+}
+
+func (f *fakeDiscord) ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !slices.Contains(f.channels[m.Channel], m.ID) {
+		return nil, &discordgo.RESTError{Message: &discordgo.APIErrorMessage{Code: discordgo.ErrCodeUnknownMessage}}
+	}
+	f.messages[m.ID] = (*m.Embeds)[0]
+	f.edits++
+	return &discordgo.Message{ID: m.ID, ChannelID: m.Channel}, nil
+}
+
+// titles returns the current title of every message in a channel, in posting order.
+func (f *fakeDiscord) titles(channelID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var titles []string
+	for _, id := range f.channels[channelID] {
+		titles = append(titles, f.messages[id].Title)
+	}
+	return titles
+}
+
+// useFeedState swaps in fresh feed state for a test and puts the old state back afterwards.
+func useFeedState(t *testing.T) {
+	t.Helper()
+	oldSubs, oldConfigs, oldGroups, oldLedger, oldStore := subscriptions, channelConfigs, shipGroups, killmailLedger, store
+	t.Cleanup(func() {
+		subscriptions, channelConfigs, shipGroups, killmailLedger, store = oldSubs, oldConfigs, oldGroups, oldLedger, oldStore
+	})
+	subscriptions = make(map[string]map[string]bool)
+	channelConfigs = make(map[string]*ChannelConfig)
+
+	if err := loadShipGroups(shipGroupsPath); err != nil {
+		t.Fatal(err)
+	}
+	st, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "firehawk.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	store = st
+	if killmailLedger, err = NewKillmailLedger(st); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReplayEndToEnd plays a recorded eve-kill session through the real source, topic
+// matching, ledger and delivery queue into a fake Discord, and records it again on the way.
+func TestReplayEndToEnd(t *testing.T) {
+	useFeedState(t)
+	subscriptions["frigates"] = map[string]bool{"frigates": true}
+	subscriptions["nullsec"] = map[string]bool{"nullsec": true}
+	subscriptions["everything"] = map[string]bool{"all": true}
+	channelConfigs["nullsec"] = &ChannelConfig{PodMode: podModeMerge}
+	channelConfigs["everything"] = &ChannelConfig{PodMode: podModeHide}
+
+	frames, err := loadRecordedFrames(replayFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(&ReplayServer{Frames: frames})
+	defer srv.Close()
+
+	recording := filepath.Join(t.TempDir(), "frames.jsonl")
+	src := newEveKillSource("ws" + strings.TrimPrefix(srv.URL, "http"))
+	if src.recorder, err = NewFrameRecorder(recording); err != nil {
+		t.Fatal(err)
+	}
+	discord := newFakeDiscord()
+	q := NewDeliveryQueue(discord)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runKillmailSources(ctx, []KillmailSource{src}, func(data *KillmailData) { processAndSendKillmail(q, data) })
+	}()
+
+	// Every frame has been read once the recording holds all of them.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recorded, _ := loadRecordedFrames(recording)
+		if len(recorded) == len(frames) {
+			for i := range frames {
+				if recorded[i].Frame != frames[i].Frame {
+					t.Errorf("recorded frame %d differs from the one sent", i)
+				}
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("recorded %d of %d frames", len(recorded), len(frames))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	q.Close(5 * time.Second)
+
+	want := map[string][]string{
+		"frigates":   {"Rifter destroyed in Tamo"},
+		"nullsec":    {"Rifter destroyed in Tamo — and podded"},
+		"everything": {"Rifter destroyed in Tamo", "Hurricane destroyed in Jita"},
+	}
+	for channelID, titles := range want {
+		if got := discord.titles(channelID); !slices.Equal(got, titles) {
+			t.Errorf("%s got %q, want %q", channelID, got, titles)
+		}
+	}
+	if discord.edits != 1 {
+		t.Errorf("got %d edits, want the one pod merge", discord.edits)
+	}
+}
+
+func TestReplayServerTiming(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)
+	frames := []recordedFrame{
+		{At: start, Frame: `{"type":"info"}`},
+		{At: start.Add(2 * time.Second), Frame: `{"type":"killmail","data":{"killmail":{"killmail_id":1}}}`},
+	}
+	for _, tc := range []struct {
+		speed    float64
+		min, max time.Duration
+	}{
+		{speed: 10, min: 150 * time.Millisecond, max: time.Second},
+		{speed: 0, min: 0, max: 100 * time.Millisecond},
+	} {
+		srv := httptest.NewServer(&ReplayServer{Frames: frames, Speed: tc.speed})
+		ctx, cancel := context.WithCancel(context.Background())
+		out := make(chan *KillmailData, 1)
+		go newEveKillSource("ws"+strings.TrimPrefix(srv.URL, "http")).Run(ctx, out)
+
+		started := time.Now()
+		receiveKillmail(t, out)
+		// The connection takes a moment too, so only the gap's rough size is checked.
+		if elapsed := time.Since(started); elapsed < tc.min || elapsed > tc.max {
+			t.Errorf("speed %g: killmail after %s, want between %s and %s", tc.speed, elapsed, tc.min, tc.max)
+		}
+		cancel()
+		srv.Close()
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The generator reads CCP's JSON Lines SDE (https://developers.eveonline.com/static-data), either the
+// downloaded zip or an extracted directory. The map files make systems.json; the group and type
+// files make shipgroups.json.
+const (
+	sdeRegionsFile        = "mapRegions.jsonl"
+	sdeConstellationsFile = "mapConstellations.jsonl"
+	sdeSystemsFile        = "mapSolarSystems.jsonl"
+	sdeStargatesFile      = "mapStargates.jsonl"
+	sdeGroupsFile         = "groups.jsonl"
+	sdeTypesFile          = "types.jsonl"
+)
+
+// SDE meta groups that set a type's tech level; everything else counts as tech 1.
+const (
+	sdeMetaGroupTech2 = 2
+	sdeMetaGroupTech3 = 14
+)
+
+// staticUniverse is the on-disk layout of systems.json written by gen-sde.
+type staticUniverse struct {
+	Regions        map[int]*staticRegion        `json:"regions"`
+	Constellations map[int]*staticConstellation `json:"constellations"`
+	Systems        map[int]*ESISystemInfo       `json:"systems"`
+}
+
+type staticRegion struct {
+	Name     string `json:"name"`
+	RegionID int    `json:"region_id"`
+}
+
+type staticConstellation struct {
+	Name            string `json:"name"`
+	ConstellationID int    `json:"constellation_id"`
+	RegionID        int    `json:"region_id"`
+}
+
+// --- SDE record shapes (only the fields we use) ---
+
+type sdeName struct {
+	En string `json:"en"`
+}
+
+type sdeRegion struct {
+	Key  int     `json:"_key"`
+	Name sdeName `json:"name"`
+}
+
+type sdeConstellation struct {
+	Key      int     `json:"_key"`
+	Name     sdeName `json:"name"`
+	RegionID int     `json:"regionID"`
+}
+
+type sdeSolarSystem struct {
+	Key             int     `json:"_key"`
+	Name            sdeName `json:"name"`
+	ConstellationID int     `json:"constellationID"`
+	RegionID        int     `json:"regionID"`
+	SecurityStatus  float64 `json:"securityStatus"`
+}
+
+type sdeGroup struct {
+	Key        int     `json:"_key"`
+	Name       sdeName `json:"name"`
+	CategoryID int     `json:"categoryID"`
+	Published  bool    `json:"published"`
+}
+
+type sdeType struct {
+	Key         int  `json:"_key"`
+	GroupID     int  `json:"groupID"`
+	MetaGroupID int  `json:"metaGroupID"`
+	Published   bool `json:"published"`
+}
+
+type sdeStargate struct {
+	Key           int `json:"_key"`
+	SolarSystemID int `json:"solarSystemID"`
+	Destination   struct {
+		SolarSystemID int `json:"solarSystemID"`
+		StargateID    int `json:"stargateID"`
+	} `json:"destination"`
+}
+
+// runGenSDE implements the `firehawk gen-sde` subcommand.
+func runGenSDE(args []string) {
+	flags := flag.NewFlagSet("gen-sde", flag.ExitOnError)
+	sdePath := flags.String("sde", "", "path to the JSONL SDE zip or extracted directory")
+	outPath := flags.String("out", systemCachePath, "where to write the generated systems file")
+	groupsOutPath := flags.String("ship-groups-out", shipGroupsPath, "where to write the generated ship groups file")
+	flags.Parse(args)
+
+	if *sdePath == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	fsys, closeFn, err := openSDE(*sdePath)
+	if err != nil {
+		log.Fatalf("Error opening SDE: %v", err)
+	}
+	defer closeFn()
+
+	universe, err := buildStaticUniverse(fsys)
+	if err != nil {
+		log.Fatalf("Error reading SDE: %v", err)
+	}
+	if err := writeJSONFileAtomic(*outPath, universe); err != nil {
+		log.Fatalf("Error writing %s: %v", *outPath, err)
+	}
+	log.Printf("Wrote %d regions, %d constellations and %d systems to %s",
+		len(universe.Regions), len(universe.Constellations), len(universe.Systems), *outPath)
+
+	groups, err := buildShipGroups(fsys)
+	if err != nil {
+		log.Fatalf("Error reading SDE: %v", err)
+	}
+	if err := writeJSONFileAtomic(*groupsOutPath, groups); err != nil {
+		log.Fatalf("Error writing %s: %v", *groupsOutPath, err)
+	}
+	log.Printf("Wrote %d ship groups to %s", len(groups.Groups), *groupsOutPath)
+}
+
+// openSDE returns a filesystem over either a zip archive or a directory. The SDE zip
+// sometimes nests everything in a top-level folder, so we descend into it if needed.
+func openSDE(sdePath string) (fs.FS, func() error, error) {
+	info, err := os.Stat(sdePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return os.DirFS(sdePath), func() error { return nil }, nil
+	}
+
+	zr, err := zip.OpenReader(sdePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open SDE zip: %w", err)
+	}
+	var fsys fs.FS = zr
+	if _, err := fs.Stat(fsys, sdeSystemsFile); err != nil {
+		for _, f := range zr.File {
+			if path.Base(f.Name) == sdeSystemsFile { // Zip entries always use forward slashes.
+				if sub, err := fs.Sub(zr, path.Dir(f.Name)); err == nil {
+					fsys = sub
+				}
+				break
+			}
+		}
+	}
+	return fsys, zr.Close, nil
+}
+
+// buildStaticUniverse reads the SDE map files and assembles the systems.json structure.
+func buildStaticUniverse(fsys fs.FS) (*staticUniverse, error) {
+	universe := &staticUniverse{
+		Regions:        map[int]*staticRegion{},
+		Constellations: map[int]*staticConstellation{},
+		Systems:        map[int]*ESISystemInfo{},
+	}
+
+	err := readJSONL(fsys, sdeRegionsFile, func(r sdeRegion) {
+		universe.Regions[r.Key] = &staticRegion{Name: r.Name.En, RegionID: r.Key}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readJSONL(fsys, sdeConstellationsFile, func(c sdeConstellation) {
+		universe.Constellations[c.Key] = &staticConstellation{Name: c.Name.En, ConstellationID: c.Key, RegionID: c.RegionID}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readJSONL(fsys, sdeSystemsFile, func(s sdeSolarSystem) {
+		universe.Systems[s.Key] = &ESISystemInfo{
+			Name:            s.Name.En,
+			SecurityStatus:  s.SecurityStatus,
+			SystemID:        s.Key,
+			ConstellationID: s.ConstellationID,
+			RegionID:        s.RegionID,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readJSONL(fsys, sdeStargatesFile, func(g sdeStargate) {
+		sys, ok := universe.Systems[g.SolarSystemID]
+		if !ok {
+			return
+		}
+		sys.Stargates = append(sys.Stargates, g.Key)
+		sys.AdjacentSystems = append(sys.AdjacentSystems, g.Destination.SolarSystemID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return universe, nil
+}
+
+// buildShipGroups classifies every published ship group, and the structure groups Firehawk
+// tags, from the SDE group and type files. A group's tech level is the lowest of its published
+// types, so a base hull group holding T1 and faction ships stays tech 1.
+func buildShipGroups(fsys fs.FS) (*shipGroupFile, error) {
+	file := &shipGroupFile{Groups: map[int]*ShipGroup{}}
+
+	err := readJSONL(fsys, sdeGroupsFile, func(g sdeGroup) {
+		if !g.Published || (g.CategoryID != sdeCategoryShip && g.CategoryID != sdeCategoryStructure) {
+			return
+		}
+		class, known := shipClassesByGroupName[g.Name.En]
+		if !known {
+			if g.CategoryID == sdeCategoryStructure {
+				return
+			}
+			log.Printf("WARNING: ship group %d (%s) has no class; add it to shipClassesByGroupName", g.Key, g.Name.En)
+		}
+		file.Groups[g.Key] = &ShipGroup{GroupID: g.Key, Name: g.Name.En, CategoryID: g.CategoryID, Class: class.Class, Capital: class.Capital}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readJSONL(fsys, sdeTypesFile, func(t sdeType) {
+		group, ok := file.Groups[t.GroupID]
+		if !ok || !t.Published || group.CategoryID != sdeCategoryShip {
+			return
+		}
+		tech := 1
+		switch t.MetaGroupID {
+		case sdeMetaGroupTech2:
+			tech = 2
+		case sdeMetaGroupTech3:
+			tech = 3
+		}
+		if group.Tech == 0 || tech < group.Tech {
+			group.Tech = tech
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// readJSONL decodes every line of an SDE file into T and hands it to fn.
+func readJSONL[T any](fsys fs.FS, name string, fn func(T)) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // Some SDE records are long.
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var record T
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("%s line %d: %w", name, line, err)
+		}
+		fn(record)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeJSONFileAtomic writes indented JSON to a temp file and renames it into place,
+// so a crash never leaves a half-written file behind.
+func writeJSONFileAtomic(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// isLegacySystemCache reports whether systems.json is the old flat map of system ID -> system.
+func isLegacySystemCache(raw map[string]json.RawMessage) bool {
+	for key := range raw {
+		if _, err := strconv.Atoi(key); err == nil {
+			return true
+		}
+	}
+	return false
+}
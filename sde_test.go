@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateSystemsFromFixtureSDE(t *testing.T) {
+	fsys, closeFn, err := openSDE(filepath.Join("testdata", "sde"))
+	if err != nil {
+		t.Fatalf("openSDE: %v", err)
+	}
+	defer closeFn()
+
+	universe, err := buildStaticUniverse(fsys)
+	if err != nil {
+		t.Fatalf("buildStaticUniverse: %v", err)
+	}
+	if len(universe.Regions) != 2 || len(universe.Constellations) != 3 || len(universe.Systems) != 4 {
+		t.Fatalf("got %d regions, %d constellations, %d systems; want 2, 3, 4",
+			len(universe.Regions), len(universe.Constellations), len(universe.Systems))
+	}
+
+	out := filepath.Join(t.TempDir(), "systems.json")
+	if err := writeJSONFileAtomic(out, universe); err != nil {
+		t.Fatalf("writeJSONFileAtomic: %v", err)
+	}
+
+	// The generated file must load back offline: region and constellation names without ESI.
+	client := NewESIClient("test")
+	client.baseURL = "http://127.0.0.1:0"
+	if err := client.LoadSystemCache(out); err != nil {
+		t.Fatalf("LoadSystemCache: %v", err)
+	}
+
+	tanoo, err := client.GetSystemDetails(30000001)
+	if err != nil {
+		t.Fatalf("GetSystemDetails: %v", err)
+	}
+	if tanoo.Name != "Tanoo" || tanoo.RegionID != 10000001 || tanoo.ConstellationID != 20000001 {
+		t.Errorf("unexpected Tanoo entry: %+v", tanoo)
+	}
+	if got := client.GetRegionName(context.Background(), tanoo.RegionID); got != "Derelik" {
+		t.Errorf("GetRegionName = %q, want Derelik", got)
+	}
+	if got := client.GetConstellationName(context.Background(), tanoo.ConstellationID); got != "San Matar" {
+		t.Errorf("GetConstellationName = %q, want San Matar", got)
+	}
+
+	if !client.HasStargateGraph() {
+		t.Fatal("expected a stargate graph")
+	}
+	// Lashesih and Akpivem are both one jump from Tanoo, so two jumps from each other.
+	if reach := client.SystemsWithinJumps(30000002, 1); reach[30000003] {
+		t.Error("Akpivem should not be within 1 jump of Lashesih")
+	}
+	if reach := client.SystemsWithinJumps(30000002, 2); !reach[30000003] || !reach[30000001] {
+		t.Errorf("expected Tanoo and Akpivem within 2 jumps of Lashesih, got %v", reach)
+	}
+	if reach := client.SystemsWithinJumps(30004759, 5); len(reach) != 1 {
+		t.Errorf("isolated system should only reach itself, got %v", reach)
+	}
+}
+
+func TestStargateGraphLinksBothWays(t *testing.T) {
+	client := NewESIClient("test")
+	// Only Tanoo lists the gate to Lashesih.
+	client.systemInfoCache[30000001] = &ESISystemInfo{SystemID: 30000001, AdjacentSystems: []int{30000002}}
+	client.systemInfoCache[30000002] = &ESISystemInfo{SystemID: 30000002}
+	client.buildStargateGraph()
+
+	if reach := client.SystemsWithinJumps(30000002, 1); !reach[30000001] {
+		t.Errorf("Tanoo should be one jump from Lashesih, got %v", reach)
+	}
+}
+
+func TestOpenSDEZipWithNestedFolder(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "sde.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{sdeRegionsFile, sdeConstellationsFile, sdeSystemsFile, sdeStargatesFile} {
+		data, err := os.ReadFile(filepath.Join("testdata", "sde", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := zw.Create("sde/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	zw.Close()
+	f.Close()
+
+	fsys, closeFn, err := openSDE(zipPath)
+	if err != nil {
+		t.Fatalf("openSDE: %v", err)
+	}
+	defer closeFn()
+
+	universe, err := buildStaticUniverse(fsys)
+	if err != nil {
+		t.Fatalf("buildStaticUniverse: %v", err)
+	}
+	if len(universe.Systems) != 4 {
+		t.Errorf("got %d systems from zip, want 4", len(universe.Systems))
+	}
+}
+
+func TestLoadLegacySystemCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "systems.json")
+	legacy := `{"30000001": {"name": "Tanoo", "security_status": 0.85, "constellation_id": 20000001, "system_id": 30000001, "region_id": 0}}`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewESIClient("test")
+	if err := client.LoadSystemCache(path); err != nil {
+		t.Fatalf("LoadSystemCache: %v", err)
+	}
+	if got := client.GetSystemName(30000001); got != "Tanoo" {
+		t.Errorf("GetSystemName = %q, want Tanoo", got)
+	}
+}
+
+func TestGenerateShipGroupsFromFixtureSDE(t *testing.T) {
+	fsys, closeFn, err := openSDE(filepath.Join("testdata", "sde"))
+	if err != nil {
+		t.Fatalf("openSDE: %v", err)
+	}
+	defer closeFn()
+
+	file, err := buildShipGroups(fsys)
+	if err != nil {
+		t.Fatalf("buildShipGroups: %v", err)
+	}
+
+	// Minerals, unpublished groups and structures Firehawk doesn't tag are left out.
+	for _, id := range []int{18, 381, 1408} {
+		if _, ok := file.Groups[id]; ok {
+			t.Errorf("group %d should not be in the table", id)
+		}
+	}
+	want := map[int]ShipGroup{
+		25:   {GroupID: 25, Name: "Frigate", CategoryID: 6, Class: "frigates", Tech: 1}, // Faction hulls don't lift the group.
+		29:   {GroupID: 29, Name: "Capsule", CategoryID: 6, Class: "pods", Tech: 1},
+		324:  {GroupID: 324, Name: "Assault Frigate", CategoryID: 6, Class: "frigates", Tech: 2},
+		963:  {GroupID: 963, Name: "Strategic Cruiser", CategoryID: 6, Class: "cruisers", Tech: 3},
+		1404: {GroupID: 1404, Name: "Engineering Complex", CategoryID: 65, Class: "citadel"},
+		1657: {GroupID: 1657, Name: "Citadel", CategoryID: 65, Class: "citadel"},
+	}
+	if len(file.Groups) != len(want) {
+		t.Errorf("got %d groups, want %d", len(file.Groups), len(want))
+	}
+	for id, w := range want {
+		if got, ok := file.Groups[id]; !ok || *got != w {
+			t.Errorf("group %d = %+v, want %+v", id, got, w)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// How long and how many killmails the ledger remembers. eve-kill replays recent kills after a
+// reconnect and zKillboard can lag by minutes, so a few hours covers every realistic repeat.
+const (
+	seenKillmailWindow = 6 * time.Hour
+	maxSeenKillmails   = 200000
+	seenPruneInterval  = 10 * time.Minute
+)
+
+// seenKillmail is what the ledger knows about one killmail.
+type seenKillmail struct {
+	at        time.Time
+	processed bool            // Set by MarkSeen; a backfill only claims channels.
+	channels  map[string]bool // Channels the killmail has been queued for.
+}
+
+// StoredKillmail is a seen killmail as the store keeps it.
+type StoredKillmail struct {
+	SeenAt    time.Time
+	Processed bool     // False while only a backfill has claimed channels for it.
+	Channels  []string // Channels it was posted to.
+}
+
+// KillmailLedger remembers which killmails have been processed and which channels each one was
+// posted to, so neither a replayed kill nor a kill matching a channel twice is ever reposted.
+// It is kept in memory and written through to the store, so it survives restarts.
+type KillmailLedger struct {
+	st     Store
+	mu     sync.Mutex
+	window time.Duration
+	max    int
+	seen   map[int]*seenKillmail
+}
+
+// killmailLedger is the process-wide ledger, loaded in main().
+var killmailLedger *KillmailLedger
+
+// NewKillmailLedger loads the killmails seen within the window from the store.
+func NewKillmailLedger(st Store) (*KillmailLedger, error) {
+	l := &KillmailLedger{st: st, window: seenKillmailWindow, max: maxSeenKillmails, seen: make(map[int]*seenKillmail)}
+	seen, err := st.RecentKillmails(time.Now().Add(-l.window))
+	if err != nil {
+		return nil, err
+	}
+	for id, k := range seen {
+		entry := &seenKillmail{at: k.SeenAt, processed: k.Processed, channels: make(map[string]bool)}
+		for _, channelID := range k.Channels {
+			entry.channels[channelID] = true
+		}
+		l.seen[id] = entry
+	}
+	log.Printf("Loaded %d recently seen killmails.", len(l.seen))
+	return l, nil
+}
+
+// MarkSeen records a killmail and reports whether this is the first time it was seen.
+// A kill a backfill has already posted somewhere still counts as new, so channels in other
+// guilds get it; ClaimChannels keeps it from being posted twice where it already went.
+func (l *KillmailLedger) MarkSeen(killmailID int) bool {
+	now := time.Now()
+	l.mu.Lock()
+	if entry, ok := l.seen[killmailID]; ok && now.Sub(entry.at) < l.window {
+		if entry.processed {
+			l.mu.Unlock()
+			return false
+		}
+		entry.processed = true
+		at := entry.at
+		l.mu.Unlock()
+		if err := l.st.MarkKillmailSeen(killmailID, at, true); err != nil {
+			log.Printf("Failed to persist seen killmail %d: %v", killmailID, err)
+		}
+		return true
+	}
+	l.seen[killmailID] = &seenKillmail{at: now, processed: true, channels: make(map[string]bool)}
+	if len(l.seen) > l.max {
+		l.evictOldestLocked(len(l.seen) - l.max*9/10)
+	}
+	l.mu.Unlock()
+
+	if err := l.st.MarkKillmailSeen(killmailID, now, true); err != nil {
+		log.Printf("Failed to persist seen killmail %d: %v", killmailID, err)
+	}
+	return true
+}
+
+// ClaimChannels returns the channels the killmail has not been posted to yet, and records them
+// as posted. Callers must only queue the killmail for the channels it returns.
+func (l *KillmailLedger) ClaimChannels(killmailID int, channelIDs []string) []string {
+	if len(channelIDs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	l.mu.Lock()
+	entry, ok := l.seen[killmailID]
+	if !ok {
+		// Only a backfill claims channels for a kill MarkSeen hasn't had. The seen row is
+		// stored so the deliveries survive a restart and are pruned with it.
+		entry = &seenKillmail{at: now, channels: make(map[string]bool)}
+		l.seen[killmailID] = entry
+	}
+	var fresh []string
+	for _, channelID := range channelIDs {
+		if !entry.channels[channelID] {
+			entry.channels[channelID] = true
+			fresh = append(fresh, channelID)
+		}
+	}
+	l.mu.Unlock()
+
+	if !ok {
+		if err := l.st.MarkKillmailSeen(killmailID, now, false); err != nil {
+			log.Printf("Failed to persist seen killmail %d: %v", killmailID, err)
+		}
+	}
+	if len(fresh) > 0 {
+		if err := l.st.RecordDeliveries(killmailID, fresh); err != nil {
+			log.Printf("Failed to persist deliveries of killmail %d: %v", killmailID, err)
+		}
+	}
+	return fresh
+}
+
+// Len returns how many killmails are currently remembered.
+func (l *KillmailLedger) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.seen)
+}
+
+// Prune forgets killmails older than the window, in memory and in the store.
+func (l *KillmailLedger) Prune() {
+	cutoff := time.Now().Add(-l.window)
+	l.mu.Lock()
+	for id, entry := range l.seen {
+		if entry.at.Before(cutoff) {
+			delete(l.seen, id)
+		}
+	}
+	l.mu.Unlock()
+
+	if err := l.st.PruneKillmails(cutoff); err != nil {
+		log.Printf("Failed to prune seen killmails: %v", err)
+	}
+}
+
+// RunPruner prunes the ledger periodically until stop is closed.
+func (l *KillmailLedger) RunPruner(stop <-chan struct{}) {
+	ticker := time.NewTicker(seenPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.Prune()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// evictOldestLocked drops the n oldest killmails from memory during a burst that outgrows max.
+// The store keeps them until the next prune.
+func (l *KillmailLedger) evictOldestLocked(n int) {
+	cutoff := time.Now()
+	for n > 0 && len(l.seen) > 0 {
+		// Work back from the oldest age bucket, a minute at a time, rather than sorting everything.
+		oldest := cutoff
+		for _, entry := range l.seen {
+			if entry.at.Before(oldest) {
+				oldest = entry.at
+			}
+		}
+		bucketEnd := oldest.Add(time.Minute)
+		for id, entry := range l.seen {
+			if n == 0 {
+				break
+			}
+			if entry.at.Before(bucketEnd) {
+				delete(l.seen, id)
+				n--
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testLedger(t *testing.T) (*KillmailLedger, *sqliteStore) {
+	t.Helper()
+	st, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "firehawk.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	l, err := NewKillmailLedger(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, st
+}
+
+func TestKillmailLedgerMarkSeenAndClaim(t *testing.T) {
+	l, st := testLedger(t)
+
+	if !l.MarkSeen(1) {
+		t.Error("first MarkSeen(1) = false")
+	}
+	if l.MarkSeen(1) {
+		t.Error("second MarkSeen(1) = true")
+	}
+	if got := l.ClaimChannels(1, []string{"c1", "c2"}); !slices.Equal(got, []string{"c1", "c2"}) {
+		t.Errorf("first claim = %v", got)
+	}
+	// Only channels the kill has not gone to yet are handed out.
+	if got := l.ClaimChannels(1, []string{"c2", "c3"}); !slices.Equal(got, []string{"c3"}) {
+		t.Errorf("second claim = %v", got)
+	}
+
+	// Everything survives a restart.
+	restarted, err := NewKillmailLedger(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.MarkSeen(1) {
+		t.Error("MarkSeen(1) after a restart = true")
+	}
+	if got := restarted.ClaimChannels(1, []string{"c1", "c2", "c3", "c4"}); !slices.Equal(got, []string{"c4"}) {
+		t.Errorf("claim after a restart = %v", got)
+	}
+}
+
+func TestKillmailLedgerRefreshesExpiredKillmails(t *testing.T) {
+	l, st := testLedger(t)
+	old := time.Now().Add(-seenKillmailWindow - time.Hour)
+	if err := st.MarkKillmailSeen(7, old, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Seen again after its window, the kill counts as new and its row is renewed, so neither
+	// the next prune nor a restart forgets it.
+	if !l.MarkSeen(7) {
+		t.Error("MarkSeen of an expired killmail = false")
+	}
+	l.Prune()
+	restarted, err := NewKillmailLedger(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.Len() != 1 || restarted.MarkSeen(7) {
+		t.Errorf("killmail 7 was forgotten: %d remembered", restarted.Len())
+	}
+}
+
+func TestKillmailLedgerPrune(t *testing.T) {
+	l, st := testLedger(t)
+	l.MarkSeen(1)
+	l.ClaimChannels(1, []string{"c1"})
+	l.MarkSeen(2)
+	l.mu.Lock()
+	l.seen[1].at = time.Now().Add(-seenKillmailWindow - time.Minute)
+	l.mu.Unlock()
+	st.db.Exec(`UPDATE seen_killmails SET seen_at = ? WHERE killmail_id = 1`, time.Now().Add(-seenKillmailWindow-time.Minute).Unix())
+
+	l.Prune()
+	if l.Len() != 1 {
+		t.Errorf("%d remembered after Prune, want 1", l.Len())
+	}
+	var deliveries int
+	st.db.QueryRow(`SELECT COUNT(*) FROM killmail_deliveries`).Scan(&deliveries)
+	if deliveries != 0 {
+		t.Errorf("%d deliveries left for the pruned killmail", deliveries)
+	}
+	if !l.MarkSeen(1) {
+		t.Error("MarkSeen of a pruned killmail = false")
+	}
+}
+
+func TestKillmailLedgerEvictsOldestOverMax(t *testing.T) {
+	l, _ := testLedger(t)
+	l.max = 10
+	for id := 1; id <= 10; id++ {
+		l.MarkSeen(id)
+		l.mu.Lock()
+		l.seen[id].at = time.Now().Add(-time.Duration(20-id) * time.Minute)
+		l.mu.Unlock()
+	}
+	l.MarkSeen(11)
+	// Going over max drops the oldest tenth and more, down to 90% of max.
+	if n := l.Len(); n > 9 {
+		t.Errorf("%d remembered, want at most 9", n)
+	}
+	l.mu.Lock()
+	_, oldest := l.seen[1]
+	_, newest := l.seen[11]
+	l.mu.Unlock()
+	if oldest || !newest {
+		t.Errorf("kept oldest = %v, kept newest = %v", oldest, newest)
+	}
+}
+
+// A kill a backfill posted before the live feed had it is still new to the live feed after a
+// restart, and once the live feed has had it, that survives a restart too.
+func TestKillmailLedgerKeepsClaimsUnprocessed(t *testing.T) {
+	l, st := testLedger(t)
+	l.ClaimChannels(1, []string{"c1"})
+	l.ClaimChannels(2, []string{"c1"})
+	l.MarkSeen(2)
+
+	restarted, err := NewKillmailLedger(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.MarkSeen(1) {
+		t.Error("a killmail only claimed by a backfill was processed after a restart")
+	}
+	if restarted.MarkSeen(2) {
+		t.Error("a claimed killmail the live feed processed was new after a restart")
+	}
+	if got := restarted.ClaimChannels(1, []string{"c1", "c2"}); !slices.Equal(got, []string{"c2"}) {
+		t.Errorf("claim after a restart = %v", got)
+	}
+
+	again, err := NewKillmailLedger(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.MarkSeen(1) {
+		t.Error("processing a claimed killmail did not survive a restart")
+	}
+}
@@ -5,17 +5,40 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Health service to keep it running on cloud run - not needed if you want to run it on digital ocean/container
 
-func startHealthCheckServer() {
+func startHealthCheckServer(dg *discordgo.Session, sources []KillmailSource) {
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/healthz", health.probeHandler(false))
+	http.HandleFunc("/readyz", health.probeHandler(true))
+	if token := os.Getenv("ADMIN_API_TOKEN"); token != "" {
+		http.Handle("/admin/", NewAdminAPI(token, esiClient, sources).Handler())
+		log.Println("Admin API enabled under /admin/")
+	}
+	clientID, clientSecret, dashboardURL := os.Getenv("DISCORD_CLIENT_ID"), os.Getenv("DISCORD_CLIENT_SECRET"), os.Getenv("DASHBOARD_URL")
+	if clientID != "" && clientSecret != "" && dashboardURL != "" {
+		auth := NewDiscordAuth(clientID, clientSecret, strings.TrimSuffix(dashboardURL, "/")+"/dashboard/callback")
+		dash := NewDashboard(auth, strings.HasPrefix(dashboardURL, "https://"))
+		dash.GuildChannels = sessionGuildChannels(dg)
+		dash.InGuild = func(guildID string) bool {
+			_, err := dg.State.Guild(guildID)
+			return err == nil
+		}
+		http.Handle("/dashboard/", dash.Handler())
+		log.Printf("Dashboard enabled at %s/dashboard/", strings.TrimSuffix(dashboardURL, "/"))
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Firehawk bot is running.")
 	})
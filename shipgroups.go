@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// SDE inventory categories that hold things which can appear as a killmail victim.
+const (
+	sdeCategoryShip      = 6
+	sdeCategoryStructure = 65
+)
+
+// ShipGroup is one inventory group in shipgroups.json: what kind of hull it is and its tech
+// level. Topics for a victim are derived from it, see ShipGroup.Topics.
+type ShipGroup struct {
+	GroupID    int    `json:"group_id"`
+	Name       string `json:"name"`
+	CategoryID int    `json:"category_id"`
+	Class      string `json:"class"`             // Firehawk's hull class, e.g. "cruisers"; empty if unclassified.
+	Capital    bool   `json:"capital,omitempty"` // Capital ships also get the "capitals" topic.
+	Tech       int    `json:"tech"`              // 1, 2 or 3; 0 when the group has no tech level.
+}
+
+// shipGroupFile is the on-disk layout of shipgroups.json written by gen-sde.
+type shipGroupFile struct {
+	Groups map[int]*ShipGroup `json:"groups"`
+}
+
+// shipClass is how gen-sde classifies an SDE group.
+type shipClass struct {
+	Class   string
+	Capital bool
+}
+
+// shipClassesByGroupName classifies SDE groups by their English name, which is far more
+// readable than a list of IDs. gen-sde warns about published ship groups missing from here, so
+// new hulls get noticed when the SDE is regenerated. Structure groups not listed are skipped.
+var shipClassesByGroupName = map[string]shipClass{
+	"Frigate":                    {Class: "frigates"},
+	"Assault Frigate":            {Class: "frigates"},
+	"Covert Ops":                 {Class: "frigates"},
+	"Interceptor":                {Class: "frigates"},
+	"Stealth Bomber":             {Class: "frigates"},
+	"Electronic Attack Ship":     {Class: "frigates"},
+	"Expedition Frigate":         {Class: "frigates"},
+	"Logistics Frigate":          {Class: "frigates"},
+	"Prototype Exploration Ship": {Class: "frigates"},
+
+	"Destroyer":          {Class: "destroyers"},
+	"Interdictor":        {Class: "destroyers"},
+	"Command Destroyer":  {Class: "destroyers"},
+	"Tactical Destroyer": {Class: "destroyers"},
+
+	"Cruiser":                    {Class: "cruisers"},
+	"Heavy Assault Cruiser":      {Class: "cruisers"},
+	"Logistics":                  {Class: "cruisers"},
+	"Force Recon Ship":           {Class: "cruisers"},
+	"Combat Recon Ship":          {Class: "cruisers"},
+	"Heavy Interdiction Cruiser": {Class: "cruisers"},
+	"Strategic Cruiser":          {Class: "cruisers"},
+	"Flag Cruiser":               {Class: "cruisers"},
+
+	"Combat Battlecruiser": {Class: "battlecruisers"},
+	"Attack Battlecruiser": {Class: "battlecruisers"},
+	"Command Ship":         {Class: "battlecruisers"},
+
+	"Battleship": {Class: "battleships"},
+	"Black Ops":  {Class: "battleships"},
+	"Marauder":   {Class: "battleships"},
+
+	"Hauler":                  {Class: "industrials"},
+	"Deep Space Transport":    {Class: "industrials"},
+	"Blockade Runner":         {Class: "industrials"},
+	"Industrial Command Ship": {Class: "industrials"},
+	"Expedition Command Ship": {Class: "industrials"},
+
+	"Mining Barge": {Class: "mining"},
+	"Exhumer":      {Class: "mining"},
+
+	"Freighter":      {Class: "freighters"},
+	"Jump Freighter": {Class: "freighters"},
+
+	"Capital Industrial Ship": {Class: "industrials", Capital: true},
+	"Dreadnought":             {Class: "dreadnoughts", Capital: true},
+	"Lancer Dreadnought":      {Class: "dreadnoughts", Capital: true},
+	"Carrier":                 {Class: "carriers", Capital: true},
+	"Force Auxiliary":         {Class: "carriers", Capital: true},
+	"Supercarrier":            {Class: "supercarriers", Capital: true},
+	"Titan":                   {Class: "titans", Capital: true},
+
+	"Shuttle":  {Class: "shuttles"},
+	"Corvette": {Class: "corvettes"},
+	"Capsule":  {Class: "pods"},
+
+	"Citadel":             {Class: "citadel"},
+	"Engineering Complex": {Class: "citadel"},
+	"Refinery":            {Class: "citadel"},
+}
+
+// shipGroups is loaded once at startup and read-only afterwards, so it needs no lock.
+var shipGroups = map[int]*ShipGroup{}
+
+// loadShipGroups reads shipgroups.json. Without it, kills only get value, location and
+// attribute topics.
+func loadShipGroups(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file shipGroupFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	shipGroups = file.Groups
+	log.Printf("Loaded %d ship groups from %s.", len(shipGroups), path)
+	return nil
+}
+
+// Topics returns the killmail topics for a victim in this group: its class, "capitals" for
+// capital ships, and the tech level for sub-capital ships.
+func (g *ShipGroup) Topics() []string {
+	var topics []string
+	if g.Class != "" {
+		topics = append(topics, g.Class)
+	}
+	if g.Capital {
+		topics = append(topics, "capitals")
+	}
+	if g.CategoryID == sdeCategoryShip && !g.Capital && g.Class != "pods" && g.Tech > 0 {
+		topics = append(topics, "t"+strconv.Itoa(g.Tech))
+	}
+	return topics
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// shipGroupCases lists every published ship group in the SDE, plus the structure groups tagged
+// as citadels, with the topics a victim in it gets. A group added by a new SDE must be added here
+// too; TestShipGroupsMatchSDE fails until it is.
+var shipGroupCases = []struct {
+	groupID int
+	name    string
+	topics  []string
+}{
+	{25, "Frigate", []string{"frigates", "t1"}},
+	{324, "Assault Frigate", []string{"frigates", "t2"}},
+	{830, "Covert Ops", []string{"frigates", "t2"}},
+	{831, "Interceptor", []string{"frigates", "t2"}},
+	{834, "Stealth Bomber", []string{"frigates", "t2"}},
+	{893, "Electronic Attack Ship", []string{"frigates", "t2"}},
+	{1283, "Expedition Frigate", []string{"frigates", "t2"}},
+	{1527, "Logistics Frigate", []string{"frigates", "t2"}},
+	{1022, "Prototype Exploration Ship", []string{"frigates", "t1"}},
+
+	{420, "Destroyer", []string{"destroyers", "t1"}},
+	{541, "Interdictor", []string{"destroyers", "t2"}},
+	{1534, "Command Destroyer", []string{"destroyers", "t2"}},
+	{1305, "Tactical Destroyer", []string{"destroyers", "t3"}},
+
+	{26, "Cruiser", []string{"cruisers", "t1"}},
+	{358, "Heavy Assault Cruiser", []string{"cruisers", "t2"}},
+	{832, "Logistics", []string{"cruisers", "t2"}},
+	{833, "Force Recon Ship", []string{"cruisers", "t2"}},
+	{906, "Combat Recon Ship", []string{"cruisers", "t2"}},
+	{894, "Heavy Interdiction Cruiser", []string{"cruisers", "t2"}},
+	{963, "Strategic Cruiser", []string{"cruisers", "t3"}},
+	{1972, "Flag Cruiser", []string{"cruisers", "t1"}},
+
+	{419, "Combat Battlecruiser", []string{"battlecruisers", "t1"}},
+	{1201, "Attack Battlecruiser", []string{"battlecruisers", "t1"}},
+	{540, "Command Ship", []string{"battlecruisers", "t2"}},
+
+	{27, "Battleship", []string{"battleships", "t1"}},
+	{898, "Black Ops", []string{"battleships", "t2"}},
+	{900, "Marauder", []string{"battleships", "t2"}},
+
+	{28, "Hauler", []string{"industrials", "t1"}},
+	{380, "Deep Space Transport", []string{"industrials", "t2"}},
+	{1202, "Blockade Runner", []string{"industrials", "t2"}},
+	{941, "Industrial Command Ship", []string{"industrials", "t1"}},
+	{4902, "Expedition Command Ship", []string{"industrials", "t1"}},
+	{463, "Mining Barge", []string{"mining", "t1"}},
+	{543, "Exhumer", []string{"mining", "t2"}},
+	{513, "Freighter", []string{"freighters", "t1"}},
+	{902, "Jump Freighter", []string{"freighters", "t2"}},
+
+	{883, "Capital Industrial Ship", []string{"industrials", "capitals"}},
+	{485, "Dreadnought", []string{"dreadnoughts", "capitals"}},
+	{4594, "Lancer Dreadnought", []string{"dreadnoughts", "capitals"}},
+	{547, "Carrier", []string{"carriers", "capitals"}},
+	{1538, "Force Auxiliary", []string{"carriers", "capitals"}},
+	{659, "Supercarrier", []string{"supercarriers", "capitals"}},
+	{30, "Titan", []string{"titans", "capitals"}},
+
+	{31, "Shuttle", []string{"shuttles", "t1"}},
+	{237, "Corvette", []string{"corvettes", "t1"}},
+	{29, "Capsule", []string{"pods"}},
+
+	{1657, "Citadel", []string{"citadel"}},
+	{1404, "Engineering Complex", []string{"citadel"}},
+	{1406, "Refinery", []string{"citadel"}},
+}
+
+// TestShipGroupTopics checks the topics of every group in the committed shipgroups.json.
+func TestShipGroupTopics(t *testing.T) {
+	if err := loadShipGroups(shipGroupsPath); err != nil {
+		t.Fatalf("loadShipGroups: %v", err)
+	}
+
+	covered := make(map[int]bool)
+	for _, tt := range shipGroupCases {
+		covered[tt.groupID] = true
+		t.Run(tt.name, func(t *testing.T) {
+			group, ok := shipGroups[tt.groupID]
+			if !ok {
+				t.Fatalf("group %d is missing from %s", tt.groupID, shipGroupsPath)
+			}
+			if group.Name != tt.name {
+				t.Errorf("group %d is named %q, want %q", tt.groupID, group.Name, tt.name)
+			}
+
+			data := &KillmailData{}
+			data.Killmail.Victim.ShipGroupID = tt.groupID
+			data.Killmail.SystemSecurity = 0.9
+			topics := generateKillmailTopics(data)
+			want := append([]string{"all", "highsec"}, tt.topics...)
+			if !slices.Equal(topics, want) {
+				t.Errorf("topics = %v, want %v", topics, want)
+			}
+		})
+	}
+
+	for id, group := range shipGroups {
+		if !covered[id] {
+			t.Errorf("group %d (%s) has no test case", id, group.Name)
+		}
+		if group.Class == "" {
+			t.Errorf("group %d (%s) has no class", id, group.Name)
+		}
+	}
+}
+
+// TestShipGroupsMatchSDE regenerates the ship groups from a real SDE and fails on every group
+// that shipgroups.json or shipGroupCases lacks or gets wrong. The SDE is too large to keep in
+// the repository, so it only runs when FIREHAWK_SDE points at the JSONL zip or directory:
+//
+//	FIREHAWK_SDE=eve-online-static-data-latest-jsonl.zip go test -run TestShipGroupsMatchSDE .
+func TestShipGroupsMatchSDE(t *testing.T) {
+	sdePath := os.Getenv("FIREHAWK_SDE")
+	if sdePath == "" {
+		t.Skip("FIREHAWK_SDE is not set")
+	}
+	fsys, closeFn, err := openSDE(sdePath)
+	if err != nil {
+		t.Fatalf("openSDE: %v", err)
+	}
+	defer closeFn()
+	sde, err := buildShipGroups(fsys)
+	if err != nil {
+		t.Fatalf("buildShipGroups: %v", err)
+	}
+
+	data, err := os.ReadFile(shipGroupsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var committed shipGroupFile
+	if err := json.Unmarshal(data, &committed); err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range shipGroupProblems(sde, &committed) {
+		t.Error(problem)
+	}
+}
+
+// TestShipGroupProblems runs the SDE comparison against the fixture SDE, which has only a few of
+// the real groups, so every way of falling behind the SDE is reported.
+func TestShipGroupProblems(t *testing.T) {
+	fsys, closeFn, err := openSDE(filepath.Join("testdata", "sde"))
+	if err != nil {
+		t.Fatalf("openSDE: %v", err)
+	}
+	defer closeFn()
+	sde, err := buildShipGroups(fsys)
+	if err != nil {
+		t.Fatalf("buildShipGroups: %v", err)
+	}
+	committed := &shipGroupFile{Groups: map[int]*ShipGroup{
+		25:  {GroupID: 25, Name: "Frigate", CategoryID: 6, Class: "frigates", Tech: 1},
+		324: {GroupID: 324, Name: "Assault Frigate", CategoryID: 6, Class: "frigates", Tech: 1},
+		26:  {GroupID: 26, Name: "Cruiser", CategoryID: 6, Class: "cruisers", Tech: 1},
+	}}
+	if problems := shipGroupProblems(sde, sde); len(problems) != 0 {
+		t.Errorf("the fixture against itself: %v", problems)
+	}
+
+	problems := strings.Join(shipGroupProblems(sde, committed), "\n")
+	for _, want := range []string{
+		"group 29 (Capsule) is missing from shipgroups.json",
+		"group 324 in shipgroups.json is",
+		"group 26 (Cruiser) in shipgroups.json is not in the SDE",
+	} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("problems do not report %q:\n%s", want, problems)
+		}
+	}
+	if strings.Contains(problems, "group 25 ") {
+		t.Errorf("an up-to-date group is reported:\n%s", problems)
+	}
+}
+
+// shipGroupProblems compares the groups generated from an SDE with the committed ones and with
+// shipGroupCases, describing every difference.
+func shipGroupProblems(sde, committed *shipGroupFile) []string {
+	cases := make(map[int]string)
+	for _, c := range shipGroupCases {
+		cases[c.groupID] = c.name
+	}
+	var problems []string
+	for id, group := range sde.Groups {
+		if group.Class == "" {
+			problems = append(problems, fmt.Sprintf("SDE group %d (%s) has no class; add it to shipClassesByGroupName", id, group.Name))
+		}
+		if got, ok := committed.Groups[id]; !ok {
+			problems = append(problems, fmt.Sprintf("group %d (%s) is missing from %s; run gen-sde", id, group.Name, shipGroupsPath))
+		} else if *got != *group {
+			problems = append(problems, fmt.Sprintf("group %d in %s is %+v, the SDE gives %+v; run gen-sde", id, shipGroupsPath, *got, *group))
+		}
+		if name, ok := cases[id]; !ok {
+			problems = append(problems, fmt.Sprintf("SDE group %d (%s) has no case in shipGroupCases", id, group.Name))
+		} else if name != group.Name {
+			problems = append(problems, fmt.Sprintf("shipGroupCases names group %d %q, the SDE %q", id, name, group.Name))
+		}
+	}
+	for id, group := range committed.Groups {
+		if _, ok := sde.Groups[id]; !ok {
+			problems = append(problems, fmt.Sprintf("group %d (%s) in %s is not in the SDE", id, group.Name, shipGroupsPath))
+		}
+	}
+	slices.Sort(problems)
+	return problems
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KillmailSource is an upstream feed of killmails. Run streams normalized killmails into out
+// until ctx is cancelled, reconnecting on its own; it only returns early on a fatal error.
+type KillmailSource interface {
+	Name() string
+	Run(ctx context.Context, out chan<- *KillmailData) error
+	State() SourceState
+}
+
+// reconnecter is implemented by sources that hold a connection open and can drop it on request.
+type reconnecter interface {
+	Reconnect()
+}
+
+// SourceState is a snapshot of a source's connection health.
+type SourceState struct {
+	Name           string    `json:"name"`
+	Connected      bool      `json:"connected"`
+	ConnectedSince time.Time `json:"connected_since,omitzero"`
+	LastMessage    time.Time `json:"last_message,omitzero"`  // Anything from upstream, including pings.
+	LastKillmail   time.Time `json:"last_killmail,omitzero"` // The last actual killmail.
+	Reconnects     int       `json:"reconnects"`
+	LastError      string    `json:"last_error,omitempty"`
+	Topics         []string  `json:"topics,omitempty"` // Upstream topics, for sources that filter upstream.
+}
+
+// sourceStatus tracks a source's SourceState. Sources embed it and update it as they run.
+type sourceStatus struct {
+	mu    sync.Mutex
+	state SourceState
+}
+
+func (s *sourceStatus) markConnected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state.Connected {
+		return
+	}
+	if !s.state.ConnectedSince.IsZero() {
+		s.state.Reconnects++
+	}
+	s.state.Connected = true
+	s.state.ConnectedSince = time.Now()
+}
+
+func (s *sourceStatus) markDisconnected(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Connected = false
+	if err != nil {
+		s.state.LastError = err.Error()
+	}
+}
+
+func (s *sourceStatus) markMessage() {
+	s.mu.Lock()
+	s.state.LastMessage = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *sourceStatus) markKillmail() {
+	s.mu.Lock()
+	s.state.LastMessage = time.Now()
+	s.state.LastKillmail = s.state.LastMessage
+	s.mu.Unlock()
+}
+
+func (s *sourceStatus) setTopics(topics []string) {
+	s.mu.Lock()
+	s.state.Topics = append([]string(nil), topics...)
+	s.mu.Unlock()
+}
+
+// State returns a copy of the current state.
+func (s *sourceStatus) State() SourceState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// publishSourceStates exposes every source's state on the /debug/vars endpoint.
+func publishSourceStates(sources []KillmailSource) {
+	expvar.Publish("sources", expvar.Func(func() any { return sourceStates(sources) }))
+}
+
+// sourceStates returns the state of every source.
+func sourceStates(sources []KillmailSource) []SourceState {
+	states := make([]SourceState, 0, len(sources))
+	for _, src := range sources {
+		state := src.State()
+		state.Name = src.Name()
+		states = append(states, state)
+	}
+	return states
+}
+
+// Source names accepted in KILLMAIL_SOURCES.
+const (
+	sourceEveKill = "evekill"
+	sourceRedisQ  = "redisq"
+	sourceR2Z2    = "r2z2"
+)
+
+// recentKillmailLimit is how many killmail IDs the source multiplexer remembers, which only has
+// to cover the overlap between sources. The same kill arrives from each of them within minutes.
+const recentKillmailLimit = 10000
+
+// sourcesFromEnv builds the sources listed in KILLMAIL_SOURCES (comma-separated, default
+// "evekill"). Several sources can run together; their kills are deduplicated by ID.
+func sourcesFromEnv(esi *ESIClient) ([]KillmailSource, error) {
+	names := os.Getenv("KILLMAIL_SOURCES")
+	if names == "" {
+		names = sourceEveKill
+	}
+
+	var sources []KillmailSource
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case sourceEveKill:
+			url := os.Getenv("EVEKILL_WS_URL") // e.g. a local `firehawk replay`
+			if url == "" {
+				url = killmailWebSocketURL
+			}
+			src := newEveKillSource(url)
+			src.topics = requiredUpstreamTopics
+			src.topicsChanged = topicsChanged
+			var err error
+			if src.dialTimeout, err = envDuration("EVEKILL_DIAL_TIMEOUT", src.dialTimeout); err != nil {
+				return nil, err
+			}
+			if src.stallTimeout, err = envDuration("EVEKILL_STALL_TIMEOUT", src.stallTimeout); err != nil {
+				return nil, err
+			}
+			if path := os.Getenv("EVEKILL_RECORD"); path != "" {
+				if src.recorder, err = NewFrameRecorder(path); err != nil {
+					return nil, fmt.Errorf("cannot record eve-kill frames: %w", err)
+				}
+				log.Printf("Recording eve-kill frames to %s", path)
+			}
+			sources = append(sources, src)
+		case sourceRedisQ:
+			queueID := os.Getenv("ZKILL_QUEUE_ID")
+			if queueID == "" {
+				return nil, fmt.Errorf("ZKILL_QUEUE_ID must be set to use the redisq source")
+			}
+			sources = append(sources, newRedisQSource(redisQURL, queueID, esi))
+		case sourceR2Z2:
+			sources = append(sources, newR2Z2Source(r2z2BaseURL, esi))
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown killmail source %q (expected %s, %s or %s)", name, sourceEveKill, sourceRedisQ, sourceR2Z2)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("KILLMAIL_SOURCES lists no sources")
+	}
+	return sources, nil
+}
+
+// runKillmailSources runs every source and calls handle once per distinct killmail, in the order
+// they arrive, until ctx is cancelled.
+func runKillmailSources(ctx context.Context, sources []KillmailSource, handle func(*KillmailData)) {
+	out := make(chan *KillmailData, 100)
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src KillmailSource) {
+			defer wg.Done()
+			log.Printf("Starting killmail source: %s", src.Name())
+			if err := src.Run(ctx, out); err != nil && ctx.Err() == nil {
+				log.Printf("Killmail source %s stopped: %v", src.Name(), err)
+			}
+		}(src)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	recent := newRecentKillmails(recentKillmailLimit)
+	for data := range out {
+		if !recent.Add(data.Killmail.KillmailID) {
+			continue
+		}
+		handle(data)
+	}
+}
+
+// recentKillmails is a fixed-size set of the newest killmail IDs; the oldest falls out first.
+type recentKillmails struct {
+	ids   map[int]struct{}
+	order []int
+	next  int
+}
+
+func newRecentKillmails(limit int) *recentKillmails {
+	return &recentKillmails{ids: make(map[int]struct{}, limit), order: make([]int, 0, limit)}
+}
+
+// Add records the ID and reports whether it was new.
+func (r *recentKillmails) Add(id int) bool {
+	if _, seen := r.ids[id]; seen {
+		return false
+	}
+	if len(r.order) < cap(r.order) {
+		r.order = append(r.order, id)
+	} else {
+		delete(r.ids, r.order[r.next])
+		r.order[r.next] = id
+		r.next = (r.next + 1) % len(r.order)
+	}
+	r.ids[id] = struct{}{}
+	return true
+}
+
+// envDuration reads a duration such as "30s" or "10m" from the environment, or returns def.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as 30s or 10m, got %q", name, value)
+	}
+	return d, nil
+}
+
+// backoffDelay returns how long to wait before reconnect attempt n (starting at 1): doubling
+// from base up to max, with jitter so many clients don't reconnect in lockstep after an outage.
+func backoffDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := max
+	if attempt < 31 {
+		delay = min(base<<(attempt-1), max)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// sleepContext waits for d, or returns false early if ctx is cancelled.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
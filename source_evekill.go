@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Connection tuning for the eve-kill feed. The dial and stall timeouts can be changed with
+// EVEKILL_DIAL_TIMEOUT and EVEKILL_STALL_TIMEOUT.
+const (
+	eveKillDialTimeout  = 15 * time.Second
+	eveKillPongWait     = 60 * time.Second
+	eveKillPingInterval = 25 * time.Second
+	eveKillWriteWait    = 10 * time.Second
+	eveKillStallTimeout = 10 * time.Minute
+	eveKillNarrowStall  = 3 * time.Hour // See watchdog.
+	eveKillMinBackoff   = time.Second
+	eveKillMaxBackoff   = 2 * time.Minute
+	eveKillHealthyAfter = time.Minute // A connection that lasted this long resets the backoff.
+)
+
+// errStalled is reported when the connection is alive but no killmail has arrived for too long.
+var errStalled = errors.New("no killmail received within the stall timeout")
+
+// errReconnectRequested is reported when an operator asked for a fresh connection.
+var errReconnectRequested = errors.New("reconnect requested")
+
+// errTopicsDropped is reported when the feeds no longer need an upstream topic. eve-kill has no
+// documented way to leave a topic, so the source reconnects with the smaller set instead.
+var errTopicsDropped = errors.New("upstream topics dropped")
+
+// eveKillSource streams killmails from eve-kill's WebSocket feed. Run supervises the connection:
+// it reconnects with exponential backoff, pings the server, and reconnects when the feed goes
+// quiet for longer than the stall timeout, since a healthy "all" feed never does.
+//
+// Only the topics returned by topics are subscribed upstream. Each topic is sent as its bare
+// name, the way the feed has always been subscribed to "all". Topics added while connected are
+// subscribed in place whenever topicsChanged fires; dropping one takes a reconnect.
+type eveKillSource struct {
+	sourceStatus
+
+	topics        func() []string
+	topicsChanged <-chan struct{}
+	reconnect     chan struct{} // See Reconnect.
+
+	url          string
+	dialTimeout  time.Duration
+	pongWait     time.Duration
+	pingInterval time.Duration
+	writeWait    time.Duration
+	stallTimeout time.Duration
+	narrowStall  time.Duration // The stall timeout while not subscribed to "all".
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+
+	recorder *FrameRecorder // Records every received frame when set; see EVEKILL_RECORD.
+}
+
+func newEveKillSource(url string) *eveKillSource {
+	return &eveKillSource{
+		topics:       func() []string { return []string{topicAll} },
+		reconnect:    make(chan struct{}, 1),
+		url:          url,
+		dialTimeout:  eveKillDialTimeout,
+		pongWait:     eveKillPongWait,
+		pingInterval: eveKillPingInterval,
+		writeWait:    eveKillWriteWait,
+		stallTimeout: eveKillStallTimeout,
+		narrowStall:  eveKillNarrowStall,
+		minBackoff:   eveKillMinBackoff,
+		maxBackoff:   eveKillMaxBackoff,
+	}
+}
+
+func (e *eveKillSource) Name() string { return sourceEveKill }
+
+// Reconnect drops the current connection and dials again straight away, skipping any backoff.
+func (e *eveKillSource) Reconnect() {
+	select {
+	case e.reconnect <- struct{}{}:
+	default: // One is already pending.
+	}
+}
+
+// Run keeps a connection open, reconnecting after every failure, until ctx is cancelled.
+func (e *eveKillSource) Run(ctx context.Context, out chan<- *KillmailData) error {
+	log.Println("Kicking off web socket connection")
+	attempt := 0
+	for { // Main reconnection loop
+		started := time.Now()
+		err := e.stream(ctx, out)
+		e.markDisconnected(err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if errors.Is(err, errReconnectRequested) || errors.Is(err, errTopicsDropped) {
+			log.Printf("eve-kill stream reconnecting: %v", err)
+			attempt = 0
+			continue
+		}
+
+		if time.Since(started) >= eveKillHealthyAfter {
+			attempt = 0
+		}
+		attempt++
+		delay := backoffDelay(attempt, e.minBackoff, e.maxBackoff)
+		log.Printf("eve-kill stream disconnected (%v), reconnecting in %s (attempt %d)", err, delay.Round(time.Millisecond), attempt)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-e.reconnect: // Asked to reconnect while waiting; do it now.
+			timer.Stop()
+			attempt = 0
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// eveKillConn is one live connection. Reads happen on a single goroutine; writes of data
+// messages are serialised by writeMu. Pings use WriteControl, which is safe alongside both.
+type eveKillConn struct {
+	*websocket.Conn
+	writeMu   sync.Mutex
+	writeWait time.Duration
+}
+
+func (c *eveKillConn) writeText(message string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(c.writeWait))
+	return c.WriteMessage(websocket.TextMessage, []byte(message))
+}
+
+// stream runs a single connection until it fails or ctx is cancelled.
+func (e *eveKillSource) stream(ctx context.Context, out chan<- *KillmailData) error {
+	dialCtx, cancelDial := context.WithTimeout(ctx, e.dialTimeout)
+	ws, _, err := websocket.DefaultDialer.DialContext(dialCtx, e.url, nil)
+	cancelDial()
+	if err != nil {
+		return fmt.Errorf("error connecting to WebSocket: %w", err)
+	}
+	conn := &eveKillConn{Conn: ws, writeWait: e.writeWait}
+	defer conn.Close()
+
+	// Handles low-level protocol pings to keep the connection alive.
+	conn.SetReadDeadline(time.Now().Add(e.pongWait))
+	conn.SetPongHandler(func(string) error {
+		e.markMessage()
+		conn.SetReadDeadline(time.Now().Add(e.pongWait))
+		return nil
+	})
+
+	topics := e.topics()
+	if err := subscribeTopics(conn, topics); err != nil {
+		return fmt.Errorf("error subscribing to killmail feed: %w", err)
+	}
+	e.setTopics(topics)
+	e.markConnected()
+	log.Printf("Web socket connected and subscribed to topics %v, filters will apply accordingly.", topics)
+
+	// The watchdog closes the connection when it stalls or ctx ends, which unblocks the read.
+	connCtx, cancelConn := context.WithCancelCause(ctx)
+	defer cancelConn(nil)
+	go e.watchdog(connCtx, cancelConn, conn)
+
+	for { // Message reading loop
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if cause := context.Cause(connCtx); cause != nil {
+				return cause
+			}
+			return fmt.Errorf("read error: %w", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(e.pongWait))
+		e.markMessage()
+		if e.recorder != nil {
+			e.recorder.Record(message)
+		}
+
+		// First, unmarshal the message into our generic SocketMessage to read its type.
+		var msg SocketMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			log.Printf("Error unmarshaling socket envelope: %s", string(message))
+			continue
+		}
+
+		// Use a switch statement to handle different kinds of server messages.
+		switch msg.Type {
+		case "killmail":
+			var killmailData KillmailData
+			if err := json.Unmarshal(msg.Data, &killmailData); err != nil {
+				log.Printf("Error unmarshaling killmail payload: %v", err)
+				continue
+			}
+			e.markKillmail()
+			select {
+			case out <- &killmailData:
+			case <-ctx.Done():
+				return nil
+			}
+
+		case "ping":
+			// Handles application-level pings by echoing the timestamp in a JSON reply.
+			var pingMsg PingMessage
+			if err := json.Unmarshal(message, &pingMsg); err == nil {
+				pongReply := fmt.Sprintf(`{"type":"pong","timestamp":"%s"}`, pingMsg.Timestamp)
+				if err := conn.writeText(pongReply); err != nil {
+					log.Printf("Error sending application pong: %v", err)
+				}
+			}
+
+		case "info", "subscribed":
+			// Handle standard server status messages by logging them.
+			log.Printf("Received server message: type=%s", msg.Type)
+
+		default:
+			// Log any message types we don't currently handle, for debugging purposes.
+			log.Printf("Received unhandled type: '%s'", msg.Type)
+		}
+	}
+}
+
+// subscribeTopics sends one subscription frame per topic, each the topic's bare name.
+func subscribeTopics(conn *eveKillConn, topics []string) error {
+	for _, topic := range topics {
+		if err := conn.writeText(topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resubscribe moves the live connection to the topics the feeds need now. New topics are
+// subscribed in place; if any current topic is no longer needed, it returns errTopicsDropped
+// and sends nothing, so the caller reconnects with the new set.
+func (e *eveKillSource) resubscribe(conn *eveKillConn) error {
+	current := e.State().Topics
+	subscribe, unsubscribe := diffTopics(current, e.topics())
+	if len(unsubscribe) > 0 {
+		return fmt.Errorf("%w: %v", errTopicsDropped, unsubscribe)
+	}
+	if len(subscribe) == 0 {
+		return nil
+	}
+	if err := subscribeTopics(conn, subscribe); err != nil {
+		return err
+	}
+	log.Printf("Subscribed to more eve-kill topics: %v", subscribe)
+	e.setTopics(slices.Concat(current, subscribe))
+	return nil
+}
+
+// watchdog sends protocol pings, applies topic changes, and closes the connection if it has
+// stalled: connected, maybe even answering pings, but with no killmail for longer than the
+// stall timeout. Narrow topic sets can legitimately be quiet for a long time, so they get the
+// much longer narrowStall instead; it still catches a subscription the server never honoured,
+// and reconnecting a quiet feed costs nothing as replayed kills are deduplicated.
+func (e *eveKillSource) watchdog(ctx context.Context, cancel context.CancelCauseFunc, conn *eveKillConn) {
+	defer conn.Close()
+	connected := time.Now()
+	ticker := time.NewTicker(min(e.pingInterval, e.stallTimeout))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.topicsChanged:
+			if err := e.resubscribe(conn); errors.Is(err, errTopicsDropped) {
+				cancel(err)
+				return
+			} else if err != nil {
+				cancel(fmt.Errorf("resubscribe failed: %w", err))
+				return
+			}
+			continue
+		case <-e.reconnect:
+			cancel(errReconnectRequested)
+			return
+		case <-ticker.C:
+		}
+
+		if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(e.writeWait)); err != nil {
+			cancel(fmt.Errorf("ping failed: %w", err))
+			return
+		}
+
+		state := e.State()
+		timeout := e.stallTimeout
+		if !slices.Contains(state.Topics, topicAll) {
+			timeout = e.narrowStall
+		}
+		lastKill := state.LastKillmail
+		if lastKill.Before(connected) {
+			lastKill = connected
+		}
+		if time.Since(lastKill) > timeout {
+			log.Printf("eve-kill stream stalled: no killmail for %s, forcing a reconnect", time.Since(lastKill).Round(time.Second))
+			cancel(errStalled)
+			return
+		}
+	}
+}
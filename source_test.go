@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// receiveKillmail waits for one killmail from a running source.
+func receiveKillmail(t *testing.T, out <-chan *KillmailData) *KillmailData {
+	t.Helper()
+	select {
+	case data := <-out:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a killmail")
+		return nil
+	}
+}
+
+// newFakeESI serves the two ESI calls the zKillboard sources make, and returns a client for it
+// with Rifter's home system in the static cache.
+func newFakeESI(t *testing.T) *ESIClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/universe/names/":
+			names := map[int]ESINameHit{
+				90000001: {ID: 90000001, Name: "Victim Pilot", Category: "character"},
+				98000001: {ID: 98000001, Name: "Victim Corp", Category: "corporation"},
+				99000001: {ID: 99000001, Name: "Victim Alliance", Category: "alliance"},
+				90000002: {ID: 90000002, Name: "Attacker Pilot", Category: "character"},
+				98000002: {ID: 98000002, Name: "Attacker Corp", Category: "corporation"},
+				587:      {ID: 587, Name: "Rifter", Category: "inventory_type"},
+				24690:    {ID: 24690, Name: "Hurricane", Category: "inventory_type"},
+			}
+			var ids []int
+			json.NewDecoder(r.Body).Decode(&ids)
+			var hits []ESINameHit
+			for _, id := range ids {
+				if hit, ok := names[id]; ok {
+					hits = append(hits, hit)
+				}
+			}
+			json.NewEncoder(w).Encode(hits)
+		case r.URL.Path == "/universe/types/587/":
+			w.Write([]byte(`{"name":"Rifter","group_id":25}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	esi := NewESIClient("test")
+	esi.baseURL = srv.URL
+	esi.systemInfoCache[30002187] = &ESISystemInfo{SystemID: 30002187, Name: "Amarr", SecurityStatus: 1.0, RegionID: 10000043}
+	esi.regionNames[10000043] = "Domain"
+	return esi
+}
+
+const fakeESIKillmail = `{
+	"killmail_id": %d,
+	"killmail_time": "2026-01-02T03:04:05Z",
+	"solar_system_id": 30002187,
+	"victim": {"character_id": 90000001, "corporation_id": 98000001, "alliance_id": 99000001, "ship_type_id": 587},
+	"attackers": [{"character_id": 90000002, "corporation_id": 98000002, "ship_type_id": 24690, "final_blow": true}]
+}`
+
+func fakeESIKillmailJSON(id int) string {
+	return fmt.Sprintf(fakeESIKillmail, id)
+}
+
+func checkNormalizedKillmail(t *testing.T, data *KillmailData, wantID int) {
+	t.Helper()
+	k := data.Killmail
+	if k.KillmailID != wantID {
+		t.Errorf("KillmailID = %d, want %d", k.KillmailID, wantID)
+	}
+	if k.SystemName != "Amarr" || k.RegionID != 10000043 || k.RegionName.En != "Domain" || k.SystemSecurity != 1.0 {
+		t.Errorf("location = %s/%d/%s/%.1f, want Amarr/10000043/Domain/1.0", k.SystemName, k.RegionID, k.RegionName.En, k.SystemSecurity)
+	}
+	if k.TotalValue != 12345678.9 || !k.IsSolo || k.IsNpc {
+		t.Errorf("zkb data = %.1f solo=%v npc=%v", k.TotalValue, k.IsSolo, k.IsNpc)
+	}
+	v := k.Victim
+	if v.CharacterName != "Victim Pilot" || v.CorporationName != "Victim Corp" || v.AllianceName != "Victim Alliance" {
+		t.Errorf("victim names = %q %q %q", v.CharacterName, v.CorporationName, v.AllianceName)
+	}
+	if v.ShipName.En != "Rifter" || v.ShipGroupID != 25 {
+		t.Errorf("victim ship = %q group %d, want Rifter group 25", v.ShipName.En, v.ShipGroupID)
+	}
+	if len(k.Attackers) != 1 || k.Attackers[0].CharacterName != "Attacker Pilot" || k.Attackers[0].ShipName.En != "Hurricane" || !k.Attackers[0].FinalBlow {
+		t.Errorf("attackers = %+v", k.Attackers)
+	}
+}
+
+func TestEveKillSourceStreamsKillmails(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	pong := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "all" {
+			t.Errorf("subscription message = %s, %v; want a subscription to all", msg, err)
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping","timestamp":"2026-01-02T03:04:05Z"}`))
+		if _, msg, err := conn.ReadMessage(); err == nil {
+			pong <- string(msg)
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"killmail","data":{"killmail":{"killmail_id":42,"system_name":"Jita","total_value":1500000,"victim":{"ship_name":{"en":"Rifter"}}}}}`))
+		conn.ReadMessage() // Hold the connection open until the client goes away.
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan *KillmailData, 1)
+	src := newEveKillSource("ws" + strings.TrimPrefix(srv.URL, "http"))
+	done := make(chan error, 1)
+	go func() { done <- src.Run(ctx, out) }()
+
+	data := receiveKillmail(t, out)
+	if data.Killmail.KillmailID != 42 || data.Killmail.SystemName != "Jita" || data.Killmail.Victim.ShipName.En != "Rifter" {
+		t.Errorf("got killmail %+v", data.Killmail)
+	}
+	select {
+	case msg := <-pong:
+		if msg != `{"type":"pong","timestamp":"2026-01-02T03:04:05Z"}` {
+			t.Errorf("pong = %s", msg)
+		}
+	default:
+		t.Error("no pong was sent for the application ping")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestRedisQSourceNormalizesKillmail(t *testing.T) {
+	esi := newFakeESI(t)
+	var polls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("queueID"); got != "firehawk-test" {
+			t.Errorf("queueID = %q", got)
+		}
+		if polls.Add(1) == 1 {
+			w.Write([]byte(`{"package":{"killID":77,"killmail":` + fakeESIKillmailJSON(77) + `,"zkb":{"totalValue":12345678.9,"solo":true,"npc":false}}}`))
+			return
+		}
+		w.Write([]byte(`{"package":null}`))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan *KillmailData, 1)
+	src := newRedisQSource(srv.URL, "firehawk-test", esi)
+	go src.Run(ctx, out)
+
+	checkNormalizedKillmail(t, receiveKillmail(t, out), 77)
+}
+
+// A source being stopped doesn't wait out ESI's error limit to finish the kill in hand.
+func TestNormalizeESIKillmailStopsWithContext(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		setErrorLimit(w, 0, 60)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	esi := NewESIClient("test")
+	esi.baseURL = srv.URL
+	esi.GetCharacterName(context.Background(), 1) // Spends the last of the error limit.
+
+	var km ESIKillmail
+	if err := json.Unmarshal([]byte(fakeESIKillmailJSON(77)), &km); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	data := normalizeESIKillmail(ctx, esi, &km, &ZKBMeta{})
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("normalizing took %s, want it to end with the context", elapsed)
+	}
+	if data.Killmail.KillmailID != 77 || data.Killmail.Victim.CharacterName != "" {
+		t.Errorf("killmail = %+v", data.Killmail)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("ESI saw %d requests, want none while paused", n-1)
+	}
+}
+
+func TestR2Z2SourceFollowsSequence(t *testing.T) {
+	esi := newFakeESI(t)
+	var misses atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sequence.json":
+			w.Write([]byte(`{"sequence":500}`))
+		case "/500.json", "/501.json":
+			id := 500
+			if r.URL.Path == "/501.json" {
+				id = 501
+			}
+			w.Write([]byte(`{"killmail_id":` + strconv.Itoa(id) + `,"esi":` + fakeESIKillmailJSON(id) + `,"zkb":{"totalValue":12345678.9,"solo":true},"sequence_id":` + strconv.Itoa(id) + `}`))
+		default:
+			misses.Add(1)
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan *KillmailData, 2)
+	src := newR2Z2Source(srv.URL, esi)
+	src.pollInterval = 10 * time.Millisecond
+	go src.Run(ctx, out)
+
+	checkNormalizedKillmail(t, receiveKillmail(t, out), 500)
+	checkNormalizedKillmail(t, receiveKillmail(t, out), 501)
+
+	// Once caught up, the source keeps polling the next sequence number.
+	deadline := time.Now().Add(5 * time.Second)
+	for misses.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if misses.Load() < 2 {
+		t.Errorf("expected repeated polls for sequence 502, got %d", misses.Load())
+	}
+}
+
+// staticSource emits a fixed list of killmail IDs, then waits for cancellation.
+type staticSource struct {
+	name string
+	ids  []int
+}
+
+func (s *staticSource) Name() string { return s.name }
+
+func (s *staticSource) State() SourceState { return SourceState{Connected: true} }
+
+func (s *staticSource) Run(ctx context.Context, out chan<- *KillmailData) error {
+	for _, id := range s.ids {
+		data := &KillmailData{}
+		data.Killmail.KillmailID = id
+		out <- data
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRunKillmailSourcesDeduplicates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sources := []KillmailSource{
+		&staticSource{name: "a", ids: []int{1, 2, 3}},
+		&staticSource{name: "b", ids: []int{2, 3, 4}},
+	}
+	seen := make(chan int, 10)
+	go runKillmailSources(ctx, sources, func(data *KillmailData) { seen <- data.Killmail.KillmailID })
+
+	counts := make(map[int]int)
+	for range 4 {
+		select {
+		case id := <-seen:
+			counts[id]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out, got %v", counts)
+		}
+	}
+	select {
+	case id := <-seen:
+		t.Fatalf("killmail %d was handled twice", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	for id := 1; id <= 4; id++ {
+		if counts[id] != 1 {
+			t.Errorf("killmail %d handled %d times, want 1", id, counts[id])
+		}
+	}
+}
+
+func TestRecentKillmailsEvictsOldest(t *testing.T) {
+	r := newRecentKillmails(2)
+	if !r.Add(1) || !r.Add(2) || r.Add(1) {
+		t.Fatal("first two IDs should be new and then remembered")
+	}
+	if !r.Add(3) {
+		t.Fatal("3 should be new")
+	}
+	if !r.Add(1) {
+		t.Error("1 should have been evicted once 3 arrived")
+	}
+}
+
+func TestSourcesFromEnv(t *testing.T) {
+	t.Setenv("KILLMAIL_SOURCES", "evekill, r2z2")
+	sources, err := sourcesFromEnv(NewESIClient("test"))
+	if err != nil || len(sources) != 2 || sources[0].Name() != sourceEveKill || sources[1].Name() != sourceR2Z2 {
+		t.Fatalf("got %v, %v", sources, err)
+	}
+
+	t.Setenv("KILLMAIL_SOURCES", "redisq")
+	t.Setenv("ZKILL_QUEUE_ID", "")
+	if _, err := sourcesFromEnv(NewESIClient("test")); err == nil {
+		t.Error("redisq without ZKILL_QUEUE_ID should fail")
+	}
+
+	t.Setenv("KILLMAIL_SOURCES", "zkill")
+	if _, err := sourcesFromEnv(NewESIClient("test")); err == nil {
+		t.Error("unknown source should fail")
+	}
+}
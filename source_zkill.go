@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// zKillboard endpoints. RedisQ long-polls one kill at a time for a named queue; R2Z2 serves
+// every kill as a numbered static file.
+const (
+	redisQURL   = "https://zkillredisq.stream/listen.php"
+	r2z2BaseURL = "https://r2z2.zkillboard.com/ephemeral"
+)
+
+// zkillErrorDelay is how long the zKillboard sources wait after a failed request.
+const zkillErrorDelay = 5 * time.Second
+
+// redisQSource polls zKillboard's RedisQ. The queue ID must be unique to this bot, since
+// zKillboard keeps each queue's position on its side.
+type redisQSource struct {
+	sourceStatus
+
+	url        string
+	queueID    string
+	waitTime   time.Duration // ttw: how long RedisQ holds a request open when there is no kill.
+	errorDelay time.Duration
+	esi        *ESIClient
+	client     *http.Client
+}
+
+func newRedisQSource(listenURL, queueID string, esi *ESIClient) *redisQSource {
+	return &redisQSource{
+		url:        listenURL,
+		queueID:    queueID,
+		waitTime:   10 * time.Second,
+		errorDelay: zkillErrorDelay,
+		esi:        esi,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (r *redisQSource) Name() string { return sourceRedisQ }
+
+func (r *redisQSource) Run(ctx context.Context, out chan<- *KillmailData) error {
+	query := url.Values{}
+	query.Set("queueID", r.queueID)
+	query.Set("ttw", fmt.Sprint(int(r.waitTime/time.Second)))
+	listenURL := r.url + "?" + query.Encode()
+
+	for ctx.Err() == nil {
+		var resp RedisQResponse
+		status, err := getJSON(ctx, r.client, listenURL, &resp)
+		if err == nil && status != http.StatusOK {
+			err = fmt.Errorf("RedisQ returned status %d", status)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				r.markDisconnected(err)
+				log.Printf("RedisQ poll failed: %v", err)
+				sleepContext(ctx, r.errorDelay)
+			}
+			continue
+		}
+		r.markConnected()
+		if resp.Package == nil {
+			r.markMessage()
+			continue // Nothing happened within the wait time.
+		}
+		r.markKillmail()
+
+		data := normalizeESIKillmail(ctx, r.esi, &resp.Package.Killmail, &resp.Package.ZKB)
+		select {
+		case out <- data:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err()
+}
+
+// r2z2Source walks zKillboard's R2Z2 feed. It starts at the newest file and then fetches each
+// following sequence number; a 404 means that kill has not been published yet.
+type r2z2Source struct {
+	sourceStatus
+
+	baseURL      string
+	pollInterval time.Duration
+	errorDelay   time.Duration
+	esi          *ESIClient
+	client       *http.Client
+}
+
+func newR2Z2Source(baseURL string, esi *ESIClient) *r2z2Source {
+	return &r2z2Source{
+		baseURL:      baseURL,
+		pollInterval: 6 * time.Second,
+		errorDelay:   zkillErrorDelay,
+		esi:          esi,
+		client:       &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (r *r2z2Source) Name() string { return sourceR2Z2 }
+
+func (r *r2z2Source) Run(ctx context.Context, out chan<- *KillmailData) error {
+	var next int64
+	for next == 0 {
+		var seq R2Z2Sequence
+		status, err := getJSON(ctx, r.client, r.baseURL+"/sequence.json", &seq)
+		if err == nil && status != http.StatusOK {
+			err = fmt.Errorf("R2Z2 returned status %d for sequence.json", status)
+		}
+		if err == nil {
+			next = seq.Sequence
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("R2Z2 sequence lookup failed: %v", err)
+		sleepContext(ctx, r.errorDelay)
+	}
+	log.Printf("R2Z2 starting at sequence %d", next)
+
+	for ctx.Err() == nil {
+		var km R2Z2Killmail
+		status, err := getJSON(ctx, r.client, fmt.Sprintf("%s/%d.json", r.baseURL, next), &km)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				r.markDisconnected(err)
+				log.Printf("R2Z2 fetch of %d failed: %v", next, err)
+				sleepContext(ctx, r.errorDelay)
+			}
+		case status == http.StatusNotFound:
+			r.markConnected()
+			r.markMessage()
+			sleepContext(ctx, r.pollInterval) // Caught up; wait for the next kill to be published.
+		case status != http.StatusOK:
+			r.markDisconnected(fmt.Errorf("R2Z2 returned status %d", status))
+			log.Printf("R2Z2 returned status %d for %d", status, next)
+			sleepContext(ctx, r.errorDelay)
+		default:
+			r.markConnected()
+			r.markKillmail()
+			next++
+			data := normalizeESIKillmail(ctx, r.esi, &km.ESI, &km.ZKB)
+			select {
+			case out <- data:
+			case <-ctx.Done():
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// getJSON fetches url and decodes a 200 response into target. Other statuses are returned
+// without an error so callers can treat 404 as "not yet".
+func getJSON(ctx context.Context, client *http.Client, url string, target interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "Firehawk Discord Bot")
+	return doJSON(client, req, target)
+}
+
+// doJSON sends req and decodes a 200 response into target, like getJSON.
+func doJSON(client *http.Client, req *http.Request, target interface{}) (int, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(target)
+}
+
+// normalizeESIKillmail converts an ESI killmail plus zKillboard's metadata into KillmailData,
+// filling in the names and locations eve-kill would have sent from ESI and the system cache.
+// ESI lookups give up when ctx ends, leaving those names empty.
+func normalizeESIKillmail(ctx context.Context, esi *ESIClient, km *ESIKillmail, zkb *ZKBMeta) *KillmailData {
+	ids := []int{km.Victim.CharacterID, km.Victim.CorporationID, km.Victim.AllianceID, km.Victim.ShipTypeID}
+	for _, a := range km.Attackers {
+		ids = append(ids, a.CharacterID, a.CorporationID, a.AllianceID, a.ShipTypeID, a.WeaponTypeID)
+	}
+	ids = appendItemTypeIDs(ids, km.Victim.Items)
+	esi.ResolveNames(ctx, ids)
+
+	data := &KillmailData{}
+	k := &data.Killmail
+	k.KillmailID = km.KillmailID
+	k.KillmailTime = km.KillmailTime
+	k.SystemID = km.SolarSystemID
+	k.TotalValue = zkb.TotalValue
+	k.IsNpc = zkb.NPC
+	k.IsSolo = zkb.Solo
+	k.DroppedValue = zkb.DroppedValue
+	k.DestroyedValue = zkb.DestroyedValue
+	if sys, err := esi.GetSystemDetails(km.SolarSystemID); err == nil {
+		k.SystemName = sys.Name
+		k.SystemSecurity = sys.SecurityStatus
+		k.RegionID = sys.RegionID
+		k.RegionName.En = esi.GetRegionName(ctx, sys.RegionID)
+	}
+
+	k.Victim = KillmailVictim{
+		CharacterID:     km.Victim.CharacterID,
+		CharacterName:   esi.cachedName(km.Victim.CharacterID, esi.characterNames),
+		CorporationID:   km.Victim.CorporationID,
+		CorporationName: esi.cachedName(km.Victim.CorporationID, esi.corporationNames),
+		AllianceID:      km.Victim.AllianceID,
+		AllianceName:    esi.cachedName(km.Victim.AllianceID, esi.allianceNames),
+		ShipID:          km.Victim.ShipTypeID,
+		ShipGroupID:     esi.GetShipGroupID(ctx, km.Victim.ShipTypeID),
+		ShipName:        LocalizedName{En: esi.cachedName(km.Victim.ShipTypeID, esi.shipNames)},
+		DamageTaken:     km.Victim.DamageTaken,
+	}
+	for _, a := range km.Attackers {
+		k.Attackers = append(k.Attackers, KillmailAttacker{
+			CharacterID:     a.CharacterID,
+			CharacterName:   esi.cachedName(a.CharacterID, esi.characterNames),
+			CorporationID:   a.CorporationID,
+			CorporationName: esi.cachedName(a.CorporationID, esi.corporationNames),
+			AllianceID:      a.AllianceID,
+			AllianceName:    esi.cachedName(a.AllianceID, esi.allianceNames),
+			ShipID:          a.ShipTypeID,
+			ShipName:        LocalizedName{En: esi.cachedName(a.ShipTypeID, esi.shipNames)},
+			WeaponTypeID:    a.WeaponTypeID,
+			WeaponTypeName:  LocalizedName{En: esi.cachedName(a.WeaponTypeID, esi.shipNames)},
+			SecurityStatus:  a.SecurityStatus,
+			DamageDone:      a.DamageDone,
+			FinalBlow:       a.FinalBlow,
+		})
+	}
+	k.Items = normalizeESIItems(esi, km.Victim.Items)
+	return data
+}
+
+// appendItemTypeIDs adds the type of every item, including container contents, to ids.
+func appendItemTypeIDs(ids []int, items []ESIKillmailItem) []int {
+	for _, item := range items {
+		ids = append(ids, item.ItemTypeID)
+		ids = appendItemTypeIDs(ids, item.Items)
+	}
+	return ids
+}
+
+// normalizeESIItems converts ESI items, naming them from the type cache. zKillboard doesn't
+// price individual items, so Value stays zero.
+func normalizeESIItems(esi *ESIClient, items []ESIKillmailItem) []KillmailItem {
+	if len(items) == 0 {
+		return nil
+	}
+	result := make([]KillmailItem, 0, len(items))
+	for _, item := range items {
+		result = append(result, KillmailItem{
+			TypeID:       item.ItemTypeID,
+			TypeName:     LocalizedName{En: esi.cachedName(item.ItemTypeID, esi.shipNames)},
+			Flag:         item.Flag,
+			QtyDropped:   item.QuantityDropped,
+			QtyDestroyed: item.QuantityDestroyed,
+			Singleton:    item.Singleton,
+			Items:        normalizeESIItems(esi, item.Items),
+		})
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxStandingsPerGuild keeps a guild's standings list to something a person can read.
+const maxStandingsPerGuild = 100
+
+// The standing scale, as in game.
+const (
+	minStanding = -10
+	maxStanding = 10
+)
+
+// Standing is a guild's standing towards a character, corporation or alliance, on EVE's
+// -10 to +10 scale. Entities with a positive standing, the guild's own corporation or alliance
+// included, are "us" when kills are framed.
+type Standing struct {
+	EntityType string // "character", "corporation" or "alliance"
+	EntityID   int
+	Name       string
+	Value      float64
+}
+
+// guildStandings maps a guild ID to its standings. Guarded by mu, like subscriptions.
+var guildStandings = make(map[string][]Standing)
+
+// Kill perspectives, from the point of view of the guild a killmail is posted to.
+const (
+	perspectiveNone       = ""            // The guild has no standings; kills are shown neutrally.
+	perspectiveLoss       = "loss"        // A friendly was the victim.
+	perspectiveKill       = "kill"        // A friendly was among the attackers.
+	perspectiveThirdParty = "third-party" // Nobody friendly was involved.
+)
+
+// Embed colours for each perspective.
+const (
+	colorNeutral    = 0xBF2A2A // The original deep red, for guilds without standings.
+	colorLoss       = 0xBF2A2A
+	colorKill       = 0x2E9E44
+	colorThirdParty = 0x808890
+)
+
+// standingFor returns the guild's standing towards a pilot, using the most specific match
+// like the game does: character, then corporation, then alliance.
+func standingFor(standings []Standing, characterID, corporationID, allianceID int) float64 {
+	var byCorporation, byAlliance *float64
+	for _, st := range standings {
+		switch {
+		case st.EntityType == "character" && characterID != 0 && st.EntityID == characterID:
+			return st.Value
+		case st.EntityType == "corporation" && corporationID != 0 && st.EntityID == corporationID:
+			byCorporation = &st.Value
+		case st.EntityType == "alliance" && allianceID != 0 && st.EntityID == allianceID:
+			byAlliance = &st.Value
+		}
+	}
+	switch {
+	case byCorporation != nil:
+		return *byCorporation
+	case byAlliance != nil:
+		return *byAlliance
+	}
+	return 0
+}
+
+// killPerspective frames a kill for a guild. A friendly loss wins over a friendly kill, so
+// friendly fire reads as a loss.
+func killPerspective(standings []Standing, data *KillmailData) string {
+	if len(standings) == 0 {
+		return perspectiveNone
+	}
+	v := data.Killmail.Victim
+	if standingFor(standings, v.CharacterID, v.CorporationID, v.AllianceID) > 0 {
+		return perspectiveLoss
+	}
+	for _, a := range data.Killmail.Attackers {
+		if standingFor(standings, a.CharacterID, a.CorporationID, a.AllianceID) > 0 {
+			return perspectiveKill
+		}
+	}
+	return perspectiveThirdParty
+}
+
+// killmailHeadline returns the embed title and colour for a kill seen from a perspective.
+func killmailHeadline(data *KillmailData, perspective string) (string, int) {
+	ship, system := data.Killmail.Victim.ShipName.En, data.Killmail.SystemName
+	switch perspective {
+	case perspectiveLoss:
+		return fmt.Sprintf("We lost %s %s in %s", indefiniteArticle(ship), ship, system), colorLoss
+	case perspectiveKill:
+		return fmt.Sprintf("We killed %s %s in %s", indefiniteArticle(ship), ship, system), colorKill
+	case perspectiveThirdParty:
+		return fmt.Sprintf("%s destroyed in %s", ship, system), colorThirdParty
+	default:
+		return fmt.Sprintf("%s destroyed in %s", ship, system), colorNeutral
+	}
+}
+
+// indefiniteArticle picks "a" or "an" for a ship name. Going by the first letter is right for
+// every hull in the game bar a handful of acronyms, which nobody will mind.
+func indefiniteArticle(name string) string {
+	if name != "" && strings.ContainsRune("AEIOUaeiou", rune(name[0])) {
+		return "an"
+	}
+	return "a"
+}
+
+// describeStanding renders a standing for /standings list and confirmation messages.
+func describeStanding(st Standing) string {
+	icon := "⚪"
+	switch {
+	case st.Value > 0:
+		icon = "🔵"
+	case st.Value < 0:
+		icon = "🔴"
+	}
+	return fmt.Sprintf("%s %s **%s** (`%d`): %+g", icon, watchEntityLabels[st.EntityType], st.Name, st.EntityID, st.Value)
+}
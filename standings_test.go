@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestStandingFor(t *testing.T) {
+	standings := []Standing{
+		{EntityType: "alliance", EntityID: 99000001, Value: 10},
+		{EntityType: "corporation", EntityID: 98000001, Value: -5},
+		{EntityType: "character", EntityID: 90000001, Value: 5},
+		{EntityType: "alliance", EntityID: 99000002, Value: -10},
+	}
+	for _, tc := range []struct {
+		name                 string
+		char, corp, alliance int
+		want                 float64
+	}{
+		{"character over corporation and alliance", 90000001, 98000001, 99000001, 5},
+		{"corporation over alliance", 90000002, 98000001, 99000001, -5},
+		{"alliance", 90000002, 98000002, 99000001, 10},
+		{"hostile alliance", 0, 98000003, 99000002, -10},
+		{"nobody", 90000003, 98000003, 99000003, 0},
+		// An NPC attacker has no character, corporation or alliance to match.
+		{"npc", 0, 0, 0, 0},
+	} {
+		if got := standingFor(standings, tc.char, tc.corp, tc.alliance); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// The order of the list makes no difference.
+	reversed := []Standing{standings[3], standings[2], standings[1], standings[0]}
+	if got := standingFor(reversed, 90000001, 98000001, 99000001); got != 5 {
+		t.Errorf("reversed list: got %v, want 5", got)
+	}
+	if got := standingFor(reversed, 90000002, 98000001, 99000001); got != -5 {
+		t.Errorf("reversed list: got %v, want -5", got)
+	}
+}
+
+func TestKillPerspective(t *testing.T) {
+	standings := []Standing{
+		{EntityType: "alliance", EntityID: 1, Value: 10},
+		// A spy corporation in our alliance is not one of us.
+		{EntityType: "corporation", EntityID: 66, Value: -10},
+	}
+	friend := KillmailAttacker{CharacterID: 100, CorporationID: 10, AllianceID: 1}
+	spy := KillmailAttacker{CharacterID: 101, CorporationID: 66, AllianceID: 1}
+	stranger := KillmailAttacker{CharacterID: 200, CorporationID: 20, AllianceID: 2}
+	kill := func(victim KillmailAttacker, attackers ...KillmailAttacker) *KillmailData {
+		v := KillmailVictim{CharacterID: victim.CharacterID, CorporationID: victim.CorporationID, AllianceID: victim.AllianceID}
+		return &KillmailData{Killmail: Killmail{Victim: v, Attackers: attackers}}
+	}
+
+	for _, tc := range []struct {
+		name string
+		data *KillmailData
+		want string
+	}{
+		{"we lost one", kill(friend, stranger), perspectiveLoss},
+		{"we killed one", kill(stranger, stranger, friend), perspectiveKill},
+		{"friendly fire is a loss", kill(friend, friend), perspectiveLoss},
+		{"third party", kill(stranger, stranger), perspectiveThirdParty},
+		{"the spy's loss is not ours", kill(spy, stranger), perspectiveThirdParty},
+		{"nor is the spy's kill", kill(stranger, spy), perspectiveThirdParty},
+		{"npc kill of a friend", kill(friend, KillmailAttacker{}), perspectiveLoss},
+	} {
+		if got := killPerspective(standings, tc.data); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	if got := killPerspective(nil, kill(friend, stranger)); got != perspectiveNone {
+		t.Errorf("without standings: got %q, want none", got)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Store persists everything the bot is configured with. The in-memory maps in commands.go
+// remain the source of truth for the hot killmail path; every change is written through here.
+type Store interface {
+	Subscriptions() (map[string][]string, error)
+	AddSubscription(channelID, topic string) error
+	RemoveSubscription(channelID, topic string) error
+
+	Filters() (map[string]string, error)
+	SetFilter(channelID, expression string) error
+	ClearFilter(channelID string) error
+
+	Watchlists() (map[string][]WatchEntry, error)
+	SaveWatch(channelID string, entry WatchEntry) error
+	RemoveWatch(channelID, entityType string, entityID int) error
+
+	Locations() (map[string][]LocationSubscription, error)
+	SaveLocation(channelID string, location LocationSubscription) error
+	RemoveLocation(channelID, kind string, id int) error
+
+	GuildSettings(guildID string) (map[string]string, error)
+	AllGuildSettings() (map[string]map[string]string, error)
+	SetGuildSetting(guildID, key, value string) error
+	DeleteGuildSettings(guildID string) error // Removes the guild's settings and standings.
+
+	Standings() (map[string][]Standing, error)
+	SaveStanding(guildID string, standing Standing) error
+	RemoveStanding(guildID, entityType string, entityID int) error
+
+	ChannelGuilds() (map[string]string, error)
+	SetChannelGuild(channelID, guildID string) error
+	ChannelSettings() (map[string]map[string]string, error)
+	SetChannelSetting(channelID, key, value string) error
+	DeleteChannel(channelID string) error // Removes the channel's feeds, filter, watches, locations and settings.
+
+	// RecentKillmails returns the killmails seen since the given time; PruneKillmails forgets
+	// everything older. MarkKillmailSeen never clears the processed flag once it is set.
+	RecentKillmails(since time.Time) (map[int]StoredKillmail, error)
+	MarkKillmailSeen(killmailID int, at time.Time, processed bool) error
+	RecordDeliveries(killmailID int, channelIDs []string) error
+	PruneKillmails(before time.Time) error
+
+	AppendAudit(entry AuditEntry) error
+	AuditLog(guildID string, limit int) ([]AuditEntry, error)
+
+	// MarkImported and WasImported record one-off legacy imports so they never run twice.
+	MarkImported(name string) error
+	WasImported(name string) (bool, error)
+
+	Close() error
+}
+
+// store is the process-wide persistence backend, opened in main().
+var store Store
+
+// Legacy JSON files from before the SQL store. They are only read once, by importLegacyFiles.
+var (
+	SubMapFile      = "subscriptions.json"
+	FilterMapFile   = "filters.json"
+	WatchMapFile    = "watchlists.json"
+	LocationMapFile = "locations.json"
+)
+
+// loadStateFromStore fills the in-memory subscription maps from the store when the bot starts.
+func loadStateFromStore(st Store) error {
+	subs, err := st.Subscriptions()
+	if err != nil {
+		return fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+	filters, err := st.Filters()
+	if err != nil {
+		return fmt.Errorf("failed to load filters: %w", err)
+	}
+	watches, err := st.Watchlists()
+	if err != nil {
+		return fmt.Errorf("failed to load watchlists: %w", err)
+	}
+	locations, err := st.Locations()
+	if err != nil {
+		return fmt.Errorf("failed to load locations: %w", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for channelID, topics := range subs {
+		subscriptions[channelID] = make(map[string]bool, len(topics))
+		for _, topic := range topics {
+			subscriptions[channelID][topic] = true
+		}
+	}
+	for channelID, source := range filters {
+		filter, err := ParseFilter(source)
+		if err != nil {
+			log.Printf("Skipping invalid stored filter for channel %s: %v", channelID, err)
+			continue
+		}
+		channelFilters[channelID] = filter
+	}
+	watchlists = watches
+	locationSubscriptions = locations
+
+	log.Printf("Loaded %d subscribed channels, %d filters, %d watchlists and %d location lists from the store.",
+		len(subscriptions), len(channelFilters), len(watchlists), len(locationSubscriptions))
+	return nil
+}
+
+// importLegacyFiles copies the old JSON files into the store the first time it runs.
+// The files are left in place (they may be bind-mounted), and the import is recorded instead.
+func importLegacyFiles(st Store) {
+	imports := []struct {
+		path string
+		fn   func(st Store, data []byte) (int, error)
+	}{
+		{SubMapFile, importSubscriptionsJSON},
+		{FilterMapFile, importFiltersJSON},
+		{WatchMapFile, importWatchlistsJSON},
+		{LocationMapFile, importLocationsJSON},
+	}
+
+	for _, imp := range imports {
+		if done, err := st.WasImported(imp.path); err != nil || done {
+			continue
+		}
+		data, err := os.ReadFile(imp.path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Error reading %s for import: %v", imp.path, err)
+			}
+			continue
+		}
+
+		count := 0
+		if len(data) > 0 {
+			if count, err = imp.fn(st, data); err != nil {
+				log.Printf("Error importing %s: %v", imp.path, err)
+				continue
+			}
+		}
+		if err := st.MarkImported(imp.path); err != nil {
+			log.Printf("Error recording import of %s: %v", imp.path, err)
+			continue
+		}
+		log.Printf("Imported %d channel(s) from %s into the store.", count, imp.path)
+	}
+}
+
+// importSubscriptionsJSON accepts both shapes subscriptions.json has been written in:
+// channel -> [topics] (saveSubscriptionsToFile) and channel -> {topic: true}.
+func importSubscriptionsJSON(st Store, data []byte) (int, error) {
+	subs := make(map[string][]string)
+	var asList map[string][]string
+	if err := json.Unmarshal(data, &asList); err == nil {
+		subs = asList
+	} else {
+		var asSet map[string]map[string]bool
+		if err := json.Unmarshal(data, &asSet); err != nil {
+			return 0, fmt.Errorf("unrecognised subscriptions format: %w", err)
+		}
+		for channelID, topics := range asSet {
+			for topic, on := range topics {
+				if on {
+					subs[channelID] = append(subs[channelID], topic)
+				}
+			}
+		}
+	}
+
+	for channelID, topics := range subs {
+		for _, topic := range topics {
+			if err := st.AddSubscription(channelID, topic); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(subs), nil
+}
+
+func importFiltersJSON(st Store, data []byte) (int, error) {
+	var filters map[string]string
+	if err := json.Unmarshal(data, &filters); err != nil {
+		return 0, err
+	}
+	for channelID, expression := range filters {
+		if err := st.SetFilter(channelID, expression); err != nil {
+			return 0, err
+		}
+	}
+	return len(filters), nil
+}
+
+func importWatchlistsJSON(st Store, data []byte) (int, error) {
+	var watches map[string][]WatchEntry
+	if err := json.Unmarshal(data, &watches); err != nil {
+		return 0, err
+	}
+	for channelID, entries := range watches {
+		for _, entry := range entries {
+			if err := st.SaveWatch(channelID, entry); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(watches), nil
+}
+
+func importLocationsJSON(st Store, data []byte) (int, error) {
+	var locations map[string][]LocationSubscription
+	if err := json.Unmarshal(data, &locations); err != nil {
+		return 0, err
+	}
+	for channelID, entries := range locations {
+		for _, entry := range entries {
+			if err := st.SaveLocation(channelID, entry); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(locations), nil
+}
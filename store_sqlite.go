@@ -0,0 +1,603 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver, keeps CGO_ENABLED=0 builds working.
+)
+
+// sqliteMigrations are applied in order, once each. Never edit a released migration; append a new one.
+var sqliteMigrations = []string{
+	// 1: initial schema
+	`CREATE TABLE subscriptions (
+		channel_id TEXT NOT NULL,
+		topic      TEXT NOT NULL,
+		PRIMARY KEY (channel_id, topic)
+	);
+	CREATE TABLE channel_filters (
+		channel_id TEXT PRIMARY KEY,
+		expression TEXT NOT NULL
+	);
+	CREATE TABLE watchlists (
+		channel_id  TEXT    NOT NULL,
+		entity_type TEXT    NOT NULL,
+		entity_id   INTEGER NOT NULL,
+		name        TEXT    NOT NULL,
+		side        TEXT    NOT NULL,
+		PRIMARY KEY (channel_id, entity_type, entity_id)
+	);
+	CREATE TABLE location_subscriptions (
+		channel_id  TEXT    NOT NULL,
+		kind        TEXT    NOT NULL,
+		location_id INTEGER NOT NULL,
+		name        TEXT    NOT NULL,
+		radius      INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (channel_id, kind, location_id)
+	);
+	CREATE TABLE guild_settings (
+		guild_id TEXT NOT NULL,
+		key      TEXT NOT NULL,
+		value    TEXT NOT NULL,
+		PRIMARY KEY (guild_id, key)
+	);
+	CREATE TABLE legacy_imports (
+		name        TEXT PRIMARY KEY,
+		imported_at TEXT NOT NULL
+	);`,
+	// 2: feed channels belong to a guild
+	`CREATE TABLE channels (
+		channel_id TEXT PRIMARY KEY,
+		guild_id   TEXT NOT NULL
+	);
+	CREATE INDEX channels_guild ON channels (guild_id);`,
+	// 3: audit log of configuration changes
+	`CREATE TABLE audit_log (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TEXT NOT NULL,
+		guild_id   TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		user_name  TEXT NOT NULL,
+		action     TEXT NOT NULL,
+		detail     TEXT NOT NULL
+	);
+	CREATE INDEX audit_log_guild ON audit_log (guild_id, id);`,
+	// 4: per-channel delivery settings
+	`CREATE TABLE channel_settings (
+		channel_id TEXT NOT NULL,
+		key        TEXT NOT NULL,
+		value      TEXT NOT NULL,
+		PRIMARY KEY (channel_id, key)
+	);`,
+	// 5: killmails already processed, and which channels each was posted to
+	`CREATE TABLE seen_killmails (
+		killmail_id INTEGER PRIMARY KEY,
+		seen_at     INTEGER NOT NULL
+	);
+	CREATE INDEX seen_killmails_seen_at ON seen_killmails (seen_at);
+	CREATE TABLE killmail_deliveries (
+		killmail_id INTEGER NOT NULL,
+		channel_id  TEXT    NOT NULL,
+		PRIMARY KEY (killmail_id, channel_id)
+	);`,
+	// 6: guild standings towards characters, corporations and alliances
+	`CREATE TABLE guild_standings (
+		guild_id    TEXT    NOT NULL,
+		entity_type TEXT    NOT NULL,
+		entity_id   INTEGER NOT NULL,
+		name        TEXT    NOT NULL,
+		standing    REAL    NOT NULL,
+		PRIMARY KEY (guild_id, entity_type, entity_id)
+	);`,
+	// 7: whether a seen killmail went through the live feed or was only claimed by a backfill
+	`ALTER TABLE seen_killmails ADD COLUMN processed INTEGER NOT NULL DEFAULT 1;`,
+}
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens (or creates) the database at path and brings its schema up to date.
+func OpenSQLiteStore(path string) (*sqliteStore, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	// SQLite only allows one writer; a single connection keeps things simple and avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	s := &sqliteStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// errDatabaseInUse is returned by lockDatabase while another process holds the lock.
+var errDatabaseInUse = errors.New("the database is in use by another Firehawk process")
+
+// lockDatabase takes a lock on path+".lock" that lasts until the returned func is called or the
+// process exits, so the bot and the backfill CLI never share a database: each keeps its own
+// killmail ledger in memory, and kills one of them posts would be posted again by the other.
+// SQLite does the locking, in exclusive locking mode, so it works on every platform.
+func lockDatabase(path string) (func() error, error) {
+	dsn := fmt.Sprintf("file:%s.lock?_pragma=locking_mode(EXCLUSIVE)&_pragma=busy_timeout(0)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file for %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	// The first write takes the exclusive lock, and the connection keeps it until it is closed.
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS holder (pid INTEGER NOT NULL);
+		DELETE FROM holder;
+		INSERT INTO holder (pid) VALUES (?)`, os.Getpid()); err != nil {
+		db.Close()
+		if strings.Contains(err.Error(), "database is locked") {
+			return nil, fmt.Errorf("%w: %s", errDatabaseInUse, path)
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return db.Close, nil
+}
+
+func (s *sqliteStore) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := current; i < len(sqliteMigrations); i++ {
+		version := i + 1
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", version, err)
+		}
+		log.Printf("Applied database migration %d.", version)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Close() error { return s.db.Close() }
+
+// --- Subscriptions ---
+
+func (s *sqliteStore) Subscriptions() (map[string][]string, error) {
+	rows, err := s.db.Query(`SELECT channel_id, topic FROM subscriptions ORDER BY channel_id, topic`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := make(map[string][]string)
+	for rows.Next() {
+		var channelID, topic string
+		if err := rows.Scan(&channelID, &topic); err != nil {
+			return nil, err
+		}
+		subs[channelID] = append(subs[channelID], topic)
+	}
+	return subs, rows.Err()
+}
+
+func (s *sqliteStore) AddSubscription(channelID, topic string) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO subscriptions (channel_id, topic) VALUES (?, ?)`, channelID, topic)
+	return err
+}
+
+func (s *sqliteStore) RemoveSubscription(channelID, topic string) error {
+	_, err := s.db.Exec(`DELETE FROM subscriptions WHERE channel_id = ? AND topic = ?`, channelID, topic)
+	return err
+}
+
+// --- Filters ---
+
+func (s *sqliteStore) Filters() (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT channel_id, expression FROM channel_filters`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filters := make(map[string]string)
+	for rows.Next() {
+		var channelID, expression string
+		if err := rows.Scan(&channelID, &expression); err != nil {
+			return nil, err
+		}
+		filters[channelID] = expression
+	}
+	return filters, rows.Err()
+}
+
+func (s *sqliteStore) SetFilter(channelID, expression string) error {
+	_, err := s.db.Exec(`INSERT INTO channel_filters (channel_id, expression) VALUES (?, ?)
+		ON CONFLICT (channel_id) DO UPDATE SET expression = excluded.expression`, channelID, expression)
+	return err
+}
+
+func (s *sqliteStore) ClearFilter(channelID string) error {
+	_, err := s.db.Exec(`DELETE FROM channel_filters WHERE channel_id = ?`, channelID)
+	return err
+}
+
+// --- Watchlists ---
+
+func (s *sqliteStore) Watchlists() (map[string][]WatchEntry, error) {
+	rows, err := s.db.Query(`SELECT channel_id, entity_type, entity_id, name, side FROM watchlists ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watches := make(map[string][]WatchEntry)
+	for rows.Next() {
+		var channelID string
+		var w WatchEntry
+		if err := rows.Scan(&channelID, &w.EntityType, &w.EntityID, &w.Name, &w.Side); err != nil {
+			return nil, err
+		}
+		watches[channelID] = append(watches[channelID], w)
+	}
+	return watches, rows.Err()
+}
+
+func (s *sqliteStore) SaveWatch(channelID string, w WatchEntry) error {
+	_, err := s.db.Exec(`INSERT INTO watchlists (channel_id, entity_type, entity_id, name, side) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (channel_id, entity_type, entity_id) DO UPDATE SET name = excluded.name, side = excluded.side`,
+		channelID, w.EntityType, w.EntityID, w.Name, w.Side)
+	return err
+}
+
+func (s *sqliteStore) RemoveWatch(channelID, entityType string, entityID int) error {
+	_, err := s.db.Exec(`DELETE FROM watchlists WHERE channel_id = ? AND entity_type = ? AND entity_id = ?`, channelID, entityType, entityID)
+	return err
+}
+
+// --- Locations ---
+
+func (s *sqliteStore) Locations() (map[string][]LocationSubscription, error) {
+	rows, err := s.db.Query(`SELECT channel_id, kind, location_id, name, radius FROM location_subscriptions ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := make(map[string][]LocationSubscription)
+	for rows.Next() {
+		var channelID string
+		var l LocationSubscription
+		if err := rows.Scan(&channelID, &l.Kind, &l.ID, &l.Name, &l.Radius); err != nil {
+			return nil, err
+		}
+		locations[channelID] = append(locations[channelID], l)
+	}
+	return locations, rows.Err()
+}
+
+func (s *sqliteStore) SaveLocation(channelID string, l LocationSubscription) error {
+	_, err := s.db.Exec(`INSERT INTO location_subscriptions (channel_id, kind, location_id, name, radius) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (channel_id, kind, location_id) DO UPDATE SET name = excluded.name, radius = excluded.radius`,
+		channelID, l.Kind, l.ID, l.Name, l.Radius)
+	return err
+}
+
+func (s *sqliteStore) RemoveLocation(channelID, kind string, id int) error {
+	_, err := s.db.Exec(`DELETE FROM location_subscriptions WHERE channel_id = ? AND kind = ? AND location_id = ?`, channelID, kind, id)
+	return err
+}
+
+// --- Guild settings ---
+
+func (s *sqliteStore) GuildSettings(guildID string) (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT key, value FROM guild_settings WHERE guild_id = ?`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
+
+func (s *sqliteStore) AllGuildSettings() (map[string]map[string]string, error) {
+	rows, err := s.db.Query(`SELECT guild_id, key, value FROM guild_settings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := make(map[string]map[string]string)
+	for rows.Next() {
+		var guildID, key, value string
+		if err := rows.Scan(&guildID, &key, &value); err != nil {
+			return nil, err
+		}
+		if all[guildID] == nil {
+			all[guildID] = make(map[string]string)
+		}
+		all[guildID][key] = value
+	}
+	return all, rows.Err()
+}
+
+func (s *sqliteStore) SetGuildSetting(guildID, key, value string) error {
+	_, err := s.db.Exec(`INSERT INTO guild_settings (guild_id, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (guild_id, key) DO UPDATE SET value = excluded.value`, guildID, key, value)
+	return err
+}
+
+// --- Channels ---
+
+func (s *sqliteStore) ChannelGuilds() (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT channel_id, guild_id FROM channels`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := make(map[string]string)
+	for rows.Next() {
+		var channelID, guildID string
+		if err := rows.Scan(&channelID, &guildID); err != nil {
+			return nil, err
+		}
+		channels[channelID] = guildID
+	}
+	return channels, rows.Err()
+}
+
+func (s *sqliteStore) SetChannelGuild(channelID, guildID string) error {
+	_, err := s.db.Exec(`INSERT INTO channels (channel_id, guild_id) VALUES (?, ?)
+		ON CONFLICT (channel_id) DO UPDATE SET guild_id = excluded.guild_id`, channelID, guildID)
+	return err
+}
+
+func (s *sqliteStore) ChannelSettings() (map[string]map[string]string, error) {
+	rows, err := s.db.Query(`SELECT channel_id, key, value FROM channel_settings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := make(map[string]map[string]string)
+	for rows.Next() {
+		var channelID, key, value string
+		if err := rows.Scan(&channelID, &key, &value); err != nil {
+			return nil, err
+		}
+		if all[channelID] == nil {
+			all[channelID] = make(map[string]string)
+		}
+		all[channelID][key] = value
+	}
+	return all, rows.Err()
+}
+
+func (s *sqliteStore) SetChannelSetting(channelID, key, value string) error {
+	_, err := s.db.Exec(`INSERT INTO channel_settings (channel_id, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (channel_id, key) DO UPDATE SET value = excluded.value`, channelID, key, value)
+	return err
+}
+
+// DeleteChannel removes every feed and setting for a channel in one transaction.
+func (s *sqliteStore) DeleteChannel(channelID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"subscriptions", "channel_filters", "watchlists", "location_subscriptions", "channel_settings", "channels"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE channel_id = ?`, channelID); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) DeleteGuildSettings(guildID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"guild_settings", "guild_standings"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE guild_id = ?`, guildID); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// --- Standings ---
+
+func (s *sqliteStore) Standings() (map[string][]Standing, error) {
+	rows, err := s.db.Query(`SELECT guild_id, entity_type, entity_id, name, standing FROM guild_standings ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	standings := make(map[string][]Standing)
+	for rows.Next() {
+		var guildID string
+		var st Standing
+		if err := rows.Scan(&guildID, &st.EntityType, &st.EntityID, &st.Name, &st.Value); err != nil {
+			return nil, err
+		}
+		standings[guildID] = append(standings[guildID], st)
+	}
+	return standings, rows.Err()
+}
+
+func (s *sqliteStore) SaveStanding(guildID string, st Standing) error {
+	_, err := s.db.Exec(`INSERT INTO guild_standings (guild_id, entity_type, entity_id, name, standing) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (guild_id, entity_type, entity_id) DO UPDATE SET name = excluded.name, standing = excluded.standing`,
+		guildID, st.EntityType, st.EntityID, st.Name, st.Value)
+	return err
+}
+
+func (s *sqliteStore) RemoveStanding(guildID, entityType string, entityID int) error {
+	_, err := s.db.Exec(`DELETE FROM guild_standings WHERE guild_id = ? AND entity_type = ? AND entity_id = ?`, guildID, entityType, entityID)
+	return err
+}
+
+// --- Seen killmails ---
+
+func (s *sqliteStore) RecentKillmails(since time.Time) (map[int]StoredKillmail, error) {
+	rows, err := s.db.Query(`SELECT killmail_id, seen_at, processed FROM seen_killmails WHERE seen_at >= ?`, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[int]StoredKillmail)
+	for rows.Next() {
+		var id int
+		var at int64
+		var processed bool
+		if err := rows.Scan(&id, &at, &processed); err != nil {
+			return nil, err
+		}
+		seen[id] = StoredKillmail{SeenAt: time.Unix(at, 0), Processed: processed}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	deliveryRows, err := s.db.Query(`SELECT d.killmail_id, d.channel_id FROM killmail_deliveries d
+		JOIN seen_killmails k ON k.killmail_id = d.killmail_id WHERE k.seen_at >= ?`, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer deliveryRows.Close()
+
+	for deliveryRows.Next() {
+		var id int
+		var channelID string
+		if err := deliveryRows.Scan(&id, &channelID); err != nil {
+			return nil, err
+		}
+		if k, ok := seen[id]; ok {
+			k.Channels = append(k.Channels, channelID)
+			seen[id] = k
+		}
+	}
+	return seen, deliveryRows.Err()
+}
+
+func (s *sqliteStore) MarkKillmailSeen(killmailID int, at time.Time, processed bool) error {
+	// A killmail seen again after its window starts a new one, so it is not pruned early.
+	_, err := s.db.Exec(`INSERT INTO seen_killmails (killmail_id, seen_at, processed) VALUES (?, ?, ?)
+		ON CONFLICT (killmail_id) DO UPDATE SET seen_at = excluded.seen_at, processed = MAX(processed, excluded.processed)`,
+		killmailID, at.Unix(), processed)
+	return err
+}
+
+func (s *sqliteStore) RecordDeliveries(killmailID int, channelIDs []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, channelID := range channelIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO killmail_deliveries (killmail_id, channel_id) VALUES (?, ?)`, killmailID, channelID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) PruneKillmails(before time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM killmail_deliveries WHERE killmail_id IN
+		(SELECT killmail_id FROM seen_killmails WHERE seen_at < ?)`, before.Unix()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM seen_killmails WHERE seen_at < ?`, before.Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// --- Audit log ---
+
+func (s *sqliteStore) AppendAudit(e AuditEntry) error {
+	_, err := s.db.Exec(`INSERT INTO audit_log (created_at, guild_id, channel_id, user_id, user_name, action, detail) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UTC().Format(time.RFC3339), e.GuildID, e.ChannelID, e.UserID, e.UserName, e.Action, e.Detail)
+	return err
+}
+
+func (s *sqliteStore) AuditLog(guildID string, limit int) ([]AuditEntry, error) {
+	rows, err := s.db.Query(`SELECT created_at, guild_id, channel_id, user_id, user_name, action, detail
+		FROM audit_log WHERE guild_id = ? ORDER BY id DESC LIMIT ?`, guildID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var created string
+		if err := rows.Scan(&created, &e.GuildID, &e.ChannelID, &e.UserID, &e.UserName, &e.Action, &e.Detail); err != nil {
+			return nil, err
+		}
+		e.Time, _ = time.Parse(time.RFC3339, created)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// --- Legacy imports ---
+
+func (s *sqliteStore) MarkImported(name string) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO legacy_imports (name, imported_at) VALUES (?, ?)`, name, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func (s *sqliteStore) WasImported(name string) (bool, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM legacy_imports WHERE name = ?`, name).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func schemaVersion(t *testing.T, st *sqliteStore) int {
+	t.Helper()
+	var version int
+	if err := st.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firehawk.db")
+
+	// Start from a database made by the first release, with data in it.
+	all := sqliteMigrations
+	sqliteMigrations = all[:1]
+	st, err := OpenSQLiteStore(path)
+	sqliteMigrations = all
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := schemaVersion(t, st); v != 1 {
+		t.Fatalf("version = %d, want 1", v)
+	}
+	if err := st.AddSubscription("c1", "nullsec"); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	// Opening it now applies every later migration and keeps the data.
+	st, err = OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if v := schemaVersion(t, st); v != len(sqliteMigrations) {
+		t.Errorf("version = %d, want %d", v, len(sqliteMigrations))
+	}
+	subs, err := st.Subscriptions()
+	if err != nil || !slices.Equal(subs["c1"], []string{"nullsec"}) {
+		t.Errorf("subscriptions = %v, %v", subs, err)
+	}
+	// Every migrated table is usable.
+	if err := st.SetChannelGuild("c1", "g1"); err != nil {
+		t.Error(err)
+	}
+	if err := st.SetChannelSetting("c1", "pod_mode", "hide"); err != nil {
+		t.Error(err)
+	}
+	if err := st.SaveStanding("g1", Standing{EntityType: "alliance", EntityID: 1, Name: "Blues", Value: 10}); err != nil {
+		t.Error(err)
+	}
+	if err := st.AppendAudit(AuditEntry{GuildID: "g1", ChannelID: "c1", Action: "subscribe"}); err != nil {
+		t.Error(err)
+	}
+	st.Close()
+
+	// And opening it again applies nothing.
+	st, err = OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied int
+	st.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied)
+	if applied != len(sqliteMigrations) {
+		t.Errorf("%d migrations recorded, want %d", applied, len(sqliteMigrations))
+	}
+}
+
+func TestImportLegacyFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	files := map[string]string{
+		// The older set shape of subscriptions.json.
+		SubMapFile:      `{"c1": {"nullsec": true, "frigates": true, "titans": false}, "c2": {"all": true}}`,
+		FilterMapFile:   `{"c1": "value >= 1b"}`,
+		WatchMapFile:    `{"c2": [{"entity_type": "alliance", "entity_id": 99000001, "name": "Goons", "side": "losses"}]}`,
+		LocationMapFile: `{"c3": [{"kind": "system", "id": 30000142, "name": "Jita", "radius": 2}]}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, err := OpenSQLiteStore("firehawk.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	importLegacyFiles(st)
+
+	subs, _ := st.Subscriptions()
+	slices.Sort(subs["c1"])
+	if !slices.Equal(subs["c1"], []string{"frigates", "nullsec"}) || !slices.Equal(subs["c2"], []string{"all"}) {
+		t.Errorf("subscriptions = %v", subs)
+	}
+	if filters, _ := st.Filters(); filters["c1"] != "value >= 1b" {
+		t.Errorf("filters = %v", filters)
+	}
+	if watches, _ := st.Watchlists(); len(watches["c2"]) != 1 || watches["c2"][0].EntityID != 99000001 || watches["c2"][0].Side != "losses" {
+		t.Errorf("watchlists = %v", watches)
+	}
+	if locations, _ := st.Locations(); len(locations["c3"]) != 1 || locations["c3"][0].Radius != 2 {
+		t.Errorf("locations = %v", locations)
+	}
+	for name := range files {
+		if done, err := st.WasImported(name); err != nil || !done {
+			t.Errorf("%s not recorded as imported: %v", name, err)
+		}
+	}
+
+	// The files are only imported once, so later changes to them are ignored.
+	st.RemoveSubscription("c2", "all")
+	os.WriteFile(SubMapFile, []byte(`{"c2": ["all"], "c9": ["lowsec"]}`), 0644)
+	importLegacyFiles(st)
+	if subs, _ := st.Subscriptions(); len(subs["c2"]) != 0 || len(subs["c9"]) != 0 {
+		t.Errorf("second import changed subscriptions: %v", subs)
+	}
+}
+
+func TestLockDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firehawk.db")
+	unlock, err := lockDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockDatabase(path); !errors.Is(err, errDatabaseInUse) {
+		t.Errorf("second lock = %v, want errDatabaseInUse", err)
+	}
+	// The store itself is not locked out.
+	st, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	unlock()
+	unlock, err = lockDatabase(path)
+	if err != nil {
+		t.Fatalf("lock after unlocking: %v", err)
+	}
+	unlock()
+}
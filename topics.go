@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// topicAll is the upstream topic that carries every killmail.
+const topicAll = "all"
+
+// upstreamTopics are the topics Firehawk can leave to eve-kill: those derived only from fields
+// eve-kill sends with every kill (value, region, security and the solo and NPC flags), so both
+// sides put a kill in the same topics. Every other topic is computed locally. Ship classes and
+// tech levels come from shipgroups.json, and eve-kill classifies some groups differently (Logistics
+// cruisers, engineering complexes and refineries) or has no topic for them at all (industrials,
+// mining, pods, ...). A channel subscribed to one of them, or to any topic added later, needs
+// the full feed.
+var upstreamTopics = map[string]bool{
+	"10b":     true,
+	"5b":      true,
+	"solo":    true,
+	"npc":     true,
+	"abyssal": true,
+	"wspace":  true,
+	"highsec": true,
+	"lowsec":  true,
+	"nullsec": true,
+}
+
+// topicsChanged is signalled whenever feeds change, so sources can resubscribe upstream.
+var topicsChanged = make(chan struct{}, 1)
+
+// signalTopicsChanged asks the sources to recompute their upstream topics. It never blocks;
+// one pending signal is enough because the recompute reads the current state.
+func signalTopicsChanged() {
+	select {
+	case topicsChanged <- struct{}{}:
+	default:
+	}
+}
+
+// requiredUpstreamTopics returns the smallest set of eve-kill topics that covers every feed.
+// Subscriptions to upstreamTopics map straight onto them. Any other topic, and any filter,
+// watchlist or location, is matched locally against every kill, so it means subscribing to "all".
+func requiredUpstreamTopics() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if len(channelFilters) > 0 || len(watchlists) > 0 || len(locationSubscriptions) > 0 {
+		return []string{topicAll}
+	}
+
+	needed := make(map[string]bool)
+	for _, topics := range subscriptions {
+		for topic := range topics {
+			if !upstreamTopics[topic] {
+				return []string{topicAll}
+			}
+			needed[topic] = true
+		}
+	}
+
+	result := make([]string, 0, len(needed))
+	for topic := range needed {
+		result = append(result, topic)
+	}
+	slices.Sort(result)
+	return result
+}
+
+// diffTopics returns the topics to subscribe to and unsubscribe from to get from current to wanted.
+func diffTopics(current, wanted []string) (subscribe, unsubscribe []string) {
+	for _, topic := range wanted {
+		if !slices.Contains(current, topic) {
+			subscribe = append(subscribe, topic)
+		}
+	}
+	for _, topic := range current {
+		if !slices.Contains(wanted, topic) {
+			unsubscribe = append(unsubscribe, topic)
+		}
+	}
+	return subscribe, unsubscribe
+}
+
+// isTopicChoice reports whether topic is one of the topicChoices a channel can subscribe to.
+func isTopicChoice(topic string) bool {
+	return slices.ContainsFunc(topicChoices, func(c *discordgo.ApplicationCommandOptionChoice) bool {
+		return c.Value == topic
+	})
+}
+
+// topicSuggestions returns the topic choices whose name or value contains what the user has
+// typed so far, up to Discord's limit of 25.
+func topicSuggestions(typed string) []*discordgo.ApplicationCommandOptionChoice {
+	typed = strings.ToLower(strings.TrimSpace(typed))
+	var suggestions []*discordgo.ApplicationCommandOptionChoice
+	for _, c := range topicChoices {
+		if len(suggestions) == 25 {
+			break
+		}
+		if strings.Contains(strings.ToLower(c.Name), typed) || strings.Contains(fmt.Sprint(c.Value), typed) {
+			suggestions = append(suggestions, c)
+		}
+	}
+	return suggestions
+}
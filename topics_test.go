@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRequiredUpstreamTopics(t *testing.T) {
+	useAdminState(t)
+	for _, tc := range []struct {
+		name  string
+		setup func()
+		want  []string
+	}{
+		{"no feeds", func() {}, []string{}},
+		{"upstream topics", func() {
+			subscriptions["c1"] = map[string]bool{"nullsec": true, "10b": true}
+			subscriptions["c2"] = map[string]bool{"10b": true, "solo": true}
+		}, []string{"10b", "nullsec", "solo"}},
+		{"all", func() { subscriptions["c1"] = map[string]bool{"10b": true, "all": true} }, []string{topicAll}},
+		{"ship class", func() { subscriptions["c1"] = map[string]bool{"10b": true, "cruisers": true} }, []string{topicAll}},
+		{"tech level", func() { subscriptions["c1"] = map[string]bool{"t2": true} }, []string{topicAll}},
+		{"pods", func() { subscriptions["c1"] = map[string]bool{"pods": true} }, []string{topicAll}},
+		{"filter", func() {
+			subscriptions["c1"] = map[string]bool{"10b": true}
+			channelFilters["c2"], _ = ParseFilter("highsec")
+		}, []string{topicAll}},
+		{"watchlist", func() { watchlists["c2"] = []WatchEntry{{EntityType: "alliance", EntityID: 1}} }, []string{topicAll}},
+		{"location", func() { locationSubscriptions["c2"] = []LocationSubscription{{Kind: "system", ID: 30000142}} }, []string{topicAll}},
+	} {
+		subscriptions = make(map[string]map[string]bool)
+		channelFilters = make(map[string]*Filter)
+		watchlists = make(map[string][]WatchEntry)
+		locationSubscriptions = make(map[string][]LocationSubscription)
+		tc.setup()
+		if got := requiredUpstreamTopics(); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestUpstreamTopicsAreNotShipTopics keeps the upstream list to topics Firehawk and eve-kill
+// compute from the same fields: no topic a ship group can produce may be left to eve-kill.
+func TestUpstreamTopicsAreNotShipTopics(t *testing.T) {
+	useFeedState(t)
+	for id, group := range shipGroups {
+		for _, topic := range group.Topics() {
+			if upstreamTopics[topic] {
+				t.Errorf("group %d (%s) gives the upstream topic %q", id, group.Name, topic)
+			}
+		}
+	}
+	for _, topic := range []string{topicAll, "bigkills", "citadel", "capitals", "t1", "t2", "t3", "pods"} {
+		if upstreamTopics[topic] {
+			t.Errorf("%q is left to eve-kill", topic)
+		}
+	}
+	for topic := range upstreamTopics {
+		if !isKnownTopic(topic) {
+			t.Errorf("upstream topic %q is not a Firehawk topic", topic)
+		}
+	}
+}
+
+func TestDiffTopics(t *testing.T) {
+	for _, tc := range []struct {
+		current, wanted   []string
+		subscribe, remove []string
+	}{
+		{nil, []string{"all"}, []string{"all"}, nil},
+		{[]string{"all"}, []string{"all"}, nil, nil},
+		{[]string{"10b"}, []string{"10b", "5b"}, []string{"5b"}, nil},
+		{[]string{"10b", "5b"}, []string{"5b"}, nil, []string{"10b"}},
+		{[]string{"all"}, []string{"highsec", "lowsec"}, []string{"highsec", "lowsec"}, []string{"all"}},
+		{[]string{"10b"}, nil, nil, []string{"10b"}},
+	} {
+		subscribe, remove := diffTopics(tc.current, tc.wanted)
+		if !slices.Equal(subscribe, tc.subscribe) || !slices.Equal(remove, tc.remove) {
+			t.Errorf("diffTopics(%v, %v) = +%v -%v, want +%v -%v", tc.current, tc.wanted, subscribe, remove, tc.subscribe, tc.remove)
+		}
+	}
+}
+
+func TestEveKillSourceResubscribes(t *testing.T) {
+	// Every frame the server receives, prefixed with the number of the connection it came on.
+	frames := make(chan string, 10)
+	var connections atomic.Int32
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := strconv.Itoa(int(connections.Add(1)))
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			frames <- n + ":" + string(msg)
+		}
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	wanted := []string{"10b"}
+	setWanted := func(topics ...string) {
+		mu.Lock()
+		wanted = topics
+		mu.Unlock()
+	}
+	changed := make(chan struct{}, 1)
+	src := newEveKillSource("ws" + strings.TrimPrefix(srv.URL, "http"))
+	src.topics = func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(wanted)
+	}
+	src.topicsChanged = changed
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- src.Run(ctx, make(chan *KillmailData)) }()
+
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-frames:
+				if got != w {
+					t.Errorf("frame = %q, want %q", got, w)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %q", w)
+			}
+		}
+	}
+	expect("1:10b")
+
+	// A new topic is subscribed on the live connection.
+	setWanted("10b", "5b")
+	changed <- struct{}{}
+	expect("1:5b")
+	waitFor(t, func() bool { return slices.Equal(src.State().Topics, []string{"10b", "5b"}) })
+
+	// Dropping one reconnects straight away with only what is still wanted.
+	setWanted("5b", "nullsec")
+	changed <- struct{}{}
+	expect("2:5b", "2:nullsec")
+	waitFor(t, func() bool { return slices.Equal(src.State().Topics, []string{"5b", "nullsec"}) })
+	if state := src.State(); !strings.Contains(state.LastError, "upstream topics dropped: [10b]") {
+		t.Errorf("last error = %q", state.LastError)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run = %v", err)
+	}
+}
+
+// A narrow feed that never delivers anything, such as one the server silently refused, is
+// reconnected after the narrow stall timeout rather than left quiet for good.
+func TestEveKillSourceNarrowFeedStalls(t *testing.T) {
+	var connections atomic.Int32
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		connections.Add(1)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	src := newEveKillSource("ws" + strings.TrimPrefix(srv.URL, "http"))
+	src.topics = func() []string { return []string{"10b"} }
+	src.pingInterval = 10 * time.Millisecond
+	src.narrowStall = 50 * time.Millisecond
+	src.minBackoff = time.Millisecond
+	src.maxBackoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go src.Run(ctx, make(chan *KillmailData))
+
+	waitFor(t, func() bool { return connections.Load() >= 2 })
+	if state := src.State(); !strings.Contains(state.LastError, errStalled.Error()) {
+		t.Errorf("last error = %q", state.LastError)
+	}
+}
+
+func TestTopicChoices(t *testing.T) {
+	if len(killmailTopicChoices) > 25 || len(shipClassTopicChoices) > 25 {
+		t.Errorf("Discord allows at most 25 choices: %d and %d", len(killmailTopicChoices), len(shipClassTopicChoices))
+	}
+	seen := make(map[any]bool)
+	for _, c := range topicChoices {
+		if seen[c.Value] {
+			t.Errorf("topic %v is offered twice", c.Value)
+		}
+		seen[c.Value] = true
+	}
+	// Every topic a ship group can produce can be subscribed to.
+	for name, class := range shipClassesByGroupName {
+		if !isTopicChoice(class.Class) {
+			t.Errorf("%s kills get the %q topic, which has no choice", name, class.Class)
+		}
+	}
+
+	for _, tc := range []struct {
+		typed string
+		want  []string
+	}{
+		{"dread", []string{"dreadnoughts"}},
+		{"  Mining ", []string{"mining"}},
+		{"10b", []string{"10b"}},
+		{"nothing like it", nil},
+	} {
+		var got []string
+		for _, c := range topicSuggestions(tc.typed) {
+			got = append(got, c.Value.(string))
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("topicSuggestions(%q) = %v, want %v", tc.typed, got, tc.want)
+		}
+	}
+	if got := topicSuggestions(""); len(got) != 25 {
+		t.Errorf("%d suggestions before typing, want 25", len(got))
+	}
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
+	"math"
+	"strconv"
+	"strings"
 )
 
 func goSafely(fn func()) {
@@ -32,6 +33,28 @@ func formatISKHuman(value float64) string {
 	return fmt.Sprintf("%.2f ISK", value)
 }
 
+// parseISK reads a human ISK amount such as "500m", "3b" or "1.5B".
+func parseISK(text string) (float64, error) {
+	text = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(text)), ",", "")
+	text = strings.TrimSpace(strings.TrimSuffix(text, "isk"))
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(text, "k"):
+		multiplier, text = 1_000, strings.TrimSuffix(text, "k")
+	case strings.HasSuffix(text, "m"):
+		multiplier, text = 1_000_000, strings.TrimSuffix(text, "m")
+	case strings.HasSuffix(text, "b"):
+		multiplier, text = 1_000_000_000, strings.TrimSuffix(text, "b")
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	value *= multiplier
+	// ParseFloat also reads "nan" and "inf", which would switch the minimum off or hide every kill.
+	if err != nil || value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("%q is not an ISK amount (try 500m or 3b)", text)
+	}
+	return value, nil
+}
+
 // generateKillmailTopics checks a killmail and returns a slice of matching topics.
 func generateKillmailTopics(data *KillmailData) []string {
 	topics := []string{"all"}
@@ -71,80 +94,9 @@ func generateKillmailTopics(data *KillmailData) []string {
 	}
 
 	// --- Ship-based topics (using the victim's ship group ID) ---
-	switch data.Killmail.Victim.ShipGroupID {
-	// T1 Subcaps
-	case 25: // Frigate
-		topics = append(topics, "frigates", "t1")
-	case 420: // Destroyer
-		topics = append(topics, "destroyers", "t1")
-	case 26: // Cruiser
-		topics = append(topics, "cruisers", "t1")
-	case 540: // Battlecruiser
-		topics = append(topics, "battlecruisers", "t1")
-	case 27: // Battleship
-		topics = append(topics, "battleships", "t1")
-
-	// T2 and Faction Ships
-	case 324, 541, 830, 834, 893: // Assault Frigate, Interdictor, Covert Ops, Stealth Bomber, Interceptor
-		topics = append(topics, "frigates", "t2")
-	case 358, 831, 894: // Heavy Assault Cruiser, Combat Recon Ship, Heavy Interdiction Cruiser
-		topics = append(topics, "cruisers", "t2")
-	case 902: // Command Destroyer
-		topics = append(topics, "destroyers", "t2")
-	case 832, 833, 898, 900: // Logistics, Force Recon Ship, Black Ops, Marauder
-		topics = append(topics, "battleships", "t2")
-
-	// T3
-	case 906: // Strategic Cruiser (T3 Cruiser)
-		topics = append(topics, "cruisers", "t3")
-	case 941: // Tactical Destroyer (T3 Destroyer)
-		topics = append(topics, "destroyers", "t3")
-
-	// Capitals & Structures
-	case 513: // Freighter
-		topics = append(topics, "freighters")
-	case 30: // Titan
-		topics = append(topics, "titans", "capitals")
-	case 659: // Supercarrier
-		topics = append(topics, "supercarriers", "capitals")
-	case 485, 547, 1538: // Dreadnought, Carrier, FAX
-		topics = append(topics, "capitals")
-	case 1657: // Upwell Structures
-		topics = append(topics, "citadel")
+	if group, ok := shipGroups[data.Killmail.Victim.ShipGroupID]; ok {
+		topics = append(topics, group.Topics()...)
 	}
 
 	return topics
 }
-
-func loadSubscriptions() {
-	mu.Lock()
-	defer mu.Unlock()
-
-	data, err := os.ReadFile("subscriptions.json") // Use your SubMapFile variable
-
-	// Case 1: Handle errors during file reading.
-	if err != nil {
-		// If the file simply doesn't exist, that's okay. We'll just start fresh.
-		if os.IsNotExist(err) {
-			log.Println("subscriptions.json not found, starting with empty subscriptions.")
-			return
-		}
-		// For any other reading error, log it as a more serious problem.
-		log.Printf("Error reading subscriptions.json: %v", err)
-		return
-	}
-
-	// Case 2: If the file exists but is empty, there's nothing to load.
-	if len(data) == 0 {
-		log.Println("subscriptions.json is empty, starting with empty subscriptions.")
-		return
-	}
-
-	// Only if we have data, we try to unmarshal it.
-	err = json.Unmarshal(data, &subscriptions)
-	if err != nil {
-		log.Printf("Error unmarshaling subscriptions from JSON: %v", err)
-	} else {
-		log.Printf("Successfully loaded %d channel(s) with subscriptions.", len(subscriptions))
-	}
-}
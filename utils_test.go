@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestParseISK(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want float64
+	}{
+		{"500m", 500e6},
+		{"3b", 3e9},
+		{"1.5B ISK", 1.5e9},
+		{"2,500,000", 2.5e6},
+		{"0", 0},
+	} {
+		if got, err := parseISK(tc.text); err != nil || got != tc.want {
+			t.Errorf("parseISK(%q) = %v, %v, want %v", tc.text, got, err, tc.want)
+		}
+	}
+	for _, text := range []string{"", "lots", "-1", "-5b", "nan", "NaN", "inf", "-inf", "infb", "1e400"} {
+		if got, err := parseISK(text); err == nil {
+			t.Errorf("parseISK(%q) = %v, want an error", text, got)
+		}
+	}
+}
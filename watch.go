@@ -0,0 +1,88 @@
+package main
+
+import "fmt"
+
+// maxWatchesPerChannel stops a single channel from growing an unbounded watchlist.
+const maxWatchesPerChannel = 50
+
+// WatchEntry is a single character, corporation or alliance a channel is watching.
+// Side decides whether the channel hears about the entity's kills, its losses, or both.
+type WatchEntry struct {
+	EntityType string `json:"entity_type"` // "character", "corporation" or "alliance"
+	EntityID   int    `json:"entity_id"`
+	Name       string `json:"name"`
+	Side       string `json:"side"` // "kills", "losses" or "both"
+}
+
+// watchlists maps a channel ID to the entities it watches. Guarded by mu, like subscriptions.
+var watchlists = make(map[string][]WatchEntry)
+
+var watchEntityLabels = map[string]string{
+	"character":   "Character",
+	"corporation": "Corporation",
+	"alliance":    "Alliance",
+}
+
+// victimMatches reports whether the watched entity is the victim of the killmail.
+func (w WatchEntry) victimMatches(data *KillmailData) bool {
+	v := data.Killmail.Victim
+	return w.idMatches(v.CharacterID, v.CorporationID, v.AllianceID)
+}
+
+// attackerMatches reports whether the watched entity is among the attackers of the killmail.
+func (w WatchEntry) attackerMatches(data *KillmailData) bool {
+	for _, a := range data.Killmail.Attackers {
+		if w.idMatches(a.CharacterID, a.CorporationID, a.AllianceID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w WatchEntry) idMatches(characterID, corporationID, allianceID int) bool {
+	switch w.EntityType {
+	case "character":
+		return characterID == w.EntityID
+	case "corporation":
+		return corporationID == w.EntityID
+	case "alliance":
+		return allianceID != 0 && allianceID == w.EntityID
+	}
+	return false
+}
+
+// Matches reports whether the killmail is a kill or loss (depending on Side) for the watched entity.
+func (w WatchEntry) Matches(data *KillmailData) bool {
+	switch w.Side {
+	case "kills":
+		return w.attackerMatches(data)
+	case "losses":
+		return w.victimMatches(data)
+	default:
+		return w.victimMatches(data) || w.attackerMatches(data)
+	}
+}
+
+// watchlistMatches reports whether any entry in a channel's watchlist matches the killmail.
+func watchlistMatches(entries []WatchEntry, data *KillmailData) bool {
+	for _, w := range entries {
+		if w.Matches(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeWatch renders an entry for /watch list and confirmation messages.
+func describeWatch(w WatchEntry) string {
+	var side string
+	switch w.Side {
+	case "kills":
+		side = "kills only"
+	case "losses":
+		side = "losses only"
+	default:
+		side = "kills and losses"
+	}
+	return fmt.Sprintf("%s **%s** (`%d`) — %s", watchEntityLabels[w.EntityType], w.Name, w.EntityID, side)
+}
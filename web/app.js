@@ -0,0 +1,198 @@
+// The Firehawk dashboard. Everything goes through the JSON API under /dashboard/api/.
+"use strict";
+
+let me = null;
+
+async function api(method, path, body) {
+  const options = { method, headers: {} };
+  if (method !== "GET") {
+    options.headers["X-CSRF-Token"] = me.csrf_token;
+  }
+  if (body !== undefined) {
+    options.headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(body);
+  }
+  const resp = await fetch("/dashboard/api/" + path, options);
+  const data = await resp.json().catch(() => ({}));
+  if (!resp.ok) {
+    const err = new Error(data.error || resp.statusText);
+    err.status = resp.status;
+    throw err;
+  }
+  return data;
+}
+
+function showError(err) {
+  const el = document.getElementById("error");
+  el.textContent = err ? "⚠️ " + err.message : "";
+  el.hidden = !err;
+}
+
+// markdown renders the little Discord markdown the embeds use: bold and links.
+function markdown(text) {
+  const escaped = (text || "").replace(/[&<>"]/g, (c) => ({ "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;" })[c]);
+  return escaped
+    .replace(/\*\*(.+?)\*\*/g, "<b>$1</b>")
+    .replace(/\[([^\]]+)\]\((https:\/\/[^)\s]+)\)/g, '<a href="$2" target="_blank" rel="noopener">$1</a>')
+    .replace(/\n/g, "<br>");
+}
+
+function renderEmbed(embed) {
+  const el = document.createElement("div");
+  el.className = "embed";
+  el.style.borderLeftColor = "#" + (embed.color || 0).toString(16).padStart(6, "0");
+  const body = document.createElement("div");
+  body.className = "body";
+  if (embed.author) {
+    body.insertAdjacentHTML("beforeend", `<div class="note">${markdown(embed.author.name)}</div>`);
+  }
+  if (embed.title) {
+    body.insertAdjacentHTML("beforeend", `<div class="title">${markdown(embed.url ? `[${embed.title}](${embed.url})` : embed.title)}</div>`);
+  }
+  if (embed.description) {
+    body.insertAdjacentHTML("beforeend", `<div>${markdown(embed.description)}</div>`);
+  }
+  if (embed.fields) {
+    const fields = document.createElement("div");
+    fields.className = "fields";
+    for (const f of embed.fields) {
+      fields.insertAdjacentHTML("beforeend", `<div class="field${f.inline ? " inline" : ""}"><b>${markdown(f.name)}</b>${markdown(f.value)}</div>`);
+    }
+    body.append(fields);
+  }
+  if (embed.footer) {
+    body.insertAdjacentHTML("beforeend", `<div class="footer">${markdown(embed.footer.text)}</div>`);
+  }
+  el.append(body);
+  if (embed.thumbnail && embed.thumbnail.url.startsWith("https://")) {
+    const img = document.createElement("img");
+    img.className = "thumb";
+    img.src = embed.thumbnail.url;
+    el.append(img);
+  }
+  return el;
+}
+
+function renderChannel(guildID, channel) {
+  const section = document.getElementById("channel-template").content.firstElementChild.cloneNode(true);
+  const base = `guilds/${guildID}/channels/${channel.id}/`;
+  const update = (changed) => {
+    section.replaceWith(renderChannel(guildID, Object.assign({ name: channel.name }, changed)));
+  };
+
+  section.querySelector("h2").textContent = "#" + (channel.name || channel.id);
+  if (channel.suspended) {
+    const note = section.querySelector(".suspended");
+    note.textContent = "⏸️ Suspended: " + channel.suspended + ". Use /feed resume in Discord.";
+    note.hidden = false;
+  }
+
+  const topics = section.querySelector(".topics");
+  for (const topic of me.topics) {
+    const label = document.createElement("label");
+    const box = document.createElement("input");
+    box.type = "checkbox";
+    box.checked = channel.topics.includes(topic.value);
+    box.addEventListener("change", async () => {
+      box.disabled = true;
+      try {
+        update(await api(box.checked ? "PUT" : "DELETE", base + "topics/" + encodeURIComponent(topic.value)));
+        showError(null);
+      } catch (err) {
+        box.checked = !box.checked;
+        box.disabled = false;
+        showError(err);
+      }
+    });
+    label.append(box, " " + topic.name);
+    topics.append(label);
+  }
+
+  const form = section.querySelector(".filter");
+  form.expression.value = channel.filter || "";
+  form.addEventListener("submit", async (e) => {
+    e.preventDefault();
+    try {
+      update(await api("PUT", base + "filter", { expression: form.expression.value }));
+      showError(null);
+    } catch (err) {
+      showError(err);
+    }
+  });
+  section.querySelector(".clear").addEventListener("click", async () => {
+    try {
+      update(await api("DELETE", base + "filter"));
+      showError(null);
+    } catch (err) {
+      showError(err);
+    }
+  });
+
+  const style = section.querySelector(".style");
+  style.append(new Option("Channel style", ""));
+  for (const s of me.embed_styles) {
+    style.append(new Option(s, s));
+  }
+  section.querySelector(".preview").addEventListener("click", async () => {
+    try {
+      const preview = await api("GET", base + "preview" + (style.value ? "?style=" + style.value : ""));
+      const target = section.querySelector(".preview-embed");
+      target.replaceChildren(renderEmbed(preview.embed));
+      section.querySelector(".matches").textContent = preview.matches
+        ? "✅ This channel's feed would post it."
+        : "This channel's topics and filter wouldn't pick this kill up.";
+      showError(null);
+    } catch (err) {
+      showError(err);
+    }
+  });
+  return section;
+}
+
+async function loadGuild(guildID) {
+  const list = document.getElementById("channels");
+  list.replaceChildren();
+  try {
+    const channels = await api("GET", `guilds/${guildID}/channels`);
+    for (const channel of channels) {
+      list.append(renderChannel(guildID, channel));
+    }
+    if (channels.length === 0) {
+      list.textContent = "No channels with feeds yet. Use /subscribe in Discord to start one.";
+    }
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function start() {
+  try {
+    me = await api("GET", "me");
+  } catch (err) {
+    document.getElementById("signed-out").hidden = err.status !== 401;
+    showError(err.status === 401 ? null : err);
+    return;
+  }
+  document.getElementById("user").textContent = me.name;
+  const logout = document.getElementById("logout");
+  logout.hidden = false;
+  logout.addEventListener("click", async () => {
+    await fetch("/dashboard/logout", { method: "POST", headers: { "X-CSRF-Token": me.csrf_token } });
+    location.reload();
+  });
+
+  if (me.guilds.length === 0) {
+    document.getElementById("no-guilds").hidden = false;
+    return;
+  }
+  const select = document.getElementById("guild");
+  for (const g of me.guilds) {
+    select.append(new Option(g.name, g.id));
+  }
+  select.hidden = me.guilds.length < 2;
+  select.addEventListener("change", () => loadGuild(select.value));
+  loadGuild(select.value);
+}
+
+start();